@@ -1,6 +1,6 @@
 const path = require('path');
 const os = require('os');
-// const { workspace, languages, ExtensionContext } = require('vscode');
+const { commands, window, workspace } = require('vscode');
 const { LanguageClient, TransportKind } = require('vscode-languageclient/node');
 
 function activate(context) {
@@ -8,25 +8,29 @@ function activate(context) {
 
     const serverModule = getServerPath();
  
-    // Get the log level from the kuneiform extension configuration
-    // const config = workspace.getConfiguration('kuneiform');
-    // const logLevel = config.get('logLevel', 'info');
+    // Get the log level from the kuneiform extension configuration. Later
+    // changes to the logging settings are sent to the running server.
+    const config = workspace.getConfiguration('kuneiform');
+    const logLevel = config.get('logging.level', 'info');
 
     let serverOptions = {
         run: {
             command: serverModule,
-            // args: ['-loglevel', logLevel],
+            args: ['--log-level', logLevel],
             transport: TransportKind.stdio
         },
         debug: {
             command: serverModule,
-            // args: ['-loglevel', logLevel],
+            args: ['--log-level', logLevel],
             transport: TransportKind.stdio
         }
     };
 
     let clientOptions = {
-        documentSelector: [{ scheme: 'file', language: 'kuneiform' }]
+        documentSelector: [{ scheme: 'file', language: 'kuneiform' }],
+        synchronize: {
+            configurationSection: 'kuneiform'
+        }
     };
 
     let client = new LanguageClient(
@@ -36,6 +40,77 @@ function activate(context) {
         clientOptions
     );
 
+    // Code lenses pass the locations to show, in protocol types.
+    context.subscriptions.push(commands.registerCommand('kuneiform.showReferences', (uri, position, locations) => {
+        const converter = client.protocol2CodeConverter;
+        return commands.executeCommand(
+            'editor.action.showReferences',
+            converter.asUri(uri),
+            converter.asPosition(position),
+            locations.map(location => converter.asLocation(location))
+        );
+    }));
+
+    // Renders the tables of the active document as a diagram in a new editor.
+    context.subscriptions.push(commands.registerCommand('kuneiform.showERD', async () => {
+        const editor = window.activeTextEditor;
+        if (!editor || editor.document.languageId !== 'kuneiform') {
+            window.showErrorMessage('Open a Kuneiform file to draw its tables.');
+            return;
+        }
+        const format = await window.showQuickPick(['mermaid', 'dot', 'plantuml'], { placeHolder: 'Diagram format' });
+        if (!format) {
+            return;
+        }
+        try {
+            const diagram = await client.sendRequest('workspace/executeCommand', {
+                command: 'kuneiform.erd',
+                arguments: [editor.document.uri.toString(), format]
+            });
+            const doc = await workspace.openTextDocument({ content: diagram, language: format });
+            await window.showTextDocument(doc, { preview: false });
+        } catch (err) {
+            window.showErrorMessage(`Could not draw the diagram: ${err.message}`);
+        }
+    }));
+
+    // Shows the schema of the active document as the JSON that is deployed.
+    context.subscriptions.push(commands.registerCommand('kuneiform.showCompiledSchema', async () => {
+        const editor = window.activeTextEditor;
+        if (!editor || editor.document.languageId !== 'kuneiform') {
+            window.showErrorMessage('Open a Kuneiform file to compile it.');
+            return;
+        }
+        try {
+            const schema = await client.sendRequest('kuneiform/compiledSchema', {
+                textDocument: { uri: editor.document.uri.toString() }
+            });
+            const doc = await workspace.openTextDocument({ content: JSON.stringify(schema, null, 2), language: 'json' });
+            await window.showTextDocument(doc, { preview: false });
+        } catch (err) {
+            window.showErrorMessage(`Could not compile the schema: ${err.message}`);
+        }
+    }));
+
+    // Shows the tables of the active document as PostgreSQL DDL.
+    context.subscriptions.push(commands.registerCommand('kuneiform.showDDL', async () => {
+        const editor = window.activeTextEditor;
+        if (!editor || editor.document.languageId !== 'kuneiform') {
+            window.showErrorMessage('Open a Kuneiform file to export its tables.');
+            return;
+        }
+        try {
+            const ddl = await client.sendRequest('workspace/executeCommand', {
+                command: 'kuneiform.ddl',
+                arguments: [editor.document.uri.toString()]
+            });
+            const doc = await workspace.openTextDocument({ content: ddl, language: 'sql' });
+            await window.showTextDocument(doc, { preview: false });
+        } catch (err) {
+            window.showErrorMessage(`Could not export the tables: ${err.message}`);
+        }
+    }));
+
     client.start();
 }
 
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// The kwil-db parser has visitors for analysis, but no generic traversal.
+// walkNode visits every node of the action and procedure ASTs, which is what
+// most editor features need.
+
+// walkNode calls fn for n and its descendants, depth first. If fn returns
+// false, the children of the node are skipped.
+func walkNode(n parse.Node, fn func(parse.Node) bool) {
+	if isNilNode(n) || !fn(n) {
+		return
+	}
+	for _, child := range childNodes(n) {
+		walkNode(child, fn)
+	}
+}
+
+// walkBodies walks the ASTs of all actions and procedures of a schema, in
+// declaration order. method is the name of the action or procedure.
+func walkBodies(r *parse.SchemaParseResult, fn func(method string, n parse.Node) bool) {
+	if r == nil || r.Schema == nil {
+		return
+	}
+
+	for _, action := range r.Schema.Actions {
+		for _, stmt := range r.ParsedActions[action.Name] {
+			walkNode(stmt, func(n parse.Node) bool { return fn(action.Name, n) })
+		}
+	}
+
+	for _, procedure := range r.Schema.Procedures {
+		for _, stmt := range r.ParsedProcedures[procedure.Name] {
+			walkNode(stmt, func(n parse.Node) bool { return fn(procedure.Name, n) })
+		}
+	}
+}
+
+func isNilNode(n parse.Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// childNodes returns the direct children of a node, in source order.
+func childNodes(n parse.Node) []parse.Node {
+	var children []parse.Node
+	add := func(nodes ...parse.Node) {
+		for _, node := range nodes {
+			if !isNilNode(node) {
+				children = append(children, node)
+			}
+		}
+	}
+	addExprs := func(exprs []parse.Expression) {
+		for _, e := range exprs {
+			add(e)
+		}
+	}
+	addStmts := func(stmts []parse.ProcedureStmt) {
+		for _, s := range stmts {
+			add(s)
+		}
+	}
+	addJoins := func(joins []*parse.Join) {
+		for _, j := range joins {
+			add(j)
+		}
+	}
+	addSets := func(sets []*parse.UpdateSetClause) {
+		for _, s := range sets {
+			add(s)
+		}
+	}
+	addSelect := func(s *parse.SelectStatement) {
+		if s != nil {
+			add(s)
+		}
+	}
+	addSQL := func(s *parse.SQLStatement) {
+		if s != nil {
+			add(s)
+		}
+	}
+
+	switch n := n.(type) {
+	case *parse.ExpressionFunctionCall:
+		addExprs(n.Args)
+	case *parse.ExpressionForeignCall:
+		addExprs(n.ContextualArgs)
+		addExprs(n.Args)
+	case *parse.ExpressionArrayAccess:
+		add(n.Array, n.Index, n.FromTo[0], n.FromTo[1])
+	case *parse.ExpressionMakeArray:
+		addExprs(n.Values)
+	case *parse.ExpressionFieldAccess:
+		add(n.Record)
+	case *parse.ExpressionParenthesized:
+		add(n.Inner)
+	case *parse.ExpressionComparison:
+		add(n.Left, n.Right)
+	case *parse.ExpressionLogical:
+		add(n.Left, n.Right)
+	case *parse.ExpressionArithmetic:
+		add(n.Left, n.Right)
+	case *parse.ExpressionUnary:
+		add(n.Expression)
+	case *parse.ExpressionCollate:
+		add(n.Expression)
+	case *parse.ExpressionStringComparison:
+		add(n.Left, n.Right)
+	case *parse.ExpressionIs:
+		add(n.Left, n.Right)
+	case *parse.ExpressionBetween:
+		add(n.Expression, n.Lower, n.Upper)
+	case *parse.ExpressionIn:
+		add(n.Expression)
+		addExprs(n.List)
+		addSelect(n.Subquery)
+	case *parse.ExpressionSubquery:
+		addSelect(n.Subquery)
+	case *parse.ExpressionCase:
+		add(n.Case)
+		for _, wt := range n.WhenThen {
+			add(wt[0], wt[1])
+		}
+		add(n.Else)
+	case *parse.CommonTableExpression:
+		addSelect(n.Query)
+	case *parse.SQLStatement:
+		for _, cte := range n.CTEs {
+			add(cte)
+		}
+		add(n.SQL)
+	case *parse.SelectStatement:
+		for _, core := range n.SelectCores {
+			add(core)
+		}
+		for _, term := range n.Ordering {
+			add(term)
+		}
+		add(n.Limit, n.Offset)
+	case *parse.SelectCore:
+		for _, col := range n.Columns {
+			add(col)
+		}
+		add(n.From)
+		addJoins(n.Joins)
+		add(n.Where)
+		addExprs(n.GroupBy)
+		add(n.Having)
+	case *parse.ResultColumnExpression:
+		add(n.Expression)
+	case *parse.RelationSubquery:
+		addSelect(n.Subquery)
+	case *parse.RelationFunctionCall:
+		add(n.FunctionCall)
+	case *parse.Join:
+		add(n.Relation, n.On)
+	case *parse.UpdateStatement:
+		addSets(n.SetClause)
+		add(n.From)
+		addJoins(n.Joins)
+		add(n.Where)
+	case *parse.UpdateSetClause:
+		add(n.Value)
+	case *parse.DeleteStatement:
+		add(n.From)
+		addJoins(n.Joins)
+		add(n.Where)
+	case *parse.InsertStatement:
+		for _, row := range n.Values {
+			addExprs(row)
+		}
+		if n.Upsert != nil {
+			add(n.Upsert)
+		}
+	case *parse.UpsertClause:
+		add(n.ConflictWhere)
+		addSets(n.DoUpdate)
+		add(n.UpdateWhere)
+	case *parse.OrderingTerm:
+		add(n.Expression)
+	case *parse.ActionStmtSQL:
+		addSQL(n.SQL)
+	case *parse.ActionStmtExtensionCall:
+		addExprs(n.Args)
+	case *parse.ActionStmtActionCall:
+		addExprs(n.Args)
+	case *parse.ProcedureStmtDeclaration:
+		add(n.Variable)
+	case *parse.ProcedureStmtAssign:
+		add(n.Variable, n.Value)
+	case *parse.ProcedureStmtCall:
+		for _, rec := range n.Receivers {
+			add(rec)
+		}
+		add(n.Call)
+	case *parse.ProcedureStmtForLoop:
+		add(n.Receiver, n.LoopTerm)
+		addStmts(n.Body)
+	case *parse.LoopTermRange:
+		add(n.Start, n.End)
+	case *parse.LoopTermSQL:
+		addSQL(n.Statement)
+	case *parse.LoopTermVariable:
+		add(n.Variable)
+	case *parse.ProcedureStmtIf:
+		for _, ifThen := range n.IfThens {
+			add(ifThen)
+		}
+		addStmts(n.Else)
+	case *parse.IfThen:
+		add(n.If)
+		addStmts(n.Then)
+	case *parse.ProcedureStmtSQL:
+		addSQL(n.SQL)
+	case *parse.ProcedureStmtReturn:
+		addExprs(n.Values)
+		addSQL(n.SQL)
+	case *parse.ProcedureStmtReturnNext:
+		addExprs(n.Values)
+	}
+
+	return children
+}
+
+// hasPosition reports whether the parser recorded a source position for the
+// node. Nodes added during analysis (e.g. default orderings) have none.
+func hasPosition(pos *parse.Position) bool {
+	return pos.StartLine > 0 && pos.EndLine > 0
+}
+
+// nodeRange converts an AST position to an LSP range. The parser records the
+// start of the last token as the end of a node, so the tokens of the document
+// are used to find where that token actually ends.
+func nodeRange(toks []token, pos *parse.Position) lsp.Range {
+	rng := lsp.Range{
+		Start: lsp.Position{Line: pos.StartLine - 1, Character: pos.StartCol},
+		End:   lsp.Position{Line: pos.EndLine - 1, Character: pos.EndCol + 1},
+	}
+	if tok, ok := tokenAt(toks, pos.EndLine-1, pos.EndCol); ok {
+		rng.End = tokenRange(tok).End
+	}
+	return rng
+}
+
+// tokenAt returns the token starting at the given zero based line and column.
+func tokenAt(toks []token, line, col int) (token, bool) {
+	i := sort.Search(len(toks), func(i int) bool {
+		return toks[i].line > line || (toks[i].line == line && toks[i].col >= col)
+	})
+	if i < len(toks) && toks[i].line == line && toks[i].col == col {
+		return toks[i], true
+	}
+	return token{}, false
+}
@@ -3,6 +3,9 @@
 # Define the name of your output binary
 BINARY_NAME="kuneiform-lsp"
 
+# Version reported by `kuneiform-lsp --version`
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo "dev")
+
 # Define the list of OS and architecture combinations you want to build for
 OS=("linux" "darwin" "windows")
 ARCH=("amd64" "arm64")
@@ -22,7 +25,7 @@ for os in "${OS[@]}"; do
         fi
 
         echo "Building for ${os}/${arch}..."
-        env GOOS=$os GOARCH=$arch go build -o $OUTPUT ./...
+        env GOOS=$os GOARCH=$arch go build -ldflags "-X main.version=${VERSION}" -o $OUTPUT ./...
 
         if [ $? -ne 0 ]; then
             echo "Failed to build for ${os}/${arch}"
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// The call graph of a schema: which actions and procedures call which
+// actions, procedures, foreign procedures and extension methods, built from
+// the parsed bodies.
+
+type calleeKind int
+
+const (
+	calleeAction calleeKind = iota
+	calleeProcedure
+	calleeForeignProcedure
+	calleeExtensionMethod
+)
+
+// callSite is a call in the body of an action or procedure.
+type callSite struct {
+	// caller is the action or procedure making the call.
+	caller string
+	// callee is the called action or procedure, or alias.method for an
+	// extension method.
+	callee string
+	kind   calleeKind
+	// rng is the range of the callee's name at the call.
+	rng lsp.Range
+}
+
+type callGraph struct {
+	calls []callSite
+}
+
+func buildCallGraph(toks []token, r *parse.SchemaParseResult) *callGraph {
+	g := &callGraph{}
+	if r == nil || r.Schema == nil {
+		return g
+	}
+
+	procedures := make(map[string]bool)
+	for _, proc := range r.Schema.Procedures {
+		procedures[strings.ToLower(proc.Name)] = true
+	}
+
+	add := func(caller, callee string, kind calleeKind, pos *parse.Position) {
+		if !hasPosition(pos) {
+			return
+		}
+		g.calls = append(g.calls, callSite{
+			caller: caller,
+			callee: callee,
+			kind:   kind,
+			rng:    calleeRange(toks, pos, callee),
+		})
+	}
+
+	walkBodies(r, func(method string, n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ActionStmtActionCall:
+			// actions call both actions and procedures with the same syntax
+			kind := calleeAction
+			if procedures[strings.ToLower(n.Action)] {
+				kind = calleeProcedure
+			}
+			add(method, strings.ToLower(n.Action), kind, &n.Position)
+		case *parse.ExpressionFunctionCall:
+			if procedures[strings.ToLower(n.Name)] {
+				add(method, strings.ToLower(n.Name), calleeProcedure, &n.Position)
+			}
+		case *parse.ExpressionForeignCall:
+			add(method, strings.ToLower(n.Name), calleeForeignProcedure, &n.Position)
+		case *parse.ActionStmtExtensionCall:
+			add(method, normalizeIdent(n.Extension+"."+n.Method), calleeExtensionMethod, &n.Position)
+		}
+		return true
+	})
+	return g
+}
+
+// calleeRange finds the name of the callee in the tokens of a call, which
+// may start with receivers.
+func calleeRange(toks []token, pos *parse.Position, callee string) lsp.Range {
+	first := strings.Split(callee, ".")[0]
+	start := tokenIndexAt(toks, tokenOffset(toks, pos.StartLine-1, pos.StartCol))
+	for i := max(start, 0); start >= 0 && i < len(toks); i++ {
+		if toks[i].line > pos.EndLine-1 {
+			break
+		}
+		if toks[i].kind != tokIdent || !toks[i].is(first) {
+			continue
+		}
+		rng := tokenRange(toks[i])
+		if first != callee && i+2 < len(toks) && toks[i+1].text == "." {
+			rng.End = tokenRange(toks[i+2]).End
+		}
+		return rng
+	}
+	return nodeRange(toks, pos)
+}
+
+// callers returns the distinct actions and procedures calling name, in the
+// order of their first call.
+func (g *callGraph) callers(name string) []string {
+	var callers []string
+	seen := make(map[string]bool)
+	for _, call := range g.calls {
+		if call.callee == strings.ToLower(name) && !seen[call.caller] {
+			seen[call.caller] = true
+			callers = append(callers, call.caller)
+		}
+	}
+	return callers
+}
+
+// callsTo returns the calls of name.
+func (g *callGraph) callsTo(name string) []callSite {
+	var calls []callSite
+	for _, call := range g.calls {
+		if call.callee == strings.ToLower(name) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// callsFrom returns the calls made by the body of an action or procedure.
+func (g *callGraph) callsFrom(caller string) []callSite {
+	var calls []callSite
+	for _, call := range g.calls {
+		if call.caller == strings.ToLower(caller) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
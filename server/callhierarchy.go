@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Call hierarchy over the call graph. Actions and procedures are callers and
+// callees; foreign procedures and extension methods are only callees. Items
+// are identified by name, so they stay valid while the document is edited.
+
+// prepareCallHierarchy returns the item for the action, procedure, foreign
+// procedure or extension method named at pos.
+func prepareCallHierarchy(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult, pos lsp.Position) []callHierarchyItem {
+	items := make([]callHierarchyItem, 0)
+	if r == nil || r.Schema == nil {
+		return items
+	}
+	toks := lexKf(text)
+	i := tokenIndexAt(toks, positionOffset(lineOffsets(text), pos))
+	if i < 0 || toks[i].kind != tokIdent {
+		return items
+	}
+
+	name := normalizeIdent(toks[i].text)
+	// alias.method of an extension, with the cursor on either name
+	if i >= 2 && toks[i-1].text == "." && toks[i-2].kind == tokIdent {
+		name = normalizeIdent(toks[i-2].text) + "." + name
+	} else if i+2 < len(toks) && toks[i+1].text == "." && toks[i+2].kind == tokIdent {
+		name += "." + normalizeIdent(toks[i+2].text)
+	}
+
+	if item, ok := callHierarchyItemFor(uri, toks, r, name); ok {
+		items = append(items, item)
+	}
+	return items
+}
+
+func getIncomingCalls(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult, item callHierarchyItem) []callHierarchyIncomingCall {
+	calls := make([]callHierarchyIncomingCall, 0)
+	toks := lexKf(text)
+	graph := buildCallGraph(toks, r)
+
+	index := make(map[string]int)
+	for _, call := range graph.callsTo(item.Name) {
+		i, ok := index[call.caller]
+		if !ok {
+			from, found := callHierarchyItemFor(uri, toks, r, call.caller)
+			if !found {
+				continue
+			}
+			i = len(calls)
+			index[call.caller] = i
+			calls = append(calls, callHierarchyIncomingCall{From: from})
+		}
+		calls[i].FromRanges = append(calls[i].FromRanges, call.rng)
+	}
+	return calls
+}
+
+func getOutgoingCalls(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult, item callHierarchyItem) []callHierarchyOutgoingCall {
+	calls := make([]callHierarchyOutgoingCall, 0)
+	toks := lexKf(text)
+	graph := buildCallGraph(toks, r)
+
+	index := make(map[string]int)
+	for _, call := range graph.callsFrom(item.Name) {
+		i, ok := index[call.callee]
+		if !ok {
+			to, found := callHierarchyItemFor(uri, toks, r, call.callee)
+			if !found {
+				continue
+			}
+			i = len(calls)
+			index[call.callee] = i
+			calls = append(calls, callHierarchyOutgoingCall{To: to})
+		}
+		calls[i].FromRanges = append(calls[i].FromRanges, call.rng)
+	}
+	return calls
+}
+
+// callHierarchyItemFor returns the item for a declared action, procedure or
+// foreign procedure, or an alias.method of an extension used by the schema.
+func callHierarchyItemFor(uri lsp.DocumentURI, toks []token, r *parse.SchemaParseResult, name string) (callHierarchyItem, bool) {
+	if r == nil || r.Schema == nil || r.SchemaInfo == nil {
+		return callHierarchyItem{}, false
+	}
+	name = strings.ToLower(name)
+
+	item := callHierarchyItem{Name: name, URI: uri}
+	declared := name
+	switch {
+	case strings.Contains(name, "."):
+		alias := strings.SplitN(name, ".", 2)[0]
+		if _, ok := r.Schema.FindExtensionImport(alias); !ok {
+			return callHierarchyItem{}, false
+		}
+		item.Kind, item.Detail, declared = lsp.SKModule, "extension method", alias
+	case isAction(r, name):
+		item.Kind, item.Detail = lsp.SKMethod, "action"
+	case isProcedure(r, name):
+		item.Kind, item.Detail = lsp.SKFunction, "procedure"
+	case isForeignProcedure(r, name):
+		item.Kind, item.Detail = lsp.SKInterface, "foreign procedure"
+	default:
+		return callHierarchyItem{}, false
+	}
+
+	block, ok := r.SchemaInfo.Blocks[declared]
+	if !ok {
+		return callHierarchyItem{}, false
+	}
+	item.Range = blockRange(block)
+	item.SelectionRange = item.Range
+	if tok, ok := declaredName(toks, block, declared); ok {
+		item.SelectionRange = tokenRange(tok)
+	}
+	return item, true
+}
+
+func isAction(r *parse.SchemaParseResult, name string) bool {
+	_, ok := r.Schema.FindAction(name)
+	return ok
+}
+
+func isProcedure(r *parse.SchemaParseResult, name string) bool {
+	_, ok := r.Schema.FindProcedure(name)
+	return ok
+}
+
+func isForeignProcedure(r *parse.SchemaParseResult, name string) bool {
+	_, ok := r.Schema.FindForeignProcedure(name)
+	return ok
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_CallHierarchy(t *testing.T) {
+	src := `database glow;
+
+use math as m;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+foreign procedure remote_name($id uuid) returns (text)
+
+procedure get_name($id uuid) public view returns (name text) {
+    return remote_name['x_dbid', 'get_name']($id);
+}
+
+procedure greet($id uuid) public view returns (greeting text) {
+    return 'hello ' || get_name($id) || get_name($id);
+}
+
+action add($a, $b) public view {
+    $sum = m.add($a, $b);
+    SELECT $sum;
+}
+
+action twice($a) public view {
+    add($a, $a);
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+	uri := lsp.DocumentURI("file:///glow.kf")
+
+	// the cursor on the call of get_name in greet
+	items := prepareCallHierarchy(uri, src, res, lsp.Position{Line: 16, Character: 25})
+	if len(items) != 1 || items[0].Name != "get_name" || items[0].Kind != lsp.SKFunction || items[0].SelectionRange.Start.Line != 11 {
+		t.Fatalf("unexpected items %+v", items)
+	}
+
+	incoming := getIncomingCalls(uri, src, res, items[0])
+	if len(incoming) != 1 || incoming[0].From.Name != "greet" || len(incoming[0].FromRanges) != 2 {
+		t.Errorf("unexpected incoming calls %+v", incoming)
+	}
+
+	outgoing := getOutgoingCalls(uri, src, res, items[0])
+	if len(outgoing) != 1 || outgoing[0].To.Name != "remote_name" || outgoing[0].To.Kind != lsp.SKInterface {
+		t.Errorf("unexpected outgoing calls %+v", outgoing)
+	}
+
+	// the extension method, with the cursor on its alias
+	items = prepareCallHierarchy(uri, src, res, lsp.Position{Line: 20, Character: 12})
+	if len(items) != 1 || items[0].Name != "m.add" || items[0].Range.Start.Line != 2 {
+		t.Fatalf("unexpected items %+v", items)
+	}
+	incoming = getIncomingCalls(uri, src, res, items[0])
+	if len(incoming) != 1 || incoming[0].From.Name != "add" {
+		t.Errorf("unexpected incoming calls %+v", incoming)
+	}
+	if rng := incoming[0].FromRanges[0]; rng.Start.Character != 11 || rng.End.Character != 16 {
+		t.Errorf("expected the call range to cover m.add, got %+v", rng)
+	}
+
+	// actions calling actions
+	items = prepareCallHierarchy(uri, src, res, lsp.Position{Line: 19, Character: 8})
+	if len(items) != 1 || items[0].Name != "add" || items[0].Kind != lsp.SKMethod {
+		t.Fatalf("unexpected items %+v", items)
+	}
+	incoming = getIncomingCalls(uri, src, res, items[0])
+	if len(incoming) != 1 || incoming[0].From.Name != "twice" {
+		t.Errorf("unexpected incoming calls %+v", incoming)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// The check command runs the same diagnostics as the editor over files, for
+// use in CI. Results can be printed as text, JSON, SARIF 2.1 (for code
+// scanning) or JUnit XML.
+
+// parseErrorCode identifies diagnostics reported by the parser, as opposed
+// to lint rules which use their own name.
+const parseErrorCode = "parse-error"
+
+type checkFile struct {
+	path        string
+	diagnostics []lsp.Diagnostic
+}
+
+var checkWriters = map[string]func(io.Writer, []checkFile) error{
+	"text":  writeCheckText,
+	"json":  writeCheckJSON,
+	"sarif": writeCheckSARIF,
+	"junit": writeCheckJUnit,
+}
+
+func runCheck(args []string, stdout io.Writer) error {
+	fs := newFlagSet("check", "check [flags] <files or dirs>")
+	format := fs.String("format", "text", "output format: text, json, sarif or junit")
+	maxWarnings := fs.Int("max-warnings", -1, "fail if there are more warnings than this, -1 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	write, ok := checkWriters[*format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", *format)
+	}
+
+	files, err := collectKfFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	results := make([]checkFile, 0, len(files))
+	reported := make(map[string]bool)
+	// databases split across files are checked once, by their first file
+	databases := make(map[lsp.DocumentURI]map[lsp.DocumentURI][]lsp.Diagnostic)
+	for _, file := range files {
+		settings, err := loadFileSettings(file)
+		if err != nil {
+			return err
+		}
+		for _, problem := range settings.problems() {
+			if !reported[problem] {
+				reported[problem] = true
+				fmt.Fprintf(os.Stderr, "warning: %s\n", problem)
+			}
+		}
+
+		src, err := readDatabaseSource(file)
+		if err != nil {
+			return err
+		}
+		var diagnostics []lsp.Diagnostic
+		if src != nil {
+			byFile, ok := databases[src.files[0].uri]
+			if !ok {
+				_, merged := analyzeKfDocument(src.text, settings)
+				byFile = src.splitDiagnostics(merged)
+				databases[src.files[0].uri] = byFile
+			}
+			diagnostics = byFile[fileURI(file)]
+		} else {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			_, diagnostics = analyzeKfDocument(string(text), settings)
+		}
+		sort.SliceStable(diagnostics, func(i, j int) bool {
+			a, b := diagnostics[i].Range.Start, diagnostics[j].Range.Start
+			return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+		})
+		results = append(results, checkFile{path: file, diagnostics: diagnostics})
+	}
+
+	if err := write(stdout, results); err != nil {
+		return err
+	}
+
+	errCount, warnCount := countDiagnostics(results)
+	if errCount > 0 || (*maxWarnings >= 0 && warnCount > *maxWarnings) {
+		return exitCode(1)
+	}
+	return nil
+}
+
+func countDiagnostics(results []checkFile) (errCount, warnCount int) {
+	for _, res := range results {
+		for _, d := range res.diagnostics {
+			switch d.Severity {
+			case lsp.Error:
+				errCount++
+			case lsp.Warning:
+				warnCount++
+			}
+		}
+	}
+	return errCount, warnCount
+}
+
+func diagnosticCode(d lsp.Diagnostic) string {
+	if d.Code == "" {
+		return parseErrorCode
+	}
+	return d.Code
+}
+
+func writeCheckText(w io.Writer, results []checkFile) error {
+	for _, res := range results {
+		for _, d := range res.diagnostics {
+			msg := d.Message
+			if d.Code != "" {
+				msg += " (" + d.Code + ")"
+			}
+			fmt.Fprintf(w, "%s:%d:%d: %s: %s\n", res.path, d.Range.Start.Line+1, d.Range.Start.Character+1,
+				severityName(d.Severity), msg)
+		}
+	}
+
+	errCount, warnCount := countDiagnostics(results)
+	if errCount > 0 || warnCount > 0 {
+		fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errCount, warnCount)
+	}
+	return nil
+}
+
+type checkJSONReport struct {
+	Files    []checkJSONFile `json:"files"`
+	Errors   int             `json:"errors"`
+	Warnings int             `json:"warnings"`
+}
+
+type checkJSONFile struct {
+	Path        string                `json:"path"`
+	Diagnostics []checkJSONDiagnostic `json:"diagnostics"`
+}
+
+type checkJSONDiagnostic struct {
+	Severity  string `json:"severity"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+}
+
+func writeCheckJSON(w io.Writer, results []checkFile) error {
+	report := checkJSONReport{Files: make([]checkJSONFile, 0, len(results))}
+	report.Errors, report.Warnings = countDiagnostics(results)
+
+	for _, res := range results {
+		file := checkJSONFile{Path: res.path, Diagnostics: make([]checkJSONDiagnostic, 0, len(res.diagnostics))}
+		for _, d := range res.diagnostics {
+			file.Diagnostics = append(file.Diagnostics, checkJSONDiagnostic{
+				Severity:  severityName(d.Severity),
+				Code:      diagnosticCode(d),
+				Message:   d.Message,
+				Line:      d.Range.Start.Line + 1,
+				Column:    d.Range.Start.Character + 1,
+				EndLine:   d.Range.End.Line + 1,
+				EndColumn: d.Range.End.Character + 1,
+			})
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// SARIF 2.1.0, limited to what code scanning tools read.
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func sarifLevel(s lsp.DiagnosticSeverity) string {
+	switch s {
+	case lsp.Error:
+		return "error"
+	case lsp.Warning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func writeCheckSARIF(w io.Writer, results []checkFile) error {
+	rules := []sarifRule{
+		{
+			ID:                   parseErrorCode,
+			ShortDescription:     sarifMessage{Text: "the schema could not be parsed or validated"},
+			DefaultConfiguration: sarifConfiguration{Level: "error"},
+		},
+	}
+	for _, rule := range lintRules {
+		rules = append(rules, sarifRule{
+			ID:                   rule.name,
+			ShortDescription:     sarifMessage{Text: rule.description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.severity)},
+		})
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           binaryName,
+			Version:        version,
+			InformationURI: "https://github.com/kwilteam/kuneiform-ls",
+			Rules:          rules,
+		}},
+		Results: make([]sarifResult, 0),
+	}
+
+	for _, res := range results {
+		for _, d := range res.diagnostics {
+			region := sarifRegion{
+				StartLine:   d.Range.Start.Line + 1,
+				StartColumn: d.Range.Start.Character + 1,
+				EndLine:     d.Range.End.Line + 1,
+				EndColumn:   d.Range.End.Character + 1,
+			}
+			if region.EndLine < region.StartLine || (region.EndLine == region.StartLine && region.EndColumn < region.StartColumn) {
+				region.EndLine, region.EndColumn = region.StartLine, region.StartColumn
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  diagnosticCode(d),
+				Level:   sarifLevel(d.Severity),
+				Message: sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(res.path)},
+					Region:           region,
+				}}},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+// JUnit XML: one test case per file, failing if the file has errors.
+// Warnings are listed in the test case output.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeCheckJUnit(w io.Writer, results []checkFile) error {
+	suite := junitTestSuite{Name: binaryName + " check", Tests: len(results)}
+	for _, res := range results {
+		tc := junitTestCase{Name: res.path, Classname: "kuneiform"}
+
+		var errs, others []string
+		for _, d := range res.diagnostics {
+			line := fmt.Sprintf("%s:%d:%d: %s: %s", res.path, d.Range.Start.Line+1, d.Range.Start.Character+1,
+				severityName(d.Severity), d.Message)
+			if d.Severity == lsp.Error {
+				errs = append(errs, line)
+			} else {
+				others = append(others, line)
+			}
+		}
+
+		if len(errs) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d error(s)", len(errs)),
+				Type:    "error",
+				Text:    strings.Join(errs, "\n"),
+			}
+		}
+		tc.SystemOut = strings.Join(others, "\n")
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err := enc.Encode(junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
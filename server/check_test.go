@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const checkTestSchema = `database glow;
+
+table users {
+    id uuid primary key,
+    name text
+}
+
+action rename_all($name, $unused) public {
+    UPDATE users SET name = $name;
+}
+`
+
+func writeCheckTestFiles(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ok.kf"), []byte(checkTestSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.kf"), []byte("database x;\ntable t {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_CheckJSON(t *testing.T) {
+	dir := writeCheckTestFiles(t)
+
+	var out bytes.Buffer
+	err := runCheck([]string{"-format", "json", dir}, &out)
+
+	var code exitCode
+	if !errors.As(err, &code) || code != 1 {
+		t.Fatalf("expected exit code 1, got %v", err)
+	}
+
+	var report checkJSONReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, out.String())
+	}
+	if len(report.Files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(report.Files))
+	}
+	if report.Errors != 1 || report.Warnings != 2 {
+		t.Errorf("expected 1 error and 2 warnings, got %d and %d", report.Errors, report.Warnings)
+	}
+
+	codes := make(map[string]int)
+	for _, file := range report.Files {
+		for _, d := range file.Diagnostics {
+			codes[d.Code]++
+		}
+	}
+	if codes[parseErrorCode] != 1 || codes["unused-parameter"] != 1 || codes["update-without-where"] != 1 {
+		t.Errorf("unexpected diagnostics: %v", codes)
+	}
+}
+
+func Test_CheckMaxWarnings(t *testing.T) {
+	file := filepath.Join(writeCheckTestFiles(t), "ok.kf")
+
+	if err := runCheck([]string{"-max-warnings", "2", file}, &bytes.Buffer{}); err != nil {
+		t.Errorf("expected success with 2 warnings allowed, got %v", err)
+	}
+	if err := runCheck([]string{"-max-warnings", "1", file}, &bytes.Buffer{}); err == nil {
+		t.Error("expected failure with 1 warning allowed")
+	}
+}
+
+func Test_CheckSARIFAndJUnit(t *testing.T) {
+	dir := writeCheckTestFiles(t)
+
+	var out bytes.Buffer
+	runCheck([]string{"-format", "sarif", dir}, &out)
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("invalid sarif: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 3 {
+		t.Errorf("unexpected sarif log: %s", out.String())
+	}
+
+	out.Reset()
+	runCheck([]string{"-format", "junit", dir}, &out)
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid junit xml: %v", err)
+	}
+	if suites.Tests != 2 || suites.Failures != 1 {
+		t.Errorf("expected 2 tests and 1 failure, got %d and %d", suites.Tests, suites.Failures)
+	}
+}
+
+// compiled schemas serve as baselines without changes
+func Test_Compile(t *testing.T) {
+	dir := t.TempDir()
+	file, compiled := filepath.Join(dir, "app.kf"), filepath.Join(dir, "app.json")
+	if err := os.WriteFile(file, []byte(checkTestSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCompile([]string{"-o", compiled, file}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := readBaseline(compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := parse.ParseAndValidate([]byte(checkTestSchema))
+	if changes := diffSchemas(&parse.SchemaParseResult{Schema: base}, res); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+// the editor request replies with what compile writes
+func Test_CompiledSchemaRequest(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go acceptTCP(ctx, lis, newOutputLogger(logs))
+
+	nc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(ctx, jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}))
+	defer c.conn.Close()
+	c.open(t, "file:///glow.kf", checkTestSchema)
+
+	var reply json.RawMessage
+	params := documentParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///glow.kf"}}
+	if err := c.conn.Call(ctx, "kuneiform/compiledSchema", params, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := parse.ParseAndValidate([]byte(checkTestSchema))
+	want, err := json.Marshal(res.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != string(want) {
+		t.Errorf("expected the compiled schema\n%s\ngot\n%s", want, reply)
+	}
+}
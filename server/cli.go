@@ -0,0 +1,797 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// command is a subcommand of the server binary. Commands reuse the analysis
+// code of the language server, so they report exactly what the editor shows.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = []*command{
+	{
+		name:    "check",
+		summary: "report the diagnostics of .kf files",
+		run:     runCheck,
+	},
+	{
+		name:    "fmt",
+		summary: "format .kf files, or stdin if no files are given",
+		run:     runFmt,
+	},
+	{
+		name:    "symbols",
+		summary: "list the declarations of .kf files",
+		run:     runSymbols,
+	},
+	{
+		name:    "access",
+		summary: "list the tables and columns each action and procedure accesses",
+		run:     runAccess,
+	},
+	{
+		name:    "erd",
+		summary: "draw the tables of a .kf file as an entity-relationship diagram",
+		run:     runERD,
+	},
+	{
+		name:    "docs",
+		summary: "render the documentation of a .kf file as Markdown or HTML",
+		run:     runDocs,
+	},
+	{
+		name:    "compile",
+		summary: "print the schema of a .kf file as the JSON that is deployed",
+		run:     runCompile,
+	},
+	{
+		name:    "diff",
+		summary: "compare two versions of a .kf file and report breaking changes",
+		run:     runDiff,
+	},
+	{
+		name:    "stubs",
+		summary: "generate a Go or TypeScript client for the actions and procedures of a .kf file",
+		run:     runStubs,
+	},
+	{
+		name:    "ddl",
+		summary: "print the tables and indexes of a .kf file as PostgreSQL DDL",
+		run:     runDDL,
+	},
+	{
+		name:    "import",
+		summary: "convert PostgreSQL CREATE TABLE and CREATE INDEX statements to a .kf file",
+		run:     runImport,
+	},
+	{
+		name:    "seed",
+		summary: "generate rows for the tables of a .kf file as INSERT statements or JSON fixtures",
+		run:     runSeed,
+	},
+}
+
+// exitCode is returned by commands that fail without an error message,
+// e.g. check when it found errors.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func findCommand(name string) (*command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// runCommand runs a command and returns the process exit code.
+func runCommand(cmd *command, args []string) int {
+	err := cmd.run(args, os.Stdout)
+
+	var code exitCode
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &code):
+		return int(code)
+	default:
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", binaryName, cmd.name, err)
+		return 1
+	}
+}
+
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s\n", binaryName, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// schemaErrors is returned for a schema with errors; check reports them.
+type schemaErrors string
+
+func (file schemaErrors) Error() string {
+	return fmt.Sprintf("%s has errors, run `%s check` for details", string(file), binaryName)
+}
+
+// loadSchema reads a schema, or the database a file belongs to, and parses it
+// with the settings of its project. A schema with errors is a schemaErrors.
+func loadSchema(file string) (string, *parse.SchemaParseResult, error) {
+	text, err := readSchema(file)
+	if err != nil {
+		return "", nil, err
+	}
+	settings, err := loadFileSettings(file)
+	if err != nil {
+		return "", nil, err
+	}
+	res, err := parseSchema(file, string(text), settings)
+	return string(text), res, err
+}
+
+// parseSchema parses the text of a schema read from file.
+func parseSchema(file, text string, settings serverSettings) (*parse.SchemaParseResult, error) {
+	res, _ := analyzeKfDocument(text, settings)
+	if res == nil || res.Err() != nil {
+		return nil, schemaErrors(file)
+	}
+	return res, nil
+}
+
+func runFmt(args []string, stdout io.Writer) error {
+	fs := newFlagSet("fmt", "fmt [flags] [files or dirs]")
+	write := fs.Bool("w", false, "write the result to the source file instead of stdout")
+	list := fs.Bool("l", false, "list files whose formatting differs")
+	indent := fs.Int("indent", defaultFormatOptions.indentSize, "number of columns per indentation level")
+	tabs := fs.Bool("tabs", false, "indent with tabs")
+	keywordCase := fs.String("keyword-case", "preserve", "case of keywords: lower, upper or preserve")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// flags override the project settings
+	options := func(dir string) (formatOptions, error) {
+		settings, err := loadDirSettings(dir)
+		if err != nil {
+			return formatOptions{}, err
+		}
+		opts := settings.formatOptions(defaultFormatOptions.indentSize, true)
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "indent":
+				opts.indentSize = *indent
+			case "tabs":
+				opts.useTabs = *tabs
+			case "keyword-case":
+				opts.keywordCase = *keywordCase
+			}
+		})
+		return opts, nil
+	}
+
+	if fs.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		opts, err := options(".")
+		if err != nil {
+			return err
+		}
+		formatted, err := formatKf(string(src), opts)
+		if err != nil {
+			return fmt.Errorf("<stdin>:%w", err)
+		}
+		_, err = io.WriteString(stdout, formatted)
+		return err
+	}
+
+	files, err := collectKfFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		opts, err := options(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		formatted, err := formatKf(string(src), opts)
+		if err != nil {
+			return fmt.Errorf("%s:%w", file, err)
+		}
+
+		changed := !bytes.Equal(src, []byte(formatted))
+		if *list && changed {
+			fmt.Fprintln(stdout, file)
+		}
+		if *write && changed {
+			info, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(file, []byte(formatted), info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if !*list && !*write {
+			io.WriteString(stdout, formatted)
+		}
+	}
+	return nil
+}
+
+type symbolOutput struct {
+	File      string `json:"file"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Container string `json:"container,omitempty"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+}
+
+func runSymbols(args []string, stdout io.Writer) error {
+	fs := newFlagSet("symbols", "symbols [flags] <files or dirs>")
+	asJSON := fs.Bool("json", false, "print the symbols as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files, err := collectKfFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	symbols := make([]symbolOutput, 0)
+	for _, file := range files {
+		src, err := readDatabaseSource(file)
+		if err != nil {
+			return err
+		}
+		text, res, err := loadSchema(file)
+		var invalid schemaErrors
+		if errors.As(err, &invalid) {
+			fmt.Fprintf(os.Stderr, "%s: skipping file with errors, run `%s check` for details\n", file, binaryName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		uri := fileURI(file)
+		fileSymbols := getDocumentSymbols(uri, text, res)
+		if src != nil {
+			// only the symbols of the file of a database split across files
+			fileSymbols = src.fileSymbols(uri, fileSymbols)
+		}
+		for _, s := range fileSymbols {
+			symbols = append(symbols, symbolOutput{
+				File:      file,
+				Name:      s.Name,
+				Kind:      symbolKindNames[s.Kind],
+				Container: s.ContainerName,
+				Line:      s.Location.Range.Start.Line + 1,
+				Column:    s.Location.Range.Start.Character + 1,
+			})
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(symbols)
+	}
+
+	for _, s := range symbols {
+		name := s.Name
+		if s.Kind == "column" {
+			name = s.Container + "." + s.Name
+		}
+		fmt.Fprintf(stdout, "%s:%d:%d: %s %s\n", s.File, s.Line, s.Column, s.Kind, name)
+	}
+	return nil
+}
+
+type accessOutput struct {
+	File    string             `json:"file"`
+	Methods []methodDataAccess `json:"methods"`
+}
+
+func runAccess(args []string, stdout io.Writer) error {
+	fs := newFlagSet("access", "access [flags] <files or dirs>")
+	asJSON := fs.Bool("json", false, "print the accesses as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files, err := collectKfFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	outputs := make([]accessOutput, 0)
+	for _, file := range files {
+		src, err := readDatabaseSource(file)
+		if err != nil {
+			return err
+		}
+		_, res, err := loadSchema(file)
+		var invalid schemaErrors
+		if errors.As(err, &invalid) {
+			fmt.Fprintf(os.Stderr, "%s: skipping file with errors, run `%s check` for details\n", file, binaryName)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		methods := getDataAccess(res)
+		if src != nil {
+			// only the methods declared in the file of a database split
+			// across files
+			methods = slices.DeleteFunc(methods, func(m methodDataAccess) bool {
+				return !src.declaredIn(res, m.Name, fileURI(file))
+			})
+		}
+		outputs = append(outputs, accessOutput{File: file, Methods: methods})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(outputs)
+	}
+
+	for _, out := range outputs {
+		for _, m := range out.Methods {
+			fmt.Fprintf(stdout, "%s: %s %s", out.File, m.Kind, m.Name)
+			if len(m.Calls) > 0 {
+				fmt.Fprintf(stdout, " (calls %s)", strings.Join(m.Calls, ", "))
+			}
+			fmt.Fprintln(stdout)
+			for _, t := range m.Tables {
+				var ops []string
+				for _, op := range t.Operations {
+					if cols := t.Columns[op]; len(cols) > 0 {
+						op += " " + strings.Join(cols, ", ")
+					}
+					ops = append(ops, op)
+				}
+				fmt.Fprintf(stdout, "    %s: %s\n", t.Table, strings.Join(ops, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+func runERD(args []string, stdout io.Writer) error {
+	fs := newFlagSet("erd", "erd [flags] <file>")
+	format := fs.String("format", "mermaid", "diagram format: "+strings.Join(erdFormats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	_, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	diagram, err := renderERD(res.Schema, *format)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, diagram)
+	return err
+}
+
+func runDDL(args []string, stdout io.Writer) error {
+	fs := newFlagSet("ddl", "ddl [flags] <file>")
+	pgSchema := fs.String("schema", "", "qualify names with this PostgreSQL schema")
+	output := fs.String("o", "", "write to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	_, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	ddl, err := renderDDL(res.Schema, *pgSchema)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(ddl), 0644)
+	}
+	_, err = io.WriteString(stdout, ddl)
+	return err
+}
+
+// runImport converts a DDL file to a schema. The problems are printed to
+// stderr; it exits with status 1 if the generated schema has errors.
+func runImport(args []string, stdout io.Writer) error {
+	fs := newFlagSet("import", "import [flags] <file.sql>")
+	database := fs.String("database", "", "the database name, by default the file name")
+	output := fs.String("o", "", "write to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := *database
+	if name == "" {
+		name = databaseName(file)
+	}
+
+	kf, problems := importDDL(string(text), filepath.Base(file), name)
+	invalid := false
+	for _, p := range problems {
+		invalid = invalid || p.invalid
+		if p.line == 0 {
+			fmt.Fprintf(os.Stderr, "%s\n", p)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", file, p.line, p.message)
+	}
+
+	if *output != "" {
+		err = os.WriteFile(*output, []byte(kf), 0644)
+	} else {
+		_, err = io.WriteString(stdout, kf)
+	}
+	if err == nil && invalid {
+		return exitCode(1)
+	}
+	return err
+}
+
+// databaseName derives a database name from a file name.
+func databaseName(file string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	name := []byte(strings.ToLower(base))
+	for i, ch := range name {
+		if !isIdentChar(ch) {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || !isIdentStart(name[0]) {
+		return "db_" + string(name)
+	}
+	return string(name)
+}
+
+func runSeed(args []string, stdout io.Writer) error {
+	fs := newFlagSet("seed", "seed [flags] <file>")
+	rows := fs.Int("rows", 10, "the number of rows per table")
+	seed := fs.Uint64("seed", 1, "the seed of the generated values; the same seed gives the same rows")
+	format := fs.String("format", "sql", "output format: "+strings.Join(seedFormats, ", "))
+	pgSchema := fs.String("schema", "", "qualify table names with this PostgreSQL schema")
+	output := fs.String("o", "", "write to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+	if *rows < 1 {
+		return errors.New("-rows must be at least 1")
+	}
+
+	file := fs.Arg(0)
+	_, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	opts := seedOptions{rows: *rows, seed: *seed}
+	tables, err := generateSeed(res.Schema, opts)
+	if err != nil {
+		return err
+	}
+	out, err := renderSeed(res.Schema.Name, tables, *format, *pgSchema, opts)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(out), 0644)
+	}
+	_, err = io.WriteString(stdout, out)
+	return err
+}
+
+func runDocs(args []string, stdout io.Writer) error {
+	fs := newFlagSet("docs", "docs [flags] <file>")
+	format := fs.String("format", "markdown", "output format: "+strings.Join(docsFormats, ", "))
+	output := fs.String("o", "", "write to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	text, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	docs, err := renderDocs(buildSchemaDocs(text, res), *format)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(docs), 0644)
+	}
+	_, err = io.WriteString(stdout, docs)
+	return err
+}
+
+func runCompile(args []string, stdout io.Writer) error {
+	fs := newFlagSet("compile", "compile [flags] <file>")
+	output := fs.String("o", "", "write to a file instead of stdout")
+	compact := fs.Bool("compact", false, "print the JSON on one line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	_, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	var compiled []byte
+	if *compact {
+		compiled, err = json.Marshal(res.Schema)
+	} else {
+		compiled, err = json.MarshalIndent(res.Schema, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	compiled = append(compiled, '\n')
+	if *output != "" {
+		return os.WriteFile(*output, compiled, 0644)
+	}
+	_, err = stdout.Write(compiled)
+	return err
+}
+
+// runStubs generates a client for the public actions and procedures of a
+// schema.
+func runStubs(args []string, stdout io.Writer) error {
+	fs := newFlagSet("stubs", "stubs [flags] <file>")
+	lang := fs.String("lang", "go", "the language of the client: "+strings.Join(stubLanguages, ", "))
+	pkg := fs.String("package", "", "the Go package name, by default the database name")
+	output := fs.String("o", "", "write to a file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one file")
+	}
+
+	file := fs.Arg(0)
+	text, res, err := loadSchema(file)
+	if err != nil {
+		return err
+	}
+
+	code, err := generateStubs(filepath.Base(file), text, res, *lang, *pkg)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, []byte(code), 0644)
+	}
+	_, err = io.WriteString(stdout, code)
+	return err
+}
+
+// runDiff compares two schemas. It exits with status 1 if there are
+// breaking changes. A file of - is read from stdin, e.g. for
+// `git show HEAD:app.kf | kuneiform-lsp diff - app.kf`.
+func runDiff(args []string, stdout io.Writer) error {
+	fs := newFlagSet("diff", "diff [flags] <old file> <new file>")
+	asJSON := fs.Bool("json", false, "print the changes as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two files")
+	}
+
+	var results []*parse.SchemaParseResult
+	for i, file := range fs.Args() {
+		var res *parse.SchemaParseResult
+		var err error
+		if file == "-" {
+			res, err = parseStdin(fs.Arg(1 - i))
+		} else {
+			_, res, err = loadSchema(file)
+		}
+		if err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+
+	changes := diffSchemas(results[0], results[1])
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Fprintln(stdout, c)
+		}
+	}
+
+	if hasBreakingChanges(changes) {
+		return exitCode(1)
+	}
+	return nil
+}
+
+// parseStdin parses a schema read from stdin, another version of file, with
+// the settings of file. If file is part of a database split across files,
+// the text replaces it in the database.
+func parseStdin(file string) (*parse.SchemaParseResult, error) {
+	text, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := loadFileSettings(file)
+	if err != nil {
+		return nil, err
+	}
+	src, err := readDatabaseSource(file)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		text = []byte(src.withText(fileURI(abs), string(text)).text)
+	}
+	return parseSchema("-", string(text), settings)
+}
+
+// collectKfFiles expands the given paths into a sorted list of .kf files.
+// Directories are searched recursively, skipping hidden directories.
+func collectKfFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no files or directories given")
+	}
+
+	seen := make(map[string]struct{})
+	var files []string
+	add := func(file string) {
+		if _, ok := seen[file]; !ok {
+			seen[file] = struct{}{}
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".kf" {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// fileURI returns the file:// URI of a path, as an editor would send it.
+func fileURI(path string) lsp.DocumentURI {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		abs = "/" + abs // windows drive letters
+	}
+	return lsp.DocumentURI((&url.URL{Scheme: "file", Path: abs}).String())
+}
+
+func severityName(s lsp.DiagnosticSeverity) string {
+	switch s {
+	case lsp.Error:
+		return "error"
+	case lsp.Warning:
+		return "warning"
+	case lsp.Information:
+		return "info"
+	case lsp.Hint:
+		return "hint"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Code actions that generate files next to the schema: the Go and
+// TypeScript clients of its actions and procedures. Editors ask for code
+// actions on most cursor moves, so the actions only name the file, and the
+// client is generated when one is picked, with codeAction/resolve.
+
+var stubActionLanguages = []struct{ lang, title string }{{"go", "Go"}, {"typescript", "TypeScript"}}
+
+func (l *lspHandler) handleCodeAction(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.CodeActionParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling code action params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	conn.Reply(ctx, req.ID, getCodeActions(params.TextDocument.URI, l.databaseName(params.TextDocument.URI, doc)))
+}
+
+func (l *lspHandler) handleCodeActionResolve(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	action := codeAction{}
+	err := json.Unmarshal(*req.Params, &action)
+	if err != nil {
+		l.logger.Error("error unmarshalling code action", slog.String("err", err.Error()))
+		return
+	}
+	if action.Data == nil {
+		conn.Reply(ctx, req.ID, action)
+		return
+	}
+
+	docID := string(action.Data.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	text, res := doc.rawKf, doc.currentParse()
+	if src, merged := l.databaseParse(action.Data.URI); src != nil {
+		text, res = src.text, merged
+	}
+	if err := resolveCodeAction(&action, text, res); err != nil {
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()})
+		return
+	}
+	conn.Reply(ctx, req.ID, action)
+}
+
+// databaseName returns the name of the database of a document without
+// parsing it: the name in its manifest, or else the name its last valid
+// parse declares if that is of the current text. It is empty if neither is
+// known.
+func (l *lspHandler) databaseName(uri lsp.DocumentURI, doc *kfDocs) string {
+	if path, ok := uriPath(uri); ok {
+		if _, _, db, err := lookupDatabase(path); err == nil && db != nil {
+			return db.Name
+		}
+	}
+	if res := doc.parsedSchema; res != nil && res.Schema != nil && doc.parsedKf == doc.rawKf && res.Err() == nil {
+		return res.Schema.Name
+	}
+	return ""
+}
+
+// getCodeActions returns the actions for a document of the named database,
+// none if the name isn't known or the document is not a file. Their edits
+// are left to resolveCodeAction.
+func getCodeActions(uri lsp.DocumentURI, database string) []codeAction {
+	actions := make([]codeAction, 0)
+	if _, ok := uriPath(uri); !ok || database == "" {
+		return actions
+	}
+
+	for _, lang := range stubActionLanguages {
+		actions = append(actions, codeAction{
+			Title: fmt.Sprintf("Generate %s client (%s)", lang.title, stubFileName(database, lang.lang)),
+			Kind:  lsp.CAKSource,
+			Data:  &codeActionData{URI: uri, Language: lang.lang},
+		})
+	}
+	return actions
+}
+
+// resolveCodeAction generates the client of an action for the schema parsed
+// from text.
+func resolveCodeAction(action *codeAction, text string, r *parse.SchemaParseResult) error {
+	path, ok := uriPath(action.Data.URI)
+	if !ok {
+		return fmt.Errorf("%s is not a file", action.Data.URI)
+	}
+	if r == nil || r.Schema == nil || r.Err() != nil {
+		return fmt.Errorf("%s has errors", action.Data.URI)
+	}
+
+	code, err := generateStubs(filepath.Base(path), text, r, action.Data.Language, "")
+	if err != nil {
+		return err
+	}
+	target := fileURI(filepath.Join(filepath.Dir(path), stubFileName(r.Schema.Name, action.Data.Language)))
+
+	create := createFile{Kind: "create", URI: target}
+	create.Options.Overwrite = true
+	edit := textDocumentEdit{Edits: []lsp.TextEdit{{NewText: code}}}
+	edit.TextDocument.URI = target
+
+	action.Edit = &workspaceEdit{DocumentChanges: []any{create, edit}}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Commands run with workspace/executeCommand. Their first argument is the URI
+// of an open document; the editor shows what they return.
+
+const (
+	erdCommand = "kuneiform.erd"
+	ddlCommand = "kuneiform.ddl"
+)
+
+// executeCommands are advertised in the server capabilities.
+var executeCommands = []string{erdCommand, ddlCommand}
+
+type executeCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments"`
+}
+
+func (l *lspHandler) handleExecuteCommand(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := executeCommandParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling execute command params", slog.String("err", err.Error()))
+		return
+	}
+
+	res, err := l.executeCommand(params)
+	if err != nil {
+		l.logger.Debug("command failed", slog.String("command", params.Command), slog.String("err", err.Error()))
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()})
+		return
+	}
+	conn.Reply(ctx, req.ID, res)
+}
+
+func (l *lspHandler) executeCommand(params executeCommandParams) (any, error) {
+	var uri lsp.DocumentURI
+	if len(params.Arguments) == 0 || json.Unmarshal(params.Arguments[0], &uri) != nil {
+		return nil, fmt.Errorf("%s: expected a document URI as the first argument", params.Command)
+	}
+	doc, ok := l.docs[string(uri)]
+	if !ok {
+		return nil, fmt.Errorf("%s: document %s is not open", params.Command, uri)
+	}
+
+	switch params.Command {
+	case erdCommand:
+		// arguments: uri, and optionally the format
+		format := "mermaid"
+		if len(params.Arguments) > 1 {
+			if err := json.Unmarshal(params.Arguments[1], &format); err != nil {
+				return nil, fmt.Errorf("%s: expected a format as the second argument", params.Command)
+			}
+		}
+		res := l.documentSchema(uri, doc)
+		if res == nil || res.Schema == nil || res.Err() != nil {
+			return nil, fmt.Errorf("%s: %s has errors", params.Command, uri)
+		}
+		return renderERD(res.Schema, format)
+	case ddlCommand:
+		// arguments: uri, and optionally the PostgreSQL schema
+		var pgSchema string
+		if len(params.Arguments) > 1 {
+			if err := json.Unmarshal(params.Arguments[1], &pgSchema); err != nil {
+				return nil, fmt.Errorf("%s: expected a schema name as the second argument", params.Command)
+			}
+		}
+		res := l.documentSchema(uri, doc)
+		if res == nil || res.Schema == nil || res.Err() != nil {
+			return nil, fmt.Errorf("%s: %s has errors", params.Command, uri)
+		}
+		return renderDDL(res.Schema, pgSchema)
+	default:
+		return nil, fmt.Errorf("unknown command %q", params.Command)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Compatibility checks compare a document with the baseline of its
+// database, usually the version deployed to a network, and report the
+// breaking changes of the schema diff as diagnostics. Baselines are .kf
+// files or schemas compiled to JSON, listed in the compatibility settings.
+
+const compatSource = "kuneiform-compat"
+
+func checkCompatibility(text string, r *parse.SchemaParseResult, settings serverSettings) []lsp.Diagnostic {
+	diagnostics := make([]lsp.Diagnostic, 0)
+	if len(settings.Compatibility.Baselines) == 0 || r == nil || r.Schema == nil || r.SchemaInfo == nil || r.Err() != nil {
+		return diagnostics
+	}
+	severity, off, err := parseLintSeverity(settings.Compatibility.Severity)
+	if off {
+		return diagnostics
+	}
+	if err != nil {
+		severity = lsp.Error
+	}
+
+	toks := lexKf(text)
+	for _, path := range settings.Compatibility.Baselines {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(settings.baseDir, path)
+		}
+		base, err := baselines.load(path)
+		if err != nil {
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:    databaseNameRange(toks),
+				Severity: lsp.Warning,
+				Source:   compatSource,
+				Message:  fmt.Sprintf("baseline %s: %v", path, err),
+			})
+			continue
+		}
+		if !strings.EqualFold(base.Name, r.Schema.Name) {
+			continue
+		}
+
+		for _, c := range diffSchemas(&parse.SchemaParseResult{Schema: base}, r) {
+			if !c.Breaking {
+				continue
+			}
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:    changeRange(toks, r, c),
+				Severity: severity,
+				Code:     "breaking-change",
+				Source:   compatSource,
+				Message:  fmt.Sprintf("%s %s %s since %s: %s", c.Kind, c.Name, c.Change, filepath.Base(path), c.Reason),
+			})
+		}
+	}
+	return diagnostics
+}
+
+// changeRange locates a change in the new version of a schema: at the
+// column or declaration it affects, or at the database name for removed
+// declarations.
+func changeRange(toks []token, r *parse.SchemaParseResult, c schemaChange) lsp.Range {
+	decl, member, _ := strings.Cut(c.Name, ".")
+	block, ok := r.SchemaInfo.Blocks[normalizeIdent(decl)]
+	if !ok || (c.Change == changeRemoved && member == "") {
+		return databaseNameRange(toks)
+	}
+
+	if c.Kind == "column" && c.Change != changeRemoved {
+		defs := columnDefinitions(toks, r)
+		for _, tok := range toks {
+			if tok.offset >= block.AbsStart && tok.offset <= block.AbsEnd && defs[tokenKey{tok.line, tok.col}] && tok.is(member) {
+				return tokenRange(tok)
+			}
+		}
+	}
+	if tok, ok := declaredName(toks, block, decl); ok {
+		return tokenRange(tok)
+	}
+	return databaseNameRange(toks)
+}
+
+// databaseNameRange returns the range of the name in the database
+// declaration.
+func databaseNameRange(toks []token) lsp.Range {
+	for i, tok := range toks {
+		if tok.is("database") && i+1 < len(toks) {
+			return tokenRange(toks[i+1])
+		}
+	}
+	return lsp.Range{}
+}
+
+var baselines = newFileCache(readBaseline)
+
+// readBaseline reads a schema compiled to JSON, or a .kf file.
+func readBaseline(path string) (*types.Schema, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var schema types.Schema
+		if err := json.Unmarshal(text, &schema); err != nil {
+			return nil, err
+		}
+		if schema.Name == "" {
+			return nil, errors.New("not a compiled schema")
+		}
+		return &schema, nil
+	}
+
+	res, err := parse.ParseAndValidate(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.Err(); err != nil {
+		return nil, fmt.Errorf("schema has errors: %w", err)
+	}
+	return res.Schema, nil
+}
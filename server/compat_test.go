@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_Compatibility(t *testing.T) {
+	deployed := `database glow;
+
+table users {
+    id int primary key,
+    name text,
+    bio text
+}
+
+action get_user($id) public view {
+    SELECT * FROM users WHERE id = $id;
+}
+
+action ping() public view {
+    SELECT 1;
+}
+`
+	edited := `database glow;
+
+table users {
+    id int primary key,
+    name text notnull
+}
+
+action get_user($id, $verbose) public view {
+    SELECT * FROM users WHERE id = $id AND $verbose;
+}
+`
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, lsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "deployed.kf"), []byte(deployed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := parse.ParseAndValidate([]byte(deployed))
+	compiled, err := json.Marshal(res.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "deployed.json"), compiled, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"2:6 column users.bio removed since %s: its data is dropped",
+		"4:4 column users.name changed since %s: constraint notnull added",
+		"0:9 action ping removed since %s: clients can no longer call it",
+		"7:7 action get_user changed since %s: its parameters changed",
+	}
+	for i, baseline := range []string{"deployed.kf", "deployed.json"} {
+		config := `{"compatibility": {"baselines": ["` + baseline + `", "other.kf"], "severity": "warning"}}`
+		configPath := filepath.Join(root, lsDir, projectConfigFile)
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// settings are cached by modification time, which may be too coarse
+		// to tell the rewrites apart
+		modTime := time.Now().Add(time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(configPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		settings, err := loadDirSettings(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, diagnostics := analyzeKfDocument(edited, settings)
+		var got []string
+		for _, d := range diagnostics {
+			if d.Source != compatSource {
+				continue
+			}
+			if d.Severity == lsp.Warning && strings.Contains(d.Message, "other.kf") {
+				continue // missing baseline
+			}
+			got = append(got, fmt.Sprintf("%d:%d %s", d.Range.Start.Line, d.Range.Start.Character, d.Message))
+		}
+		var expected []string
+		for _, w := range want {
+			expected = append(expected, fmt.Sprintf(w, baseline))
+		}
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: expected\n%s\ngot\n%s", baseline, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
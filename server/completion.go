@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/kwilteam/kwil-db/parse"
 	"github.com/sourcegraph/go-lsp"
@@ -10,7 +13,15 @@ import (
 // onCompletion handler support
 
 // Defaults
-func (l *lspHandler) getCompletionItems(r *parse.SchemaParseResult, pos int) []lsp.CompletionItem {
+// text is the source r was parsed from, for the doc comments.
+func (l *lspHandler) getCompletionItems(text string, r *parse.SchemaParseResult, pos int, settings *serverSettings) []lsp.CompletionItem {
+	// the context items may be shared, so they are not appended to in place
+	items := slices.Clip(l.getContextCompletionItems(text, r, pos, settings))
+	items = append(items, snippetCompletionItems(settings.snippets, completionScope(r, pos))...)
+	return applyCompletionSettings(items, settings)
+}
+
+func (l *lspHandler) getContextCompletionItems(text string, r *parse.SchemaParseResult, pos int, settings *serverSettings) []lsp.CompletionItem {
 
 	inTable := isWithinTableBlock(r, pos)
 	inProcedures := isWithinProcedureBlock(r, pos)
@@ -18,13 +29,18 @@ func (l *lspHandler) getCompletionItems(r *parse.SchemaParseResult, pos int) []l
 	inForeginProcedures := isWithinForeignProcedureBlock(r, pos)
 	dbDefined := getDatabaseName(r) != ""
 
-	l.logger.Debug("Parse result: ", slog.Bool("dbDefined", dbDefined), slog.Bool("inTable", inTable), slog.Bool("inProcedures", inProcedures), slog.Bool("inActions", inActions), slog.Bool("inForeginProcedures", inForeginProcedures))
+	l.logger.Debug("completion context", slog.Bool("dbDefined", dbDefined), slog.Bool("inTable", inTable), slog.Bool("inProcedures", inProcedures), slog.Bool("inActions", inActions), slog.Bool("inForeginProcedures", inForeginProcedures))
 
-	tables := getTableCompletionItems(r)
+	docs := collectDocComments(text, r)
+	tables := getTableCompletionItems(r, docs)
 	params := getParamsCompletionItems(r, pos)
-	procedures := getProcedureCompletionItems(r, pos)
-	actions := getActionCompletionItems(r, pos)
+	procedures := getProcedureCompletionItems(r, pos, docs)
+	actions := getActionCompletionItems(r, pos, docs)
 	extensions := getExtensionsCompletionItems(r)
+	methods := controlFlowCompletionItems
+	if settings.Completion.SQL {
+		methods = methodCompletionItems
+	}
 
 	var items []lsp.CompletionItem
 
@@ -44,18 +60,19 @@ func (l *lspHandler) getCompletionItems(r *parse.SchemaParseResult, pos int) []l
 	} else if inProcedures {
 		items = append(procedures, params...)             // procedures and params
 		items = append(items, tables...)                  // tables
-		items = append(items, methodCompletionItems...)   // methods
+		items = append(items, methods...)                 // methods
 		items = append(items, datatypeCompletionItems...) // datatypes
 		return append(items, modifierCompletionItems...)  // modifiers
 
 	} else if inActions {
-		items = append(actions, procedures...)            // actions and procedures
-		items = append(items, extensions...)              // extensions
-		items = append(items, params...)                  // params
-		items = append(items, tables...)                  // tables
-		items = append(items, methodCompletionItems...)   // methods
-		items = append(items, datatypeCompletionItems...) // datatypes
-		return append(items, modifierCompletionItems...)  // modifiers
+		items = append(actions, procedures...)                                              // actions and procedures
+		items = append(items, extensions...)                                                // extensions
+		items = append(items, getExtensionMethodCompletionItems(r, settings.Extensions)...) // extension methods
+		items = append(items, params...)                                                    // params
+		items = append(items, tables...)                                                    // tables
+		items = append(items, methods...)                                                   // methods
+		items = append(items, datatypeCompletionItems...)                                   // datatypes
+		return append(items, modifierCompletionItems...)                                    // modifiers
 
 	} else if inForeginProcedures {
 		items := append(params, datatypeCompletionItems...) // datatypes, params
@@ -65,45 +82,53 @@ func (l *lspHandler) getCompletionItems(r *parse.SchemaParseResult, pos int) []l
 	return items
 }
 
-func getTableCompletionItems(r *parse.SchemaParseResult) []lsp.CompletionItem {
-	return getDefaultCompletionItems(getTables(r))
+func getTableCompletionItems(r *parse.SchemaParseResult, docs declarationDocs) []lsp.CompletionItem {
+	items := getDefaultCompletionItems(getTables(r))
+	for i := range items {
+		items[i].Documentation = docs.of(items[i].Label).plainText(nil)
+	}
+	return items
 }
 
-func getActionCompletionItems(r *parse.SchemaParseResult, pos int) []lsp.CompletionItem {
+func getActionCompletionItems(r *parse.SchemaParseResult, pos int, docs declarationDocs) []lsp.CompletionItem {
 	items := []lsp.CompletionItem{}
 
 	// Actions can only be called within an action block
 	if isWithinActionBlock(r, pos) {
 		actions := getActions(r)
 		for _, action := range actions {
-			items = append(items, lsp.CompletionItem{
-				Label:            action,
-				Kind:             lsp.CIKFunction,
-				InsertText:       action + "(${1:params});",
-				InsertTextFormat: lsp.ITFSnippet,
-			})
+			items = append(items, methodCompletionItem(r, action, docs))
 		}
 	}
 	return items
 }
 
-func getProcedureCompletionItems(r *parse.SchemaParseResult, pos int) []lsp.CompletionItem {
+func getProcedureCompletionItems(r *parse.SchemaParseResult, pos int, docs declarationDocs) []lsp.CompletionItem {
 	// Procedures can be called either from procedure block or action block
 	items := []lsp.CompletionItem{}
 	if isWithinProcedureBlock(r, pos) || isWithinActionBlock(r, pos) {
 		procedures := getProcedures(r)
 		for _, procedure := range procedures {
-			items = append(items, lsp.CompletionItem{
-				Label:            procedure,
-				Kind:             lsp.CIKFunction,
-				InsertText:       procedure + "(${1:params});",
-				InsertTextFormat: lsp.ITFSnippet,
-			})
+			items = append(items, methodCompletionItem(r, procedure, docs))
 		}
 	}
 	return items
 }
 
+// methodCompletionItem completes a call of an action or procedure, showing
+// its signature and doc comment.
+func methodCompletionItem(r *parse.SchemaParseResult, name string, docs declarationDocs) lsp.CompletionItem {
+	signature, params, _, _ := methodSignature(r, name)
+	return lsp.CompletionItem{
+		Label:            name,
+		Kind:             lsp.CIKFunction,
+		Detail:           signature,
+		Documentation:    docs.of(name).plainText(params),
+		InsertText:       name + "(${1:params});",
+		InsertTextFormat: lsp.ITFSnippet,
+	}
+}
+
 func getExtensionsCompletionItems(r *parse.SchemaParseResult) []lsp.CompletionItem {
 	aliases := getExtensions(r)
 	var items []lsp.CompletionItem
@@ -118,6 +143,116 @@ func getExtensionsCompletionItems(r *parse.SchemaParseResult) []lsp.CompletionIt
 	return items
 }
 
+// getExtensionMethodCompletionItems offers the methods of extensions used by
+// the schema, as listed in the extension catalogs of the settings.
+func getExtensionMethodCompletionItems(r *parse.SchemaParseResult, catalogs []extensionCatalog) []lsp.CompletionItem {
+	var items []lsp.CompletionItem
+	if r == nil || r.Schema == nil {
+		return items
+	}
+
+	for _, ext := range r.Schema.Extensions {
+		for _, catalog := range catalogs {
+			if !strings.EqualFold(catalog.Name, ext.Name) {
+				continue
+			}
+
+			for _, method := range catalog.Methods {
+				placeholders := make([]string, len(method.Parameters))
+				for i, param := range method.Parameters {
+					placeholders[i] = fmt.Sprintf("${%d:%s}", i+1, param)
+				}
+
+				detail := fmt.Sprintf("%s.%s(%s)", ext.Name, method.Name, strings.Join(method.Parameters, ", "))
+				if len(method.Returns) > 0 {
+					detail += " returns (" + strings.Join(method.Returns, ", ") + ")"
+				}
+
+				items = append(items, lsp.CompletionItem{
+					Label:            ext.Alias + "." + method.Name,
+					Kind:             lsp.CIKMethod,
+					Detail:           detail,
+					Documentation:    method.Description,
+					InsertText:       ext.Alias + "." + method.Name + "(" + strings.Join(placeholders, ", ") + ")",
+					InsertTextFormat: lsp.ITFSnippet,
+				})
+			}
+		}
+	}
+	return items
+}
+
+// applyCompletionSettings returns copies of the items with keywords in the
+// configured case, and without snippet placeholders if snippets are off.
+func applyCompletionSettings(items []lsp.CompletionItem, settings *serverSettings) []lsp.CompletionItem {
+	res := make([]lsp.CompletionItem, 0, len(items))
+	for _, item := range items {
+		if item.Kind == lsp.CIKKeyword && isKeywordPhrase(item.Label) {
+			switch settings.KeywordCase {
+			case "upper":
+				item.Label, item.InsertText = strings.ToUpper(item.Label), strings.ToUpper(item.InsertText)
+			case "lower":
+				item.Label, item.InsertText = strings.ToLower(item.Label), strings.ToLower(item.InsertText)
+			}
+		}
+
+		if !settings.Completion.Snippets && item.InsertTextFormat == lsp.ITFSnippet {
+			item.InsertText = snippetPlainText(item.InsertText)
+			item.InsertTextFormat = lsp.ITFPlainText
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+// isKeywordPhrase reports whether every word of s is a keyword.
+func isKeywordPhrase(s string) bool {
+	words := strings.Fields(s)
+	for _, word := range words {
+		if !formatKeywords[normalizeIdent(word)] {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// snippetPlainText replaces the placeholders of a snippet with their default
+// text, or the first choice, and drops tab stops.
+func snippetPlainText(snippet string) string {
+	var sb strings.Builder
+	for i := 0; i < len(snippet); i++ {
+		ch := snippet[i]
+		switch {
+		case ch == '\\' && i+1 < len(snippet):
+			i++
+			sb.WriteByte(snippet[i])
+		case ch == '$' && i+1 < len(snippet) && snippet[i+1] == '{':
+			end := strings.IndexByte(snippet[i:], '}')
+			if end < 0 {
+				sb.WriteString(snippet[i:])
+				return sb.String()
+			}
+			body := snippet[i+2 : i+end]
+			if colon := strings.IndexByte(body, ':'); colon >= 0 {
+				sb.WriteString(body[colon+1:])
+			} else if pipe := strings.IndexByte(body, '|'); pipe >= 0 {
+				choices := strings.FieldsFunc(body[pipe+1:], func(r rune) bool { return r == ',' || r == '|' })
+				if len(choices) > 0 {
+					sb.WriteString(choices[0])
+				}
+			}
+			i += end
+		case ch == '$' && i+1 < len(snippet) && isDigit(snippet[i+1]):
+			for i+1 < len(snippet) && isDigit(snippet[i+1]) {
+				i++
+			}
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
 func getParamsCompletionItems(r *parse.SchemaParseResult, pos int) []lsp.CompletionItem {
 	items := []lsp.CompletionItem{}
 	actionLocs := getActionLocations(r)
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Data access: the tables and columns every action and procedure reads,
+// inserts, updates and deletes, including through the actions and procedures
+// it calls. Columns are resolved against the tables named in each statement;
+// a column that could belong to more than one of them is attributed to the
+// first.
+
+const (
+	accessRead   = "read"
+	accessInsert = "insert"
+	accessUpdate = "update"
+	accessDelete = "delete"
+)
+
+// accessOperations is the order operations are reported in.
+var accessOperations = []string{accessRead, accessInsert, accessUpdate, accessDelete}
+
+type methodDataAccess struct {
+	Name string `json:"name"`
+	// Kind is action or procedure.
+	Kind string `json:"kind"`
+	// Calls are the actions and procedures called directly or indirectly,
+	// whose accesses are included.
+	Calls  []string     `json:"calls,omitempty"`
+	Tables []tableUsage `json:"tables"`
+}
+
+type tableUsage struct {
+	Table string `json:"table"`
+	// Operations are read, insert, update and delete, in that order.
+	Operations []string `json:"operations"`
+	// Columns lists the columns by operation. Deletes affect whole rows.
+	Columns map[string][]string `json:"columns,omitempty"`
+}
+
+// accessSet collects operations as table -> operation -> columns. An empty
+// column set records an operation on the table as a whole.
+type accessSet map[string]map[string]map[string]bool
+
+func (s accessSet) add(table, op string, columns ...string) {
+	table = strings.ToLower(table)
+	if s[table] == nil {
+		s[table] = make(map[string]map[string]bool)
+	}
+	if s[table][op] == nil {
+		s[table][op] = make(map[string]bool)
+	}
+	for _, col := range columns {
+		s[table][op][strings.ToLower(col)] = true
+	}
+}
+
+func (s accessSet) merge(other accessSet) {
+	for table, ops := range other {
+		for op, cols := range ops {
+			s.add(table, op)
+			for col := range cols {
+				s.add(table, op, col)
+			}
+		}
+	}
+}
+
+func getDataAccess(r *parse.SchemaParseResult) []methodDataAccess {
+	res := make([]methodDataAccess, 0)
+	if r == nil || r.Schema == nil {
+		return res
+	}
+
+	direct := make(map[string]accessSet)
+	for _, action := range r.Schema.Actions {
+		direct[action.Name] = make(accessSet)
+	}
+	for _, proc := range r.Schema.Procedures {
+		direct[proc.Name] = make(accessSet)
+	}
+	walkBodies(r, func(method string, n parse.Node) bool {
+		if stmt, ok := n.(*parse.SQLStatement); ok {
+			statementAccess(r.Schema, stmt, direct[method])
+			return false
+		}
+		return true
+	})
+
+	// only the callees matter, not where they are called
+	graph := buildCallGraph(nil, r)
+
+	report := func(name, kind string) {
+		access := make(accessSet)
+		var calls []string
+		seen := map[string]bool{name: true}
+		queue := []string{name}
+		for len(queue) > 0 {
+			method := queue[0]
+			queue = queue[1:]
+			access.merge(direct[method])
+			for _, call := range graph.callsFrom(method) {
+				if (call.kind != calleeAction && call.kind != calleeProcedure) || seen[call.callee] {
+					continue
+				}
+				seen[call.callee] = true
+				calls = append(calls, call.callee)
+				queue = append(queue, call.callee)
+			}
+		}
+		res = append(res, methodDataAccess{
+			Name:   name,
+			Kind:   kind,
+			Calls:  calls,
+			Tables: tableUsages(r.Schema, access),
+		})
+	}
+	for _, action := range r.Schema.Actions {
+		report(action.Name, "action")
+	}
+	for _, proc := range r.Schema.Procedures {
+		report(proc.Name, "procedure")
+	}
+	return res
+}
+
+// sqlScope holds the tables a SQL statement names, by name and alias. CTEs
+// are not tables.
+type sqlScope struct {
+	schema *types.Schema
+	names  map[string]string
+	tables []string
+}
+
+func newSQLScope(schema *types.Schema, stmt *parse.SQLStatement) *sqlScope {
+	s := &sqlScope{schema: schema, names: make(map[string]string)}
+	addTable := func(name, alias string) {
+		table, ok := schema.FindTable(name)
+		if !ok {
+			return
+		}
+		s.names[strings.ToLower(table.Name)] = table.Name
+		if alias != "" {
+			s.names[strings.ToLower(alias)] = table.Name
+		}
+		s.tables = append(s.tables, table.Name)
+	}
+	walkNode(stmt, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.RelationTable:
+			addTable(n.Table, n.Alias)
+		case *parse.InsertStatement:
+			addTable(n.Table, n.Alias)
+		case *parse.UpdateStatement:
+			addTable(n.Table, n.Alias)
+		case *parse.DeleteStatement:
+			addTable(n.Table, n.Alias)
+		}
+		return true
+	})
+	return s
+}
+
+// table returns the table a name or alias refers to, or "".
+func (s *sqlScope) table(name string) string {
+	return s.names[strings.ToLower(name)]
+}
+
+// columnTable resolves a column to a table in scope: the one qualifying it,
+// or else the first with a column of that name.
+func (s *sqlScope) columnTable(qualifier, column string) string {
+	if qualifier != "" {
+		return s.table(qualifier)
+	}
+	for _, name := range s.tables {
+		if table, ok := s.schema.FindTable(name); ok {
+			if _, ok := table.FindColumn(column); ok {
+				return table.Name
+			}
+		}
+	}
+	return ""
+}
+
+// statementAccess records the accesses of a SQL statement.
+func statementAccess(schema *types.Schema, stmt *parse.SQLStatement, access accessSet) {
+	scope := newSQLScope(schema, stmt)
+	allColumns := func(name string) []string {
+		var cols []string
+		if table, ok := schema.FindTable(name); ok {
+			for _, col := range table.Columns {
+				cols = append(cols, col.Name)
+			}
+		}
+		return cols
+	}
+
+	walkNode(stmt, func(n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.RelationTable:
+			if name := scope.table(n.Table); name != "" {
+				access.add(name, accessRead)
+			}
+		case *parse.ExpressionColumn:
+			if table := scope.columnTable(n.Table, n.Column); table != "" {
+				access.add(table, accessRead, n.Column)
+			}
+		case *parse.ResultColumnWildcard:
+			if n.Table != "" {
+				if table := scope.table(n.Table); table != "" {
+					access.add(table, accessRead, allColumns(table)...)
+				}
+				break
+			}
+			for _, table := range scope.tables {
+				access.add(table, accessRead, allColumns(table)...)
+			}
+		case *parse.InsertStatement:
+			table := scope.table(n.Table)
+			if table == "" {
+				break
+			}
+			cols := n.Columns
+			if len(cols) == 0 {
+				cols = allColumns(table)
+			}
+			access.add(table, accessInsert, cols...)
+			if n.Upsert != nil {
+				for _, set := range n.Upsert.DoUpdate {
+					access.add(table, accessUpdate, set.Column)
+				}
+			}
+		case *parse.UpdateStatement:
+			table := scope.table(n.Table)
+			if table == "" {
+				break
+			}
+			for _, set := range n.SetClause {
+				access.add(table, accessUpdate, set.Column)
+			}
+		case *parse.DeleteStatement:
+			if table := scope.table(n.Table); table != "" {
+				access.add(table, accessDelete)
+			}
+		}
+		return true
+	})
+}
+
+// tableUsages lists the accesses in the order tables and columns are
+// declared.
+func tableUsages(schema *types.Schema, access accessSet) []tableUsage {
+	usages := make([]tableUsage, 0, len(access))
+	for _, table := range schema.Tables {
+		ops, ok := access[strings.ToLower(table.Name)]
+		if !ok {
+			continue
+		}
+		usage := tableUsage{Table: table.Name, Operations: make([]string, 0)}
+		for _, op := range accessOperations {
+			cols, ok := ops[op]
+			if !ok {
+				continue
+			}
+			usage.Operations = append(usage.Operations, op)
+			for _, col := range table.Columns {
+				if cols[strings.ToLower(col.Name)] {
+					if usage.Columns == nil {
+						usage.Columns = make(map[string][]string)
+					}
+					usage.Columns[op] = append(usage.Columns[op], col.Name)
+				}
+			}
+		}
+		usages = append(usages, usage)
+	}
+	return usages
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+const dataAccessTestSchema = `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull,
+    age int
+}
+
+table posts {
+    id uuid primary key,
+    author uuid notnull,
+    body text,
+    foreign key (author) references users(id) on delete cascade
+}
+
+procedure author_name($post uuid) public view returns (name text) {
+    for $row in SELECT u.name FROM posts AS p INNER JOIN users AS u ON p.author = u.id WHERE p.id = $post {
+        return $row.name;
+    }
+}
+
+procedure upsert_user($id uuid, $name text) public {
+    INSERT INTO users (id, name) VALUES ($id, $name) ON CONFLICT (id) DO UPDATE SET name = $name;
+}
+
+procedure rename_author($post uuid, $name text) public {
+    $old := author_name($post);
+    UPDATE users SET name = $name WHERE name = $old;
+}
+
+action remove_posts($author) public {
+    DELETE FROM posts WHERE author = $author;
+}
+
+action all_users() public view {
+    SELECT * FROM users;
+}
+`
+
+func Test_DataAccess(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(dataAccessTestSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	access := make(map[string]methodDataAccess)
+	for _, m := range getDataAccess(res) {
+		access[m.Name] = m
+	}
+
+	describe := func(name string) string {
+		var parts []string
+		for _, t := range access[name].Tables {
+			for _, op := range t.Operations {
+				parts = append(parts, t.Table+" "+op+" "+strings.Join(t.Columns[op], ","))
+			}
+		}
+		return strings.Join(parts, "; ")
+	}
+
+	tests := map[string]string{
+		"author_name":   "users read id,name; posts read id,author",
+		"upsert_user":   "users insert id,name; users update name",
+		"rename_author": "users read id,name; users update name; posts read id,author",
+		"remove_posts":  "posts read author; posts delete ",
+		"all_users":     "users read id,name,age",
+	}
+	for name, want := range tests {
+		if got := describe(name); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	if calls := access["rename_author"].Calls; len(calls) != 1 || calls[0] != "author_name" {
+		t.Errorf("expected rename_author to call author_name, got %v", calls)
+	}
+}
+
+func Test_AccessCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "glow.kf")
+	if err := os.WriteFile(file, []byte(dataAccessTestSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runAccess([]string{file}, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := file + ": procedure rename_author (calls author_name)\n    users: read id, name; update name\n    posts: read id, author\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain\n%s\ngot\n%s", want, out.String())
+	}
+}
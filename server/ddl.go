@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+)
+
+// PostgreSQL DDL for the tables of a schema: CREATE TABLE statements with
+// their constraints, defaults and foreign keys, followed by CREATE INDEX
+// statements. Types are mapped the way the engine maps them. Tables are
+// created after the tables they reference; foreign keys forming a cycle are
+// added by ALTER TABLE statements once all tables exist.
+
+// uint256Domain creates the uint256 type, which is not built into
+// PostgreSQL, for replicas outside of a node.
+const uint256Domain = "CREATE DOMAIN uint256 AS NUMERIC(78) CHECK (VALUE >= 0 AND VALUE < 2^256);"
+
+// renderDDL returns the DDL of the tables of schema. Names are qualified
+// with pgSchema if it is set, as the engine does with a schema per
+// database.
+func renderDDL(schema *types.Schema, pgSchema string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Tables of the %s database, generated by %s.\n\n", schema.Name, binaryName)
+	if pgSchema != "" {
+		fmt.Fprintf(&b, "CREATE SCHEMA IF NOT EXISTS %s;\n\n", pgSchema)
+	}
+	if usesUint256(schema) {
+		b.WriteString(uint256Domain + "\n\n")
+	}
+
+	order, deferred, err := tableOrder(schema, func(*types.Table, *types.ForeignKey) bool { return true })
+	if err != nil {
+		return "", err
+	}
+	for _, table := range order {
+		stmt, err := createTableDDL(table, pgSchema, deferred)
+		if err != nil {
+			return "", fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		b.WriteString(stmt)
+		b.WriteString("\n")
+	}
+
+	var alters []string
+	for _, table := range order {
+		for _, fk := range table.ForeignKeys {
+			if deferred[fk] {
+				alters = append(alters, fmt.Sprintf("ALTER TABLE %s ADD %s;\n", qualifiedName(pgSchema, table.Name), foreignKeyDDL(fk, pgSchema)))
+			}
+		}
+	}
+	if len(alters) > 0 {
+		b.WriteString(strings.Join(alters, "") + "\n")
+	}
+
+	var indexes []string
+	for _, table := range schema.Tables {
+		for _, idx := range table.Indexes {
+			if idx.Type == types.PRIMARY {
+				continue // part of the table
+			}
+			unique := ""
+			if idx.Type == types.UNIQUE_BTREE {
+				unique = "UNIQUE "
+			}
+			indexes = append(indexes, fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);\n",
+				unique, idx.Name, qualifiedName(pgSchema, table.Name), strings.Join(idx.Columns, ", ")))
+		}
+	}
+	b.WriteString(strings.Join(indexes, ""))
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// createTableDDL returns the CREATE TABLE statement of a table, without the
+// deferred foreign keys.
+func createTableDDL(table *types.Table, pgSchema string, deferred map[*types.ForeignKey]bool) (string, error) {
+	var defs []string
+	for _, col := range table.Columns {
+		def, err := columnDDL(col)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		defs = append(defs, def)
+	}
+
+	// composite primary keys; a single column key is part of the column
+	for _, idx := range table.Indexes {
+		if idx.Type == types.PRIMARY {
+			defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(idx.Columns, ", ")))
+		}
+	}
+
+	for _, fk := range table.ForeignKeys {
+		if !deferred[fk] {
+			defs = append(defs, foreignKeyDDL(fk, pgSchema))
+		}
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n    %s\n);\n", qualifiedName(pgSchema, table.Name), strings.Join(defs, ",\n    ")), nil
+}
+
+func foreignKeyDDL(fk *types.ForeignKey, pgSchema string) string {
+	def := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+		strings.Join(fk.ChildKeys, ", "), qualifiedName(pgSchema, fk.ParentTable), strings.Join(fk.ParentKeys, ", "))
+	for _, action := range fk.Actions {
+		def += fmt.Sprintf(" ON %s %s", action.On, action.Do)
+	}
+	return def
+}
+
+func columnDDL(col *types.Column) (string, error) {
+	typ, err := col.Type.PGString()
+	if err != nil {
+		return "", err
+	}
+	if col.Type.Name == "uint256" {
+		typ = strings.ToLower(typ) // the domain
+	}
+
+	name := col.Name
+	parts := []string{name, typ}
+	for _, attr := range col.Attributes {
+		switch attr.Type {
+		case types.PRIMARY_KEY:
+			parts = append(parts, "PRIMARY KEY")
+		case types.NOT_NULL:
+			parts = append(parts, "NOT NULL")
+		case types.UNIQUE:
+			parts = append(parts, "UNIQUE")
+		case types.DEFAULT:
+			parts = append(parts, "DEFAULT "+defaultLiteral(attr.Value))
+		case types.MIN:
+			parts = append(parts, fmt.Sprintf("CHECK (%s >= %s)", name, attr.Value))
+		case types.MAX:
+			parts = append(parts, fmt.Sprintf("CHECK (%s <= %s)", name, attr.Value))
+		case types.MIN_LENGTH:
+			parts = append(parts, fmt.Sprintf("CHECK (length(%s) >= %s)", name, attr.Value))
+		case types.MAX_LENGTH:
+			parts = append(parts, fmt.Sprintf("CHECK (length(%s) <= %s)", name, attr.Value))
+		default:
+			return "", fmt.Errorf("unsupported attribute %s", attr.Type)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// defaultLiteral corrects the parser's rendering of true, which it writes
+// as "truefalse".
+func defaultLiteral(value string) string {
+	if value == "truefalse" {
+		return "true"
+	}
+	return value
+}
+
+func usesUint256(schema *types.Schema) bool {
+	for _, table := range schema.Tables {
+		for _, col := range table.Columns {
+			if col.Type.Name == "uint256" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func qualifiedName(pgSchema, name string) string {
+	if pgSchema == "" {
+		return name
+	}
+	return pgSchema + "." + name
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+const ddlTestSchema = `database shop;
+
+table users {
+    id uuid primary key,
+    name text notnull unique minlen(1) maxlen(64),
+    age int min(0) default(18),
+    balance uint256,
+    active bool default(true),
+    #name_idx index(name)
+}
+
+table orders {
+    user_id uuid notnull,
+    num int notnull,
+    price decimal(10,2),
+    #pk primary(user_id, num),
+    #num_idx unique(num),
+    foreign_key (user_id) references users(id) on_delete cascade on_update set_null
+}
+`
+
+func Test_DDL(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(ddlTestSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, err := renderDDL(res.Schema, "ds_shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-- Tables of the shop database, generated by kuneiform-lsp.
+
+CREATE SCHEMA IF NOT EXISTS ds_shop;
+
+` + uint256Domain + `
+
+CREATE TABLE ds_shop.users (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE CHECK (length(name) >= 1) CHECK (length(name) <= 64),
+    age INT8 CHECK (age >= 0) DEFAULT 18,
+    balance uint256,
+    active BOOL DEFAULT true
+);
+
+CREATE TABLE ds_shop.orders (
+    user_id UUID NOT NULL,
+    num INT8 NOT NULL,
+    price NUMERIC(10,2),
+    PRIMARY KEY (user_id, num),
+    FOREIGN KEY (user_id) REFERENCES ds_shop.users (id) ON DELETE CASCADE ON UPDATE SET NULL
+);
+
+CREATE INDEX name_idx ON ds_shop.users (name);
+CREATE UNIQUE INDEX num_idx ON ds_shop.orders (num);
+`
+	if ddl != want {
+		t.Errorf("expected DDL\n%s\ngot\n%s", want, ddl)
+	}
+
+	ddl, _ = renderDDL(res.Schema, "")
+	if !strings.Contains(ddl, "CREATE TABLE users (") || strings.Contains(ddl, "CREATE SCHEMA") {
+		t.Errorf("expected unqualified names without a schema, got\n%s", ddl)
+	}
+}
+
+func Test_DDLCommand(t *testing.T) {
+	l := newLspHandler(newOutputLogger(logs))
+	uri := "file:///shop.kf"
+	l.docs[uri] = &kfDocs{rawKf: ddlTestSchema}
+
+	raw, _ := json.Marshal(uri)
+	res, err := l.executeCommand(executeCommandParams{Command: ddlCommand, Arguments: []json.RawMessage{raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ddl, ok := res.(string); !ok || !strings.Contains(ddl, "CREATE TABLE orders (") {
+		t.Errorf("expected DDL, got %v", res)
+	}
+}
+
+func Test_DDLTableOrder(t *testing.T) {
+	src := `database org;
+
+table employees {
+    id int primary key,
+    team_id int notnull,
+    foreign_key (team_id) references teams(id)
+}
+
+table teams {
+    id int primary key,
+    lead_id int notnull,
+    foreign_key (lead_id) references leads(id)
+}
+
+table leads {
+    id int primary key,
+    team_id int notnull,
+    foreign_key (team_id) references teams(id)
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	ddl, err := renderDDL(res.Schema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// teams and leads reference each other, so one key is added at the end
+	var tables []string
+	for _, line := range strings.Split(ddl, "\n") {
+		if name, ok := strings.CutPrefix(line, "CREATE TABLE "); ok {
+			tables = append(tables, strings.TrimSuffix(name, " ("))
+		}
+	}
+	if got := strings.Join(tables, ", "); got != "teams, leads, employees" {
+		t.Errorf("expected parents first, got %s", got)
+	}
+	alter := "\nALTER TABLE teams ADD FOREIGN KEY (lead_id) REFERENCES leads (id);\n"
+	if !strings.Contains(ddl, alter) || strings.Count(ddl, "REFERENCES leads") != 1 || strings.Count(ddl, "ALTER TABLE") != 1 {
+		t.Errorf("expected the key closing the cycle to be added by ALTER TABLE, got\n%s", ddl)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Doc comments are the // comments on the lines directly above a table,
+// column, action or procedure, without a blank line in between. The text
+// before the first tag describes the declaration; @param tags describe the
+// parameters of actions and procedures, and continue on the following lines
+// until the next tag:
+//
+//	// Moves tokens between two accounts.
+//	// @param $to the receiving account
+//	// @param $amount how much to send
+//	action transfer($to, $amount) public { ... }
+
+// leadingComment returns the doc comment of the declaration starting at
+// offset, without the comment markers.
+func leadingComment(toks []token, offset int) string {
+	i := tokenIndexAt(toks, offset)
+	if i < 0 {
+		return ""
+	}
+
+	var lines []string
+	line := toks[i].line
+	for j := i - 1; j >= 0; j-- {
+		tok := toks[j]
+		if tok.kind != tokComment || !strings.HasPrefix(tok.text, "//") || tok.line != line-1 {
+			break
+		}
+		if j > 0 && tokenEndLine(toks[j-1]) == tok.line {
+			break // trailing comment of the line above
+		}
+		text := strings.TrimPrefix(tok.text, "//")
+		lines = append(lines, strings.TrimPrefix(strings.TrimRight(text, " \t\r"), " "))
+		line = tok.line
+	}
+
+	// collected bottom up
+	for l, r := 0, len(lines)-1; l < r; l, r = l+1, r-1 {
+		lines[l], lines[r] = lines[r], lines[l]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type docComment struct {
+	description string
+	// params are the @param descriptions by normalized $name.
+	params map[string]string
+}
+
+func parseDocComment(text string) docComment {
+	d := docComment{params: make(map[string]string)}
+	var description []string
+	param := ""
+	for _, line := range strings.Split(text, "\n") {
+		if rest, ok := strings.CutPrefix(line, "@param"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			name, doc, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			param = paramName(name)
+			d.params[param] = strings.TrimSpace(doc)
+			continue
+		}
+		if param == "" {
+			description = append(description, line)
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			d.params[param] = strings.TrimSpace(d.params[param] + " " + line)
+		}
+	}
+	d.description = strings.TrimSpace(strings.Join(description, "\n"))
+	return d
+}
+
+// paramName normalizes a parameter name, which doc comments may write
+// without the $.
+func paramName(name string) string {
+	if !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	return normalizeIdent(name)
+}
+
+func (d docComment) isEmpty() bool {
+	return d.description == "" && len(d.params) == 0
+}
+
+// param returns the description of a parameter.
+func (d docComment) param(name string) string {
+	return d.params[paramName(name)]
+}
+
+// markdown renders the description and the documented parameters, in the
+// order they are declared.
+func (d docComment) markdown(params []string) string {
+	var b strings.Builder
+	b.WriteString(d.description)
+	first := true
+	for _, name := range params {
+		doc := d.param(name)
+		if doc == "" {
+			continue
+		}
+		if first {
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString("**Parameters**\n")
+			first = false
+		}
+		fmt.Fprintf(&b, "\n- `%s`: %s", name, doc)
+	}
+	return b.String()
+}
+
+// plainText is markdown for clients showing text as is, like the
+// documentation of completion items.
+func (d docComment) plainText(params []string) string {
+	var b strings.Builder
+	b.WriteString(d.description)
+	for _, name := range params {
+		if doc := d.param(name); doc != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "\n%s: %s", name, doc)
+		}
+	}
+	return strings.TrimLeft(b.String(), "\n")
+}
+
+// declarationDocs are the doc comments of the declarations of a schema.
+type declarationDocs struct {
+	// decls are the comments of tables, actions and procedures by name.
+	decls map[string]docComment
+	// columns are the comments of columns by table.column.
+	columns map[string]docComment
+}
+
+func collectDocComments(text string, r *parse.SchemaParseResult) declarationDocs {
+	docs := declarationDocs{decls: make(map[string]docComment), columns: make(map[string]docComment)}
+	if r == nil || r.SchemaInfo == nil {
+		return docs
+	}
+
+	toks := lexKf(text)
+	defs := columnDefinitions(toks, r)
+	for name, block := range r.SchemaInfo.Blocks {
+		if d := parseDocComment(leadingComment(toks, block.AbsStart)); !d.isEmpty() {
+			docs.decls[normalizeIdent(name)] = d
+		}
+		if !isTableBlock(toks, block) {
+			continue
+		}
+		for _, tok := range toks {
+			if tok.offset < block.AbsStart || tok.offset > block.AbsEnd || !defs[tokenKey{tok.line, tok.col}] {
+				continue
+			}
+			if d := parseDocComment(leadingComment(toks, tok.offset)); !d.isEmpty() {
+				docs.columns[normalizeIdent(name+"."+tok.text)] = d
+			}
+		}
+	}
+	return docs
+}
+
+func (d declarationDocs) of(name string) docComment {
+	return d.decls[normalizeIdent(name)]
+}
+
+func (d declarationDocs) column(table, column string) docComment {
+	return d.columns[normalizeIdent(table+"."+column)]
+}
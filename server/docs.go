@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Documentation of a schema: its tables, actions, procedures and foreign
+// procedures with their doc comments, signatures and the tables and methods
+// they use, linked to each other. The declarations are found the same way
+// as for go to definition, so the docs list what the editor knows about.
+
+var docsFormats = []string{"markdown", "html"}
+
+type schemaDocs struct {
+	Name              string
+	Doc               string
+	Tables            []tableDoc
+	Actions           []methodDoc
+	Procedures        []methodDoc
+	ForeignProcedures []methodDoc
+}
+
+type docLink struct {
+	Name   string
+	Anchor string
+}
+
+type tableDoc struct {
+	docLink
+	Doc         string
+	Columns     []columnDoc
+	Indexes     []string
+	ForeignKeys []foreignKeyDoc
+	UsedBy      []docLink
+}
+
+type columnDoc struct {
+	Name        string
+	Type        string
+	Constraints []string
+	Doc         string
+}
+
+type foreignKeyDoc struct {
+	Columns       []string
+	Parent        docLink
+	ParentColumns []string
+	Actions       []string
+}
+
+type methodDoc struct {
+	docLink
+	Doc       string
+	Params    []paramDoc
+	Signature string
+	Access    []tableAccessDoc
+	Calls     []docLink
+	CalledBy  []docLink
+}
+
+// paramDoc is a parameter documented with @param.
+type paramDoc struct {
+	Name string
+	Doc  string
+}
+
+type tableAccessDoc struct {
+	Table      docLink
+	Operations []string
+}
+
+func tableLink(name string) docLink {
+	return docLink{Name: name, Anchor: "table-" + name}
+}
+
+func buildSchemaDocs(text string, r *parse.SchemaParseResult) schemaDocs {
+	docs := schemaDocs{Name: r.Schema.Name}
+	toks := lexKf(text)
+	for _, tok := range toks {
+		if tok.kind != tokComment {
+			docs.Doc = leadingComment(toks, tok.offset)
+			break
+		}
+	}
+
+	// links to every declaration, by name
+	links := make(map[string]docLink)
+	for _, action := range r.Schema.Actions {
+		links[action.Name] = docLink{Name: action.Name, Anchor: "action-" + action.Name}
+	}
+	for _, proc := range r.Schema.Procedures {
+		links[proc.Name] = docLink{Name: proc.Name, Anchor: "procedure-" + proc.Name}
+	}
+	for _, proc := range r.Schema.ForeignProcedures {
+		links[proc.Name] = docLink{Name: proc.Name, Anchor: "foreign-procedure-" + proc.Name}
+	}
+	toLinks := func(names []string) []docLink {
+		var res []docLink
+		for _, name := range names {
+			if link, ok := links[name]; ok {
+				res = append(res, link)
+			}
+		}
+		return res
+	}
+
+	comments := collectDocComments(text, r)
+	graph := buildCallGraph(toks, r)
+	access := make(map[string]methodDataAccess)
+	usedBy := make(map[string][]string)
+	for _, m := range getDataAccess(r) {
+		access[m.Name] = m
+		for _, t := range m.Tables {
+			usedBy[t.Table] = append(usedBy[t.Table], m.Name)
+		}
+	}
+
+	method := func(loc methodsLocation, signature string) methodDoc {
+		comment := comments.of(loc.name)
+		m := methodDoc{
+			docLink:   links[loc.name],
+			Doc:       comment.description,
+			Signature: signature,
+			CalledBy:  toLinks(graph.callers(loc.name)),
+		}
+		_, params, _, _ := methodSignature(r, loc.name)
+		for _, param := range params {
+			if doc := comment.param(param); doc != "" {
+				m.Params = append(m.Params, paramDoc{Name: param, Doc: doc})
+			}
+		}
+		var callees []string
+		seen := make(map[string]bool)
+		for _, call := range graph.callsFrom(loc.name) {
+			if !seen[call.callee] {
+				seen[call.callee] = true
+				callees = append(callees, call.callee)
+			}
+		}
+		m.Calls = toLinks(callees)
+		for _, t := range access[loc.name].Tables {
+			m.Access = append(m.Access, tableAccessDoc{Table: tableLink(t.Table), Operations: t.Operations})
+		}
+		return m
+	}
+
+	for _, loc := range getTableLocations(r) {
+		table, ok := r.Schema.FindTable(loc.name)
+		if !ok {
+			continue
+		}
+		t := tableDoc{docLink: tableLink(table.Name), Doc: comments.of(table.Name).description}
+		for _, col := range table.Columns {
+			c := columnDoc{Name: col.Name, Type: col.Type.String(), Doc: comments.column(table.Name, col.Name).description}
+			for _, attr := range col.Attributes {
+				c.Constraints = append(c.Constraints, attributeText(attr))
+			}
+			t.Columns = append(t.Columns, c)
+		}
+		for _, idx := range table.Indexes {
+			t.Indexes = append(t.Indexes, fmt.Sprintf("%s (%s)", idx.Name, strings.Join(idx.Columns, ", ")))
+			if idx.Type == types.UNIQUE_BTREE {
+				t.Indexes[len(t.Indexes)-1] += " unique"
+			}
+		}
+		for _, fk := range table.ForeignKeys {
+			f := foreignKeyDoc{Columns: fk.ChildKeys, Parent: tableLink(fk.ParentTable), ParentColumns: fk.ParentKeys}
+			for _, action := range fk.Actions {
+				f.Actions = append(f.Actions, strings.ToLower(fmt.Sprintf("on %s %s", action.On, action.Do)))
+			}
+			t.ForeignKeys = append(t.ForeignKeys, f)
+		}
+		t.UsedBy = toLinks(usedBy[table.Name])
+		docs.Tables = append(docs.Tables, t)
+	}
+	for _, loc := range getActionLocations(r) {
+		if action, ok := r.Schema.FindAction(loc.name); ok {
+			docs.Actions = append(docs.Actions, method(loc, actionSignature(action)))
+		}
+	}
+	for _, loc := range getProcedureLocations(r) {
+		if proc, ok := r.Schema.FindProcedure(loc.name); ok {
+			docs.Procedures = append(docs.Procedures, method(loc, procedureSignature(proc)))
+		}
+	}
+	for _, loc := range getForeignProcedureLocations(r) {
+		if proc, ok := r.Schema.FindForeignProcedure(loc.name); ok {
+			docs.ForeignProcedures = append(docs.ForeignProcedures, method(loc, foreignProcedureSignature(proc)))
+		}
+	}
+	return docs
+}
+
+// attributeKeywords are the keywords column attributes are declared with.
+var attributeKeywords = map[types.AttributeType]string{
+	types.PRIMARY_KEY: "primary key",
+	types.NOT_NULL:    "notnull",
+	types.MIN_LENGTH:  "minlen",
+	types.MAX_LENGTH:  "maxlen",
+}
+
+// attributeText writes a column attribute as it is declared.
+func attributeText(attr *types.Attribute) string {
+	text, ok := attributeKeywords[attr.Type]
+	if !ok {
+		text = strings.ToLower(string(attr.Type))
+	}
+	if attr.Value != "" {
+		text += "(" + attr.Value + ")"
+	}
+	return text
+}
+
+func modifiersText(public bool, modifiers []types.Modifier) string {
+	parts := []string{"private"}
+	if public {
+		parts[0] = "public"
+	}
+	for _, m := range modifiers {
+		parts = append(parts, strings.ToLower(string(m)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func returnsText(returns *types.ProcedureReturn) string {
+	if returns == nil {
+		return ""
+	}
+	var fields []string
+	for _, f := range returns.Fields {
+		fields = append(fields, strings.TrimSpace(f.Name+" "+f.Type.String()))
+	}
+	if returns.IsTable {
+		return " returns table(" + strings.Join(fields, ", ") + ")"
+	}
+	return " returns (" + strings.Join(fields, ", ") + ")"
+}
+
+func actionSignature(action *types.Action) string {
+	return fmt.Sprintf("action %s(%s) %s", action.Name, strings.Join(action.Parameters, ", "), modifiersText(action.Public, action.Modifiers))
+}
+
+func procedureSignature(proc *types.Procedure) string {
+	var params []string
+	for _, p := range proc.Parameters {
+		params = append(params, p.Name+" "+p.Type.String())
+	}
+	return fmt.Sprintf("procedure %s(%s) %s%s", proc.Name, strings.Join(params, ", "), modifiersText(proc.Public, proc.Modifiers), returnsText(proc.Returns))
+}
+
+func foreignProcedureSignature(proc *types.ForeignProcedure) string {
+	var params []string
+	for _, p := range proc.Parameters {
+		params = append(params, p.String())
+	}
+	return fmt.Sprintf("foreign procedure %s(%s)%s", proc.Name, strings.Join(params, ", "), returnsText(proc.Returns))
+}
+
+func renderDocs(docs schemaDocs, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "markdown", "md", "":
+		return docsMarkdown(docs), nil
+	case "html":
+		var b strings.Builder
+		err := docsHTML.Execute(&b, docs)
+		return b.String(), err
+	default:
+		return "", fmt.Errorf("unknown docs format %q, expected %s", format, strings.Join(docsFormats, ", "))
+	}
+}
+
+func markdownLinks(links []docLink) string {
+	parts := make([]string, len(links))
+	for i, link := range links {
+		parts[i] = fmt.Sprintf("[%s](#%s)", link.Name, link.Anchor)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// markdownCell escapes text for a table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func docsMarkdown(docs schemaDocs) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", docs.Name)
+	if docs.Doc != "" {
+		fmt.Fprintf(&b, "%s\n\n", docs.Doc)
+	}
+
+	if len(docs.Tables) > 0 {
+		b.WriteString("## Tables\n\n")
+	}
+	for _, t := range docs.Tables {
+		fmt.Fprintf(&b, "<a id=\"%s\"></a>\n\n### %s\n\n", t.Anchor, t.Name)
+		if t.Doc != "" {
+			fmt.Fprintf(&b, "%s\n\n", t.Doc)
+		}
+		b.WriteString("| Column | Type | Constraints | Description |\n| --- | --- | --- | --- |\n")
+		for _, c := range t.Columns {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", c.Name, markdownCell(c.Type), markdownCell(strings.Join(c.Constraints, ", ")), markdownCell(strings.ReplaceAll(c.Doc, "\n", " ")))
+		}
+		b.WriteString("\n")
+		if len(t.Indexes) > 0 {
+			b.WriteString("Indexes:\n\n")
+			for _, idx := range t.Indexes {
+				fmt.Fprintf(&b, "- %s\n", idx)
+			}
+			b.WriteString("\n")
+		}
+		if len(t.ForeignKeys) > 0 {
+			b.WriteString("Foreign keys:\n\n")
+			for _, fk := range t.ForeignKeys {
+				fmt.Fprintf(&b, "- (%s) references [%s](#%s) (%s)", strings.Join(fk.Columns, ", "), fk.Parent.Name, fk.Parent.Anchor, strings.Join(fk.ParentColumns, ", "))
+				if len(fk.Actions) > 0 {
+					fmt.Fprintf(&b, " %s", strings.Join(fk.Actions, " "))
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if len(t.UsedBy) > 0 {
+			fmt.Fprintf(&b, "Used by: %s\n\n", markdownLinks(t.UsedBy))
+		}
+	}
+
+	sections := []struct {
+		title   string
+		methods []methodDoc
+	}{
+		{"Actions", docs.Actions},
+		{"Procedures", docs.Procedures},
+		{"Foreign procedures", docs.ForeignProcedures},
+	}
+	for _, section := range sections {
+		if len(section.methods) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s\n\n", section.title)
+		for _, m := range section.methods {
+			fmt.Fprintf(&b, "<a id=\"%s\"></a>\n\n### %s\n\n", m.Anchor, m.Name)
+			fmt.Fprintf(&b, "```kuneiform\n%s\n```\n\n", m.Signature)
+			if m.Doc != "" {
+				fmt.Fprintf(&b, "%s\n\n", m.Doc)
+			}
+			if len(m.Params) > 0 {
+				b.WriteString("Parameters:\n\n")
+				for _, p := range m.Params {
+					fmt.Fprintf(&b, "- `%s`: %s\n", p.Name, p.Doc)
+				}
+				b.WriteString("\n")
+			}
+			if len(m.Access) > 0 {
+				b.WriteString("Tables:\n\n")
+				for _, a := range m.Access {
+					fmt.Fprintf(&b, "- [%s](#%s): %s\n", a.Table.Name, a.Table.Anchor, strings.Join(a.Operations, ", "))
+				}
+				b.WriteString("\n")
+			}
+			if len(m.Calls) > 0 {
+				fmt.Fprintf(&b, "Calls: %s\n\n", markdownLinks(m.Calls))
+			}
+			if len(m.CalledBy) > 0 {
+				fmt.Fprintf(&b, "Called by: %s\n\n", markdownLinks(m.CalledBy))
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+var docsHTML = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+pre { background: #f4f4f4; padding: 0.6em; }
+.doc { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{with .Doc}}<p class="doc">{{.}}</p>{{end}}
+<nav><h2>Contents</h2><ul>
+{{range .Tables}}<li><a href="#{{.Anchor}}">{{.Name}}</a></li>
+{{end}}{{range .Actions}}<li><a href="#{{.Anchor}}">{{.Name}}</a></li>
+{{end}}{{range .Procedures}}<li><a href="#{{.Anchor}}">{{.Name}}</a></li>
+{{end}}{{range .ForeignProcedures}}<li><a href="#{{.Anchor}}">{{.Name}}</a></li>
+{{end}}</ul></nav>
+{{if .Tables}}<h2>Tables</h2>{{end}}
+{{range .Tables}}<section id="{{.Anchor}}">
+<h3>{{.Name}}</h3>
+{{with .Doc}}<p class="doc">{{.}}</p>{{end}}
+<table>
+<tr><th>Column</th><th>Type</th><th>Constraints</th><th>Description</th></tr>
+{{range .Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{join .Constraints ", "}}</td><td>{{.Doc}}</td></tr>
+{{end}}</table>
+{{if .Indexes}}<p>Indexes:</p><ul>{{range .Indexes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .ForeignKeys}}<p>Foreign keys:</p><ul>{{range .ForeignKeys}}<li>({{join .Columns ", "}}) references <a href="#{{.Parent.Anchor}}">{{.Parent.Name}}</a> ({{join .ParentColumns ", "}}) {{join .Actions " "}}</li>{{end}}</ul>{{end}}
+{{if .UsedBy}}<p>Used by: {{range $i, $l := .UsedBy}}{{if $i}}, {{end}}<a href="#{{$l.Anchor}}">{{$l.Name}}</a>{{end}}</p>{{end}}
+</section>
+{{end}}
+{{define "methods"}}{{range .}}<section id="{{.Anchor}}">
+<h3>{{.Name}}</h3>
+<pre><code>{{.Signature}}</code></pre>
+{{with .Doc}}<p class="doc">{{.}}</p>{{end}}
+{{if .Params}}<p>Parameters:</p><ul>{{range .Params}}<li><code>{{.Name}}</code>: {{.Doc}}</li>{{end}}</ul>{{end}}
+{{if .Access}}<p>Tables:</p><ul>{{range .Access}}<li><a href="#{{.Table.Anchor}}">{{.Table.Name}}</a>: {{join .Operations ", "}}</li>{{end}}</ul>{{end}}
+{{if .Calls}}<p>Calls: {{range $i, $l := .Calls}}{{if $i}}, {{end}}<a href="#{{$l.Anchor}}">{{$l.Name}}</a>{{end}}</p>{{end}}
+{{if .CalledBy}}<p>Called by: {{range $i, $l := .CalledBy}}{{if $i}}, {{end}}<a href="#{{$l.Anchor}}">{{$l.Name}}</a>{{end}}</p>{{end}}
+</section>
+{{end}}{{end}}
+{{if .Actions}}<h2>Actions</h2>{{template "methods" .Actions}}{{end}}
+{{if .Procedures}}<h2>Procedures</h2>{{template "methods" .Procedures}}{{end}}
+{{if .ForeignProcedures}}<h2>Foreign procedures</h2>{{template "methods" .ForeignProcedures}}{{end}}
+</body>
+</html>
+`))
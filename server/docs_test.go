@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+func Test_Docs(t *testing.T) {
+	src := `// Glow is a social network.
+database glow;
+
+// users are the accounts.
+table users {
+    id uuid primary key,
+    name text notnull maxlen(32)
+}
+
+// unrelated comment
+
+table posts {
+    id uuid primary key,
+    author uuid notnull,
+    foreign key (author) references users(id) on delete cascade
+}
+
+// get_name returns the name of a user.
+// It returns nothing for unknown users.
+procedure get_name($id uuid) public view returns (name text) {
+    for $row in SELECT name FROM users WHERE id = $id {
+        return $row.name;
+    }
+}
+
+action rename($id, $name) public {
+    UPDATE users SET name = $name WHERE id = $id;
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	docs := buildSchemaDocs(src, res)
+	if docs.Doc != "Glow is a social network." || docs.Tables[0].Doc != "users are the accounts." || docs.Tables[1].Doc != "" {
+		t.Errorf("unexpected doc comments %q, %q, %q", docs.Doc, docs.Tables[0].Doc, docs.Tables[1].Doc)
+	}
+	if proc := docs.Procedures[0]; proc.Doc != "get_name returns the name of a user.\nIt returns nothing for unknown users." ||
+		proc.Signature != "procedure get_name($id uuid) public view returns (name text)" {
+		t.Errorf("unexpected procedure docs %+v", proc)
+	}
+
+	md, err := renderDocs(docs, "markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"| name | text | notnull, maxlen(32) |",
+		"- (author) references [users](#table-users) (id) on delete cascade",
+		"Used by: [rename](#action-rename), [get_name](#procedure-get_name)",
+		"```kuneiform\naction rename($id, $name) public\n```",
+		"- [users](#table-users): read, update",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q\n%s", want, md)
+		}
+	}
+
+	page, err := renderDocs(docs, "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page, `<section id="procedure-get_name">`) || !strings.Contains(page, `<a href="#table-users">users</a>`) {
+		t.Errorf("unexpected html\n%s", page)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+)
+
+// Entity-relationship diagrams of the tables of a schema, with their
+// columns, keys, indexes and foreign keys, as Mermaid, Graphviz DOT or
+// PlantUML source.
+
+var erdFormats = []string{"mermaid", "dot", "plantuml"}
+
+// erdTable is a table with the facts the diagrams show.
+type erdTable struct {
+	name    string
+	columns []erdColumn
+	indexes []string
+}
+
+type erdColumn struct {
+	name, typ string
+	// keys are PK, FK and UK.
+	keys    []string
+	notNull bool
+}
+
+// erdRelation is a foreign key from child to parent.
+type erdRelation struct {
+	child, parent         string
+	childKeys, parentKeys []string
+	optional, oneToOne    bool
+}
+
+func renderERD(schema *types.Schema, format string) (string, error) {
+	tables, relations := erdModel(schema)
+	switch strings.ToLower(format) {
+	case "mermaid", "":
+		return erdMermaid(tables, relations), nil
+	case "dot":
+		return erdDOT(schema.Name, tables, relations), nil
+	case "plantuml":
+		return erdPlantUML(tables, relations), nil
+	default:
+		return "", fmt.Errorf("unknown diagram format %q, expected %s", format, strings.Join(erdFormats, ", "))
+	}
+}
+
+func erdModel(schema *types.Schema) ([]erdTable, []erdRelation) {
+	var tables []erdTable
+	var relations []erdRelation
+	for _, table := range schema.Tables {
+		primary, _ := table.GetPrimaryKey()
+		keys := make(map[string][]string)
+		for _, col := range primary {
+			keys[col] = append(keys[col], "PK")
+		}
+		for _, fk := range table.ForeignKeys {
+			for _, col := range fk.ChildKeys {
+				keys[col] = append(keys[col], "FK")
+			}
+		}
+
+		t := erdTable{name: table.Name}
+		unique := make(map[string]bool)
+		for _, col := range table.Columns {
+			if col.HasAttribute(types.UNIQUE) {
+				unique[col.Name] = true
+				keys[col.Name] = append(keys[col.Name], "UK")
+			}
+		}
+		for _, idx := range table.Indexes {
+			kind := "index"
+			switch idx.Type {
+			case types.UNIQUE_BTREE:
+				kind = "unique index"
+				if len(idx.Columns) == 1 {
+					unique[idx.Columns[0]] = true
+				}
+			case types.PRIMARY:
+				kind = "primary index"
+			}
+			t.indexes = append(t.indexes, fmt.Sprintf("%s %s (%s)", kind, idx.Name, strings.Join(idx.Columns, ", ")))
+		}
+		if len(primary) == 1 {
+			unique[primary[0]] = true
+		}
+
+		notNull := make(map[string]bool)
+		for _, col := range table.Columns {
+			notNull[col.Name] = col.HasAttribute(types.NOT_NULL) || col.HasAttribute(types.PRIMARY_KEY)
+			t.columns = append(t.columns, erdColumn{
+				name:    col.Name,
+				typ:     col.Type.String(),
+				keys:    keys[col.Name],
+				notNull: notNull[col.Name],
+			})
+		}
+		tables = append(tables, t)
+
+		for _, fk := range table.ForeignKeys {
+			rel := erdRelation{
+				child:      table.Name,
+				parent:     fk.ParentTable,
+				childKeys:  fk.ChildKeys,
+				parentKeys: fk.ParentKeys,
+				oneToOne:   len(fk.ChildKeys) == 1 && unique[fk.ChildKeys[0]],
+			}
+			for _, col := range fk.ChildKeys {
+				rel.optional = rel.optional || !notNull[col]
+			}
+			relations = append(relations, rel)
+		}
+	}
+	return tables, relations
+}
+
+func erdMermaid(tables []erdTable, relations []erdRelation) string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "    %s {\n", t.name)
+		for _, col := range t.columns {
+			// Mermaid types are single words
+			typ := strings.NewReplacer(",", "_", " ", "_").Replace(col.typ)
+			fmt.Fprintf(&b, "        %s %s", typ, col.name)
+			if len(col.keys) > 0 {
+				fmt.Fprintf(&b, " %s", strings.Join(col.keys, ", "))
+			}
+			if !col.notNull {
+				b.WriteString(` "nullable"`)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, rel := range relations {
+		parent := "||"
+		if rel.optional {
+			parent = "|o"
+		}
+		child := "o{"
+		if rel.oneToOne {
+			child = "o|"
+		}
+		fmt.Fprintf(&b, "    %s %s--%s %s : %q\n", rel.parent, parent, child, rel.child, strings.Join(rel.childKeys, ", "))
+	}
+	for _, t := range tables {
+		for _, idx := range t.indexes {
+			fmt.Fprintf(&b, "    %%%% %s: %s\n", t.name, idx)
+		}
+	}
+	return b.String()
+}
+
+func erdDOT(name string, tables []erdTable, relations []erdRelation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", name)
+	b.WriteString("    rankdir=LR;\n")
+	b.WriteString("    node [shape=plaintext];\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "    %q [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">\n", t.name)
+		fmt.Fprintf(&b, "        <tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>\n", html.EscapeString(t.name))
+		for _, col := range t.columns {
+			label := col.name + ": " + col.typ
+			if len(col.keys) > 0 {
+				label += " " + strings.Join(col.keys, ", ")
+			}
+			if !col.notNull {
+				label += "?"
+			}
+			fmt.Fprintf(&b, "        <tr><td port=%q align=\"left\">%s</td></tr>\n", col.name, html.EscapeString(label))
+		}
+		for _, idx := range t.indexes {
+			fmt.Fprintf(&b, "        <tr><td align=\"left\"><i>%s</i></td></tr>\n", html.EscapeString(idx))
+		}
+		b.WriteString("    </table>>];\n")
+	}
+	for _, rel := range relations {
+		child, parent := rel.child, rel.parent
+		if len(rel.childKeys) == 1 && len(rel.parentKeys) == 1 {
+			child = fmt.Sprintf("%q:%q", rel.child, rel.childKeys[0])
+			parent = fmt.Sprintf("%q:%q", rel.parent, rel.parentKeys[0])
+		} else {
+			child, parent = fmt.Sprintf("%q", child), fmt.Sprintf("%q", parent)
+		}
+		style := ""
+		if rel.optional {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "    %s -> %s [label=%q%s];\n", child, parent, strings.Join(rel.childKeys, ", "), style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func erdPlantUML(tables []erdTable, relations []erdRelation) string {
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	for _, t := range tables {
+		fmt.Fprintf(&b, "entity %s {\n", t.name)
+		for _, col := range t.columns {
+			mandatory := "  "
+			if col.notNull {
+				mandatory = "* "
+			}
+			fmt.Fprintf(&b, "  %s%s : %s", mandatory, col.name, col.typ)
+			for _, key := range col.keys {
+				fmt.Fprintf(&b, " <<%s>>", key)
+			}
+			b.WriteString("\n")
+		}
+		if len(t.indexes) > 0 {
+			b.WriteString("  ..\n")
+			for _, idx := range t.indexes {
+				fmt.Fprintf(&b, "  %s\n", idx)
+			}
+		}
+		b.WriteString("}\n")
+	}
+	for _, rel := range relations {
+		parent := "||"
+		if rel.optional {
+			parent = "|o"
+		}
+		child := "}o"
+		if rel.oneToOne {
+			child = "|o"
+		}
+		fmt.Fprintf(&b, "%s %s--%s %s : %s\n", rel.child, child, parent, rel.parent, strings.Join(rel.childKeys, ", "))
+	}
+	b.WriteString("@enduml\n")
+	return b.String()
+}
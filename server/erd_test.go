@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+const erdTestSchema = `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull,
+    #name_idx unique(name)
+}
+
+table posts {
+    id uuid primary key,
+    author uuid notnull,
+    reviewer uuid,
+    foreign key (author) references users(id) on delete cascade,
+    foreign key (reviewer) references users(id)
+}
+`
+
+func Test_ERD(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(erdTestSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	mermaid, err := renderERD(res.Schema, "mermaid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `erDiagram
+    users {
+        uuid id PK
+        text name
+    }
+    posts {
+        uuid id PK
+        uuid author FK
+        uuid reviewer FK "nullable"
+    }
+    users ||--o{ posts : "author"
+    users |o--o{ posts : "reviewer"
+    %% users: unique index name_idx (name)
+`
+	if mermaid != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, mermaid)
+	}
+
+	dot, _ := renderERD(res.Schema, "dot")
+	if !strings.Contains(dot, `"posts":"author" -> "users":"id" [label="author"];`) ||
+		!strings.Contains(dot, `[label="reviewer", style=dashed]`) {
+		t.Errorf("unexpected dot output\n%s", dot)
+	}
+
+	plantuml, _ := renderERD(res.Schema, "plantuml")
+	if !strings.Contains(plantuml, "  * author : uuid <<FK>>\n") || !strings.Contains(plantuml, "posts }o--|| users : author\n") {
+		t.Errorf("unexpected plantuml output\n%s", plantuml)
+	}
+
+	if _, err := renderERD(res.Schema, "svg"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func Test_ERDCommand(t *testing.T) {
+	l := newLspHandler(newOutputLogger(logs))
+	uri := "file:///glow.kf"
+	l.docs[uri] = &kfDocs{rawKf: erdTestSchema}
+
+	arg := func(v any) json.RawMessage {
+		raw, _ := json.Marshal(v)
+		return raw
+	}
+	res, err := l.executeCommand(executeCommandParams{Command: erdCommand, Arguments: []json.RawMessage{arg(uri), arg("plantuml")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diagram, ok := res.(string); !ok || !strings.HasPrefix(diagram, "@startuml") {
+		t.Errorf("expected a PlantUML diagram, got %v", res)
+	}
+
+	if _, err := l.executeCommand(executeCommandParams{Command: erdCommand, Arguments: []json.RawMessage{arg("file:///other.kf")}}); err == nil {
+		t.Error("expected an error for a document that is not open")
+	}
+
+	broken := "file:///broken.kf"
+	l.docs[broken] = &kfDocs{rawKf: erdTestSchema + "\naction get() public view {\n    SELECT * FROM nope;\n}\n"}
+	if _, err := l.executeCommand(executeCommandParams{Command: erdCommand, Arguments: []json.RawMessage{arg(broken)}}); err == nil {
+		t.Error("expected an error for a document with errors")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// fileCache caches what read returns for files by path, until their
+// modification time changes. Baselines, project settings, snippets and
+// manifests are read on every analysis, but rarely change.
+type fileCache[T any] struct {
+	read  func(path string) (T, error)
+	mu    sync.Mutex
+	files map[string]cachedFile[T]
+}
+
+type cachedFile[T any] struct {
+	modTime time.Time
+	value   T
+	err     error
+}
+
+func newFileCache[T any](read func(path string) (T, error)) *fileCache[T] {
+	return &fileCache[T]{read: read, files: make(map[string]cachedFile[T])}
+}
+
+// load returns the value of a file, or the error of os.Stat if it cannot be
+// found.
+func (c *fileCache[T]) load(path string) (T, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.loadAt(path, info.ModTime())
+}
+
+// loadAt is load for a file already known to have been modified at modTime.
+func (c *fileCache[T]) loadAt(path string, modTime time.Time) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.files[path]; ok && cached.modTime.Equal(modTime) {
+		return cached.value, cached.err
+	}
+	value, err := c.read(path)
+	c.files[path] = cachedFile[T]{modTime: modTime, value: value, err: err}
+	return value, err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Folding ranges: declarations from the parser's blocks, nested blocks such
+// as if and for by their braces, multi-line SQL statements from the ASTs and
+// runs of comments. The document is parsed again rather than using the last
+// valid parse, so the ranges match the text even while it has errors. A
+// range ends on the line before a closing brace that starts its own line, so
+// the brace stays visible when the range is folded.
+
+func getFoldingRanges(text string) []foldingRange {
+	toks := lexKf(text)
+	res, _ := parse.ParseAndValidate([]byte(text))
+
+	ranges := make([]foldingRange, 0)
+	seen := make(map[int]bool)
+	add := func(start, end int, kind string) {
+		if end <= start || seen[start] {
+			return
+		}
+		seen[start] = true
+		ranges = append(ranges, foldingRange{StartLine: start, EndLine: end, Kind: kind})
+	}
+
+	if res != nil && res.SchemaInfo != nil {
+		for _, block := range res.SchemaInfo.Blocks {
+			add(block.StartLine-1, foldEndLine(toks, block.EndLine-1, block.EndCol), "")
+		}
+	}
+
+	var open []token
+	for _, tok := range toks {
+		if tok.kind != tokPunct {
+			continue
+		}
+		switch tok.text {
+		case "{":
+			open = append(open, tok)
+		case "}":
+			if len(open) == 0 {
+				continue
+			}
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			add(start.line, foldEndLine(toks, tok.line, tok.col), "")
+		}
+	}
+
+	walkBodies(res, func(method string, n parse.Node) bool {
+		stmt, ok := n.(*parse.SQLStatement)
+		if !ok || !hasPosition(&stmt.Position) {
+			return true
+		}
+		rng := nodeRange(toks, &stmt.Position)
+		add(rng.Start.Line, rng.End.Line, "")
+		return false
+	})
+
+	// consecutive line comments on their own lines fold together
+	runStart, runEnd := -1, -1
+	flush := func() {
+		if runStart >= 0 {
+			add(runStart, runEnd, foldingRangeComment)
+		}
+		runStart, runEnd = -1, -1
+	}
+	for i, tok := range toks {
+		if tok.kind != tokComment {
+			continue
+		}
+		if strings.HasPrefix(tok.text, "/*") {
+			flush()
+			add(tok.line, tokenEndLine(tok), foldingRangeComment)
+			continue
+		}
+		if i > 0 && tokenEndLine(toks[i-1]) == tok.line {
+			continue // trailing comment
+		}
+		if runStart < 0 || tok.line != runEnd+1 {
+			flush()
+			runStart = tok.line
+		}
+		runEnd = tok.line
+	}
+	flush()
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].StartLine < ranges[j].StartLine })
+	return ranges
+}
+
+// foldEndLine returns the last line to fold for a block closed by the brace
+// at the given line and column.
+func foldEndLine(toks []token, line, col int) int {
+	i := sort.Search(len(toks), func(i int) bool {
+		return toks[i].line > line || (toks[i].line == line && toks[i].col >= col)
+	})
+	if i > 0 && i < len(toks) && toks[i].line == line && tokenEndLine(toks[i-1]) < line {
+		return line - 1
+	}
+	return line
+}
+
+// tokenEndLine returns the line a token ends on, which differs from its
+// start for multi-line strings and block comments.
+func tokenEndLine(tok token) int {
+	return tok.line + strings.Count(tok.text, "\n")
+}
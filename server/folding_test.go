@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_FoldingRanges(t *testing.T) {
+	src := `database glow;
+
+// users of the app,
+// one row per wallet
+table users {
+    id uuid primary key,
+    name text
+}
+
+action get_user($id) public view {
+    SELECT *
+    FROM users
+    WHERE id = $id;
+}
+
+/* counts the
+   users */
+procedure count_users($max int) public view returns (total int) {
+    $total int := 0;
+    for $row in SELECT * FROM users {
+        $total := $total + 1;
+    }
+    if $total > $max {
+        return $max;
+    } else {
+        return $total;
+    }
+    return $total;
+}
+`
+	want := []foldingRange{
+		{StartLine: 2, EndLine: 3, Kind: foldingRangeComment},
+		{StartLine: 4, EndLine: 6},
+		{StartLine: 9, EndLine: 12},
+		{StartLine: 10, EndLine: 12},
+		{StartLine: 15, EndLine: 16, Kind: foldingRangeComment},
+		{StartLine: 17, EndLine: 27},
+		{StartLine: 19, EndLine: 20},
+		{StartLine: 22, EndLine: 23},
+		{StartLine: 24, EndLine: 25},
+	}
+
+	got := getFoldingRanges(src)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formatting is whitespace only: lines are re-indented by brace depth,
+// trailing whitespace is removed and runs of blank lines are collapsed.
+// Apart from the optional keyword casing, tokens are never rewritten, so
+// formatting cannot change the meaning of a schema. Lines that continue a
+// statement keep their indentation relative to the line the statement
+// started on, which preserves hand-aligned SQL.
+
+type formatOptions struct {
+	// indentSize is the number of columns per nesting level.
+	indentSize int
+	// useTabs indents with tabs instead of spaces.
+	useTabs bool
+	// maxBlankLines is the number of consecutive blank lines to keep.
+	maxBlankLines int
+	// keywordCase is lower, upper or preserve (the default).
+	keywordCase string
+}
+
+var defaultFormatOptions = formatOptions{
+	indentSize:    4,
+	maxBlankLines: 1,
+}
+
+// formatKf formats a Kuneiform document. It fails if the braces in the
+// document are unbalanced, since the indentation would be meaningless.
+func formatKf(src string, opts formatOptions) (string, error) {
+	if opts.indentSize <= 0 {
+		opts.indentSize = defaultFormatOptions.indentSize
+	}
+
+	toks := lexKf(src)
+	if err := checkBraces(toks); err != nil {
+		return "", err
+	}
+	// changing the case of keywords keeps all offsets
+	src = applyKeywordCase(src, toks, opts.keywordCase)
+
+	newline := "\n"
+	if strings.Contains(src, "\r\n") {
+		newline = "\r\n"
+	}
+
+	var (
+		out       []string
+		next      int    // index of the first token not yet consumed
+		blocks    []bool // open braces; true if the block is a comma separated list
+		parens    int    // open parentheses
+		stmtStart *token // first token of the current statement
+		delta     int    // indentation change applied to the current statement
+		blanks    int    // consecutive blank lines seen
+		lineStart int    // byte offset of the current line
+		lines     = strings.Split(src, "\n")
+	)
+
+	consume := func(tok *token) {
+		if tok.kind == tokComment {
+			return
+		}
+		if stmtStart == nil {
+			stmtStart = tok
+		}
+
+		switch {
+		case tok.kind != tokPunct:
+		case tok.text == "{":
+			blocks = append(blocks, stmtStart.is("table") || stmtStart.is("use"))
+			stmtStart = nil
+		case tok.text == "}":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			stmtStart = nil
+		case tok.text == "(":
+			parens++
+		case tok.text == ")":
+			parens = max(parens-1, 0)
+		case tok.text == ";":
+			stmtStart = nil
+		case tok.text == "," && parens == 0 && len(blocks) > 0 && blocks[len(blocks)-1]:
+			stmtStart = nil
+		}
+	}
+
+	for _, raw := range lines {
+		start := lineStart
+		lineStart += len(raw) + 1
+
+		for next < len(toks) && toks[next].offset < start {
+			consume(&toks[next])
+			next++
+		}
+
+		// lines inside multi-line strings are kept as is, lines inside block
+		// comments move along with the line the comment started on
+		if next > 0 && toks[next-1].end() > start {
+			line := strings.TrimSuffix(raw, "\r")
+			if toks[next-1].kind == tokComment {
+				line = indentString(max(indentWidth(raw, opts.indentSize)+delta, 0), opts) + strings.TrimLeft(line, " \t")
+			}
+			out = append(out, line)
+			blanks = 0
+			continue
+		}
+
+		text := strings.Trim(raw, " \t\r\v\f")
+		if text == "" {
+			blanks++
+			if len(out) > 0 && blanks <= opts.maxBlankLines {
+				out = append(out, "")
+			}
+			continue
+		}
+		blanks = 0
+
+		depth := len(blocks)
+		closing := next < len(toks) && toks[next].text == "}"
+		if closing {
+			depth--
+		}
+
+		width := indentWidth(raw, opts.indentSize)
+		if !closing && (parens > 0 || stmtStart != nil) {
+			width = max(width+delta, 0)
+		} else {
+			newWidth := depth * opts.indentSize
+			delta = newWidth - width
+			width = newWidth
+		}
+
+		out = append(out, indentString(width, opts)+text)
+	}
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(out, newline) + newline, nil
+}
+
+// formatKeywords are the words whose case is changed by the keywordCase
+// option. Words that are commonly used as names, like key or first, are left
+// out.
+var formatKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range []string{
+		"database", "table", "action", "procedure", "foreign", "use", "as",
+		"public", "private", "view", "owner", "returns", "if", "elseif", "else",
+		"for", "in", "break", "return", "next", "and", "or", "not", "null",
+		"select", "from", "where", "insert", "into", "values", "update", "set",
+		"delete", "join", "inner", "left", "right", "outer", "cross", "on",
+		"group", "by", "having", "order", "asc", "desc", "limit", "offset",
+		"distinct", "union", "intersect", "except", "all", "exists", "between",
+		"like", "ilike", "is", "case", "when", "then", "end", "returning",
+		"conflict", "do", "nothing", "with", "recursive", "true", "false",
+	} {
+		formatKeywords[kw] = true
+	}
+}
+
+// applyKeywordCase changes the case of keywords to lower or upper case.
+// Words qualified with a dot, like users.end, are names and kept as is.
+func applyKeywordCase(src string, toks []token, keywordCase string) string {
+	var convert func(string) string
+	switch keywordCase {
+	case "lower":
+		convert = strings.ToLower
+	case "upper":
+		convert = strings.ToUpper
+	default:
+		return src
+	}
+
+	b := []byte(src)
+	for i, tok := range toks {
+		if tok.kind != tokIdent || !formatKeywords[normalizeIdent(tok.text)] {
+			continue
+		}
+		if i > 0 && toks[i-1].text == "." && toks[i-1].end() == tok.offset {
+			continue
+		}
+		if text := convert(tok.text); len(text) == len(tok.text) {
+			copy(b[tok.offset:], text)
+		}
+	}
+	return string(b)
+}
+
+// checkBraces ensures every opening brace has a matching closing brace.
+func checkBraces(toks []token) error {
+	var open []token
+	for _, tok := range toks {
+		if tok.kind != tokPunct {
+			continue
+		}
+		switch tok.text {
+		case "{":
+			open = append(open, tok)
+		case "}":
+			if len(open) == 0 {
+				return fmt.Errorf("%d:%d: unexpected '}'", tok.line+1, tok.col+1)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	if len(open) > 0 {
+		tok := open[len(open)-1]
+		return fmt.Errorf("%d:%d: unclosed '{'", tok.line+1, tok.col+1)
+	}
+	return nil
+}
+
+// indentWidth returns the width of the leading whitespace of a line, in columns.
+func indentWidth(line string, tabWidth int) int {
+	width := 0
+	for _, ch := range line {
+		switch ch {
+		case ' ':
+			width++
+		case '\t':
+			width += tabWidth - width%tabWidth
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+func indentString(width int, opts formatOptions) string {
+	if !opts.useTabs {
+		return strings.Repeat(" ", width)
+	}
+	return strings.Repeat("\t", width/opts.indentSize) + strings.Repeat(" ", width%opts.indentSize)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_FormatKf(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts formatOptions
+		want string
+	}{
+		{
+			name: "reindents blocks and trims whitespace",
+			src:  "\n\ndatabase glow;\n\n\n\ntable users {\n  id uuid primary key,   \n      name text\n}\n\n",
+			opts: defaultFormatOptions,
+			want: "database glow;\n\ntable users {\n    id uuid primary key,\n    name text\n}\n",
+		},
+		{
+			name: "keeps relative indentation of continued statements",
+			src:  "action a() public {\nSELECT *\nFROM users\n  WHERE id = 1;\n}\n",
+			opts: defaultFormatOptions,
+			want: "action a() public {\n    SELECT *\n    FROM users\n      WHERE id = 1;\n}\n",
+		},
+		{
+			name: "nested procedure blocks with tabs",
+			src:  "procedure p() public {\nfor $i in 1..2 {\nif $i == 1 {\nbreak;\n}\n}\n}",
+			opts: formatOptions{indentSize: 4, useTabs: true, maxBlankLines: 1},
+			want: "procedure p() public {\n\tfor $i in 1..2 {\n\t\tif $i == 1 {\n\t\t\tbreak;\n\t\t}\n\t}\n}\n",
+		},
+		{
+			name: "braces in strings and comments are ignored",
+			src:  "action a() public {\n// {\nSELECT '{' FROM t;\n}\n",
+			opts: defaultFormatOptions,
+			want: "action a() public {\n    // {\n    SELECT '{' FROM t;\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatKf(tt.src, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+
+			again, err := formatKf(got, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if again != got {
+				t.Errorf("formatting is not idempotent:\n%q", again)
+			}
+		})
+	}
+}
+
+func Test_FormatKfUnbalanced(t *testing.T) {
+	if _, err := formatKf("table users {\n id uuid\n", defaultFormatOptions); err == nil {
+		t.Error("expected an error for an unclosed brace")
+	}
+	if _, err := formatKf("}\n", defaultFormatOptions); err == nil {
+		t.Error("expected an error for an unexpected brace")
+	}
+}
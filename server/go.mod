@@ -3,6 +3,8 @@ module kuniform-ls
 go 1.22.3
 
 require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/kwilteam/kwil-db/core v0.3.0
 	github.com/kwilteam/kwil-db/parse v0.3.0
 	github.com/sourcegraph/go-lsp v0.0.0-20240223163137-f80c5dd31dfd
 	github.com/sourcegraph/jsonrpc2 v0.2.0
@@ -13,6 +15,5 @@ require (
 	github.com/cockroachdb/apd/v3 v3.2.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/holiman/uint256 v1.3.1 // indirect
-	github.com/kwilteam/kwil-db/core v0.3.0 // indirect
 	golang.org/x/exp v0.0.0-20240719175910-8a7402abbf56 // indirect
 )
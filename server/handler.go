@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/kwilteam/kwil-db/parse"
@@ -17,52 +20,147 @@ type lspHandler struct {
 	docs     map[string]*kfDocs
 	logger   *slog.Logger
 	handlers map[string]func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request)
+
+	// clientLog forwards the session's logs to the editor.
+	clientLog *clientLogHandler
+	// shared is set for sessions of a TCP or WebSocket server.
+	shared bool
+
+	// mu serializes requests with settings fetched in the background.
+	mu sync.Mutex
+	// pullSettings is set if the client supports workspace/configuration.
+	pullSettings bool
+	// watchFiles is set if the client can watch files for the server.
+	watchFiles bool
+	folders    []lsp.DocumentURI
+	// editorSettings are the client's settings by workspace folder. The
+	// empty URI holds the settings for documents outside of folders.
+	editorSettings map[lsp.DocumentURI]json.RawMessage
+	// reported are the settings problems already logged.
+	reported map[string]bool
 }
 
 type Handler func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request)
 
+func newLspHandler(logger *slog.Logger) *lspHandler {
+	clientLog := newClientLogHandler()
+	l := &lspHandler{
+		docs:           make(map[string]*kfDocs),
+		logger:         slog.New(teeHandler{logger.Handler(), clientLog}),
+		clientLog:      clientLog,
+		editorSettings: make(map[lsp.DocumentURI]json.RawMessage),
+		reported:       make(map[string]bool),
+	}
+	l.registerHandlers()
+	return l
+}
+
 func (l *lspHandler) registerHandlers() {
 	l.handlers = map[string]func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request){
-		"initialize":                  l.handleInitialize,
-		"textDocument/didOpen":        l.handleDidOpen,
-		"textDocument/didChange":      l.handleDidChange,
-		"textDocument/didClose":       l.handleDidClose,
-		"textDocument/didSave":        l.handleDidSave,
-		"shutdown":                    l.handleShutdown,
-		"$/cancelRequest":             l.handleCancelRequest,
-		"textDocument/documentSymbol": l.handleDocumentSymbol,
-		"textDocument/completion":     l.handleCompletion,
-		"textDocument/definition":     l.handleDefinition,
+		"initialize":                        l.handleInitialize,
+		"initialized":                       l.handleInitialized,
+		"textDocument/didOpen":              l.handleDidOpen,
+		"textDocument/didChange":            l.handleDidChange,
+		"textDocument/didClose":             l.handleDidClose,
+		"textDocument/didSave":              l.handleDidSave,
+		"shutdown":                          l.handleShutdown,
+		"exit":                              l.handleExit,
+		"$/cancelRequest":                   l.handleCancelRequest,
+		"workspace/didChangeConfiguration":  l.handleDidChangeConfiguration,
+		"workspace/didChangeWatchedFiles":   l.handleDidChangeWatchedFiles,
+		"textDocument/documentSymbol":       l.handleDocumentSymbol,
+		"textDocument/completion":           l.handleCompletion,
+		"textDocument/definition":           l.handleDefinition,
+		"textDocument/hover":                l.handleHover,
+		"textDocument/signatureHelp":        l.handleSignatureHelp,
+		"textDocument/formatting":           l.handleFormatting,
+		"textDocument/foldingRange":         l.handleFoldingRange,
+		"textDocument/selectionRange":       l.handleSelectionRange,
+		"textDocument/documentHighlight":    l.handleDocumentHighlight,
+		"textDocument/inlayHint":            l.handleInlayHint,
+		"textDocument/references":           l.handleReferences,
+		"textDocument/codeLens":             l.handleCodeLens,
+		"textDocument/codeAction":           l.handleCodeAction,
+		"codeAction/resolve":                l.handleCodeActionResolve,
+		"textDocument/prepareCallHierarchy": l.handlePrepareCallHierarchy,
+		"callHierarchy/incomingCalls":       l.handleIncomingCalls,
+		"callHierarchy/outgoingCalls":       l.handleOutgoingCalls,
+		"kuneiform/dataAccess":              l.handleDataAccess,
+		"kuneiform/schemaDiff":              l.handleSchemaDiff,
+		"kuneiform/compiledSchema":          l.handleCompiledSchema,
+		"workspace/executeCommand":          l.handleExecuteCommand,
 		// "textDocument/semanticTokens/full": l.handleSemanticTokens,
 		// "completionItem/resolve":           l.handleCompletionItemResolve,
 	}
 }
 
 func (l *lspHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	l.logger.Info("Received request: ", req.Method, req.ID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logger.Debug("received request", slog.String("method", req.Method), slog.String("id", req.ID.String()))
 	if handler, ok := l.handlers[req.Method]; ok {
 		handler(ctx, conn, req)
 	} else {
-		l.logger.Info("Unknown request method: ", req.Method, req.ID)
+		l.logger.Debug("unknown request method", slog.String("method", req.Method))
 	}
 }
 
+// initializeParams adds the workspace folders, which go-lsp doesn't know about.
+type initializeParams struct {
+	lsp.InitializeParams
+	WorkspaceFolders []struct {
+		URI  lsp.DocumentURI `json:"uri"`
+		Name string          `json:"name"`
+	} `json:"workspaceFolders"`
+}
+
 func (l *lspHandler) handleInitialize(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	params := lsp.InitializeParams{}
+	params := initializeParams{}
 	json.Unmarshal(*req.Params, &params)
+
+	l.pullSettings = params.Capabilities.Workspace.Configuration
+	if watched := params.Capabilities.Workspace.DidChangeWatchedFiles; watched != nil {
+		l.watchFiles = watched.DynamicRegistration
+	}
+	for _, folder := range params.WorkspaceFolders {
+		l.folders = append(l.folders, folder.URI)
+	}
+	if len(l.folders) == 0 && params.RootURI != "" {
+		l.folders = append(l.folders, params.RootURI)
+	}
+	if raw, err := json.Marshal(params.InitializationOptions); err == nil {
+		l.editorSettings[""] = raw
+	}
+
 	kind := lsp.TDSKFull
-	res := lsp.InitializeResult{
-		Capabilities: lsp.ServerCapabilities{
-			TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
-				Kind: &kind,
-			},
-			// DocumentSymbolProvider: true,
-			CompletionProvider: &lsp.CompletionOptions{
-				ResolveProvider:   false,
-				TriggerCharacters: triggerKeywords,
+	res := initializeResult{
+		Capabilities: serverCapabilities{
+			ServerCapabilities: lsp.ServerCapabilities{
+				TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
+					Kind: &kind,
+				},
+				DocumentSymbolProvider: true,
+				CompletionProvider: &lsp.CompletionOptions{
+					ResolveProvider:   false,
+					TriggerCharacters: triggerKeywords,
+				},
+				HoverProvider: true,
+				SignatureHelpProvider: &lsp.SignatureHelpOptions{
+					TriggerCharacters: signatureHelpTriggers,
+				},
+				DefinitionProvider:         true,
+				DocumentFormattingProvider: true,
+				DocumentHighlightProvider:  true,
+				ReferencesProvider:         true,
+				CodeLensProvider:           &lsp.CodeLensOptions{},
+				ExecuteCommandProvider:     &lsp.ExecuteCommandOptions{Commands: executeCommands},
 			},
-			// HoverProvider: true,
-			DefinitionProvider: true,
+			FoldingRangeProvider:   true,
+			SelectionRangeProvider: true,
+			InlayHintProvider:      true,
+			CallHierarchyProvider:  true,
+			CodeActionProvider:     &codeActionOptions{ResolveProvider: true},
 		},
 	}
 	conn.Reply(ctx, req.ID, &res)
@@ -79,11 +177,7 @@ func (l *lspHandler) handleDidOpen(ctx context.Context, conn *jsonrpc2.Conn, req
 		l.docs[docID] = &kfDocs{rawKf: docText}
 	}
 
-	_, diagnostics := l.validateKfDocument(docID, docText)
-	conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
-		URI:         params.TextDocument.URI,
-		Diagnostics: diagnostics,
-	})
+	l.publishDiagnostics(ctx, conn, params.TextDocument.URI)
 }
 
 func (l *lspHandler) handleDidChange(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
@@ -91,7 +185,7 @@ func (l *lspHandler) handleDidChange(ctx context.Context, conn *jsonrpc2.Conn, r
 	json.Unmarshal(*req.Params, &params)
 
 	if len(params.ContentChanges) != 1 {
-		l.logger.Error("Expected exactly one change, got ", slog.Int("content changes", len(params.ContentChanges)))
+		l.logger.Error("expected exactly one change", slog.Int("content changes", len(params.ContentChanges)))
 		panic("Should be exactly one change")
 	}
 
@@ -105,11 +199,7 @@ func (l *lspHandler) handleDidChange(ctx context.Context, conn *jsonrpc2.Conn, r
 		doc.rawKf = docText // does this update the value in the map?
 	}
 
-	_, diagnostics := l.validateKfDocument(docID, docText)
-	conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
-		URI:         params.TextDocument.URI,
-		Diagnostics: diagnostics,
-	})
+	l.publishDiagnostics(ctx, conn, params.TextDocument.URI)
 }
 
 func (l *lspHandler) handleDidSave(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
@@ -117,17 +207,12 @@ func (l *lspHandler) handleDidSave(ctx context.Context, conn *jsonrpc2.Conn, req
 	json.Unmarshal(*req.Params, &params)
 
 	docID := string(params.TextDocument.URI)
-	doc, ok := l.docs[docID]
-	if !ok {
-		l.logger.Error("document not found: %s", slog.String("docID", docID))
+	if _, ok := l.docs[docID]; !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
 		return
 	}
 
-	_, diagnostics := l.validateKfDocument(docID, doc.rawKf)
-	conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
-		URI:         params.TextDocument.URI,
-		Diagnostics: diagnostics,
-	})
+	l.publishDiagnostics(ctx, conn, params.TextDocument.URI)
 }
 
 func (l *lspHandler) handleDidClose(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
@@ -137,46 +222,703 @@ func (l *lspHandler) handleDidClose(ctx context.Context, conn *jsonrpc2.Conn, re
 }
 
 func (l *lspHandler) handleShutdown(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	conn.Notify(ctx, "exit", req.ID, nil)
+	conn.Reply(ctx, req.ID, nil)
+}
+
+// handleExit ends the session. Other clients of a shared server are not affected.
+func (l *lspHandler) handleExit(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	conn.Close()
 }
 
 func (l *lspHandler) handleCancelRequest(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	// TODO: Should we do anything here?
 }
 
+func (l *lspHandler) handleInitialized(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	l.loadManifests()
+	if l.watchFiles {
+		go l.watchProjectFiles(ctx, conn)
+	}
+	if l.pullSettings {
+		go l.fetchSettings(ctx, conn, l.settingScopes())
+	}
+}
+
+// watchedFiles are the project manifests and the schemas, which may be
+// part of a database split across files.
+var watchedFiles = []string{"**/" + manifestFile, "**/*.kf"}
+
+// watchProjectFiles asks the client to report changes to the watched files.
+// Like fetchSettings, it runs in its own goroutine.
+func (l *lspHandler) watchProjectFiles(ctx context.Context, conn *jsonrpc2.Conn) {
+	var opts didChangeWatchedFilesRegistrationOptions
+	for _, glob := range watchedFiles {
+		opts.Watchers = append(opts.Watchers, fileSystemWatcher{GlobPattern: glob})
+	}
+	params := registrationParams{Registrations: []registration{{
+		ID:              "kuneiform-project-files",
+		Method:          "workspace/didChangeWatchedFiles",
+		RegisterOptions: opts,
+	}}}
+	if err := conn.Call(ctx, "client/registerCapability", params, nil); err != nil {
+		l.logger.Warn("error watching project files", slog.String("err", err.Error()))
+	}
+}
+
+// handleDidChangeWatchedFiles checks the manifests and the open documents
+// again when a manifest or schema changed on disk.
+func (l *lspHandler) handleDidChangeWatchedFiles(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	l.settingsChanged(ctx, conn)
+	l.loadManifests()
+}
+
+// handleDidChangeConfiguration fetches the settings again if the client
+// supports workspace/configuration, or takes them from the notification.
+func (l *lspHandler) handleDidChangeConfiguration(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if l.pullSettings {
+		go l.fetchSettings(ctx, conn, l.settingScopes())
+		return
+	}
+
+	var params struct {
+		Settings map[string]json.RawMessage `json:"settings"`
+	}
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		l.logger.Error("error unmarshalling configuration params", slog.String("err", err.Error()))
+		return
+	}
+	if raw, ok := params.Settings[settingsSection]; ok {
+		l.editorSettings[""] = raw
+		l.settingsChanged(ctx, conn)
+	}
+}
+
+// settingScopes returns the scopes to fetch settings for: the whole
+// workspace, then every folder.
+func (l *lspHandler) settingScopes() []lsp.DocumentURI {
+	return append([]lsp.DocumentURI{""}, l.folders...)
+}
+
+// fetchSettings pulls the settings with workspace/configuration. It runs in
+// its own goroutine, since the response can't be read while a request is
+// being handled.
+func (l *lspHandler) fetchSettings(ctx context.Context, conn *jsonrpc2.Conn, scopes []lsp.DocumentURI) {
+	items := make([]lsp.ConfigurationItem, len(scopes))
+	for i, scope := range scopes {
+		items[i] = lsp.ConfigurationItem{ScopeURI: string(scope), Section: settingsSection}
+	}
+
+	var res []json.RawMessage
+	if err := conn.Call(ctx, "workspace/configuration", lsp.ConfigurationParams{Items: items}, &res); err != nil {
+		l.logger.Warn("error fetching settings", slog.String("err", err.Error()))
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, scope := range scopes {
+		if i < len(res) {
+			l.editorSettings[scope] = res[i]
+		}
+	}
+	l.settingsChanged(ctx, conn)
+}
+
+// settingsChanged applies the logging settings and checks the open
+// documents again, since lint severities may have changed.
+func (l *lspHandler) settingsChanged(ctx context.Context, conn *jsonrpc2.Conn) {
+	clear(l.reported)
+
+	settings, err := resolveSettings(l.editorSettings[""])
+	if err != nil {
+		l.logger.Warn("invalid settings", slog.String("err", err.Error()))
+	}
+	l.applyLogSettings(settings.Logging)
+
+	for uri := range l.docs {
+		l.publishDiagnostics(ctx, conn, lsp.DocumentURI(uri))
+	}
+}
+
+// applyLogSettings applies the "kuneiform.logging" settings. The log file,
+// format and level are shared by the whole process, so sessions of a shared
+// server may only change what is forwarded to their own editor.
+func (l *lspHandler) applyLogSettings(settings logSettings) {
+	if err := l.clientLog.setLevel(settings.withDefaults().ClientLevel); err != nil {
+		l.logger.Warn("invalid logging settings", slog.String("err", err.Error()))
+	}
+	if l.shared {
+		return
+	}
+	if err := logs.configure(settings); err != nil {
+		l.logger.Warn("invalid logging settings", slog.String("err", err.Error()))
+	}
+}
+
+// settingsFor resolves the settings for a document from the settings of its
+// workspace folder and its project file.
+func (l *lspHandler) settingsFor(uri lsp.DocumentURI) serverSettings {
+	editor, ok := l.editorSettings[l.folderOf(uri)]
+	if !ok {
+		editor = l.editorSettings[""]
+	}
+	layers := []json.RawMessage{editor}
+
+	var problems []string
+	var baseDir string
+	var snippets []userSnippet
+	var db *manifestDatabase
+	if path, ok := uriPath(uri); ok {
+		configPath, raw, err := lookupProjectConfig(filepath.Dir(path))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("error reading %s: %v", configPath, err))
+		}
+		layers = append(layers, raw)
+
+		// paths are relative to the project, the workspace folder or the
+		// document, in that order
+		baseDir = filepath.Dir(path)
+		if folder, ok := uriPath(l.folderOf(uri)); ok && configPath == "" {
+			baseDir = folder
+		}
+		baseDir = projectDir(configPath, baseDir)
+
+		var snippetProblems []string
+		snippets, snippetProblems = loadSnippets(filepath.Dir(path))
+		problems = append(problems, snippetProblems...)
+
+		// errors reading the manifest are reported by databaseSource
+		_, _, db, _ = lookupDatabase(path)
+	}
+
+	settings, err := resolveSettings(layers...)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("invalid settings: %v", err))
+	}
+	if db != nil {
+		db.apply(&settings)
+	}
+	settings.baseDir = baseDir
+	settings.snippets = snippets
+	problems = append(problems, settings.problems()...)
+
+	for _, problem := range problems {
+		l.reportProblem(problem)
+	}
+	return settings
+}
+
+// reportProblem logs a problem with the settings or project files, once.
+func (l *lspHandler) reportProblem(problem string) {
+	if !l.reported[problem] {
+		l.reported[problem] = true
+		l.logger.Warn(problem)
+	}
+}
+
+// publishDiagnostics checks a document and publishes its diagnostics. The
+// files of a database split across files are checked together, and the
+// diagnostics of all of them are published.
+func (l *lspHandler) publishDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, uri lsp.DocumentURI) {
+	if src := l.databaseSource(uri); src != nil {
+		_, diagnostics := analyzeKfDocument(src.text, l.settingsFor(uri))
+		byFile := src.splitDiagnostics(diagnostics)
+		for _, f := range src.files {
+			conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+				URI:         f.uri,
+				Diagnostics: byFile[f.uri],
+			})
+		}
+		return
+	}
+
+	_, diagnostics := l.validateKfDocument(string(uri), l.docs[string(uri)].rawKf)
+	conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// folderOf returns the innermost workspace folder containing the document,
+// or the empty URI.
+func (l *lspHandler) folderOf(uri lsp.DocumentURI) lsp.DocumentURI {
+	var folder lsp.DocumentURI
+	for _, f := range l.folders {
+		prefix := strings.TrimSuffix(string(f), "/") + "/"
+		if strings.HasPrefix(string(uri), prefix) && len(f) > len(folder) {
+			folder = f
+		}
+	}
+	return folder
+}
+
 func (l *lspHandler) handleDocumentSymbol(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
-	// TODO: Extract action, procedures, tables, extension methods, foreign procedures, etc.
-	// params := lsp.DocumentSymbolParams{}
-	// json.Unmarshal(*req.Params, &params)
+	params := lsp.DocumentSymbolParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling document symbol params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		conn.Reply(ctx, req.ID, src.fileSymbols(params.TextDocument.URI, getDocumentSymbols(params.TextDocument.URI, src.text, res)))
+		return
+	}
+	conn.Reply(ctx, req.ID, getDocumentSymbols(params.TextDocument.URI, doc.rawKf, doc.parsedSchema))
+}
+
+func (l *lspHandler) handleFormatting(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.DocumentFormattingParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling formatting params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	settings := l.settingsFor(params.TextDocument.URI)
+	opts := settings.formatOptions(params.Options.TabSize, params.Options.InsertSpaces)
+
+	formatted, err := formatKf(doc.rawKf, opts)
+	if err != nil {
+		// unbalanced braces are already reported by the diagnostics
+		l.logger.Debug("not formatting document", slog.String("docID", docID), slog.String("err", err.Error()))
+		conn.Reply(ctx, req.ID, []lsp.TextEdit{})
+		return
+	}
+
+	conn.Reply(ctx, req.ID, []lsp.TextEdit{
+		{
+			Range:   lsp.Range{End: endPosition(doc.rawKf)},
+			NewText: formatted,
+		},
+	})
+}
+
+func (l *lspHandler) handleFoldingRange(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := foldingRangeParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling folding range params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src := l.databaseSource(params.TextDocument.URI); src != nil {
+		conn.Reply(ctx, req.ID, src.fileFoldingRanges(params.TextDocument.URI, getFoldingRanges(src.text)))
+		return
+	}
+	conn.Reply(ctx, req.ID, getFoldingRanges(doc.rawKf))
+}
+
+func (l *lspHandler) handleSelectionRange(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := selectionRangeParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling selection range params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src := l.databaseSource(params.TextDocument.URI); src != nil {
+		positions := make([]lsp.Position, len(params.Positions))
+		for i, pos := range params.Positions {
+			positions[i] = src.toMerged(params.TextDocument.URI, pos)
+		}
+		ranges := getSelectionRanges(src.text, positions)
+		for i := range ranges {
+			ranges[i] = src.fileSelectionRange(params.TextDocument.URI, ranges[i])
+		}
+		conn.Reply(ctx, req.ID, ranges)
+		return
+	}
+	conn.Reply(ctx, req.ID, getSelectionRanges(doc.rawKf, params.Positions))
+}
+
+func (l *lspHandler) handleDocumentHighlight(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.TextDocumentPositionParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling document highlight params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		highlights := make([]lsp.DocumentHighlight, 0)
+		for _, h := range getDocumentHighlights(src.text, res, src.toMerged(params.TextDocument.URI, params.Position)) {
+			if rng, ok := src.inFile(params.TextDocument.URI, h.Range); ok {
+				h.Range = rng
+				highlights = append(highlights, h)
+			}
+		}
+		conn.Reply(ctx, req.ID, highlights)
+		return
+	}
+	conn.Reply(ctx, req.ID, getDocumentHighlights(doc.rawKf, doc.currentParse(), params.Position))
+}
+
+func (l *lspHandler) handleHover(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.TextDocumentPositionParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling hover params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		h := getHover(src.text, res, src.toMerged(params.TextDocument.URI, params.Position))
+		if h != nil && h.Range != nil {
+			_, rng := src.toFile(*h.Range)
+			h.Range = &rng
+		}
+		conn.Reply(ctx, req.ID, h)
+		return
+	}
+	conn.Reply(ctx, req.ID, getHover(doc.rawKf, doc.currentParse(), params.Position))
+}
+
+func (l *lspHandler) handleSignatureHelp(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.TextDocumentPositionParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling signature help params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		conn.Reply(ctx, req.ID, getSignatureHelp(src.text, res, src.text, src.toMerged(params.TextDocument.URI, params.Position)))
+		return
+	}
+	// while typing a call the document rarely parses, so use the last
+	// valid parse for the declarations
+	conn.Reply(ctx, req.ID, getSignatureHelp(doc.rawKf, doc.parsedSchema, doc.parsedKf, params.Position))
+}
+
+func (l *lspHandler) handleInlayHint(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := inlayHintParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling inlay hint params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		rng := lsp.Range{
+			Start: src.toMerged(params.TextDocument.URI, params.Range.Start),
+			End:   src.toMerged(params.TextDocument.URI, params.Range.End),
+		}
+		conn.Reply(ctx, req.ID, src.fileInlayHints(params.TextDocument.URI, getInlayHints(src.text, res, rng)))
+		return
+	}
+	conn.Reply(ctx, req.ID, getInlayHints(doc.rawKf, doc.currentParse(), params.Range))
+}
+
+func (l *lspHandler) handleReferences(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.ReferenceParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling references params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		refs := getReferences(params.TextDocument.URI, src.text, res, src.toMerged(params.TextDocument.URI, params.Position), params.Context.IncludeDeclaration)
+		conn.Reply(ctx, req.ID, src.toFileLocations(refs))
+		return
+	}
+	conn.Reply(ctx, req.ID, getReferences(params.TextDocument.URI, doc.rawKf, doc.currentParse(), params.Position, params.Context.IncludeDeclaration))
+}
+
+func (l *lspHandler) handleCodeLens(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.CodeLensParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling code lens params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		conn.Reply(ctx, req.ID, src.fileCodeLenses(params.TextDocument.URI, getCodeLenses(params.TextDocument.URI, src.text, res)))
+		return
+	}
+	conn.Reply(ctx, req.ID, getCodeLenses(params.TextDocument.URI, doc.rawKf, doc.currentParse()))
+}
+
+func (l *lspHandler) handlePrepareCallHierarchy(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := lsp.TextDocumentPositionParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling call hierarchy params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		items := prepareCallHierarchy(params.TextDocument.URI, src.text, res, src.toMerged(params.TextDocument.URI, params.Position))
+		for i := range items {
+			items[i] = src.toFileItem(items[i])
+		}
+		conn.Reply(ctx, req.ID, items)
+		return
+	}
+	conn.Reply(ctx, req.ID, prepareCallHierarchy(params.TextDocument.URI, doc.rawKf, doc.currentParse(), params.Position))
+}
+
+func (l *lspHandler) handleIncomingCalls(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := callHierarchyCallsParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling incoming calls params", slog.String("err", err.Error()))
+		return
+	}
+
+	// the item may be declared in a file of the database that isn't open
+	if src, res := l.databaseParse(params.Item.URI); src != nil {
+		calls := getIncomingCalls(params.Item.URI, src.text, res, params.Item)
+		for i := range calls {
+			calls[i].From = src.toFileItem(calls[i].From)
+			calls[i].FromRanges = src.toFileRanges(calls[i].FromRanges)
+		}
+		conn.Reply(ctx, req.ID, calls)
+		return
+	}
+
+	docID := string(params.Item.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	conn.Reply(ctx, req.ID, getIncomingCalls(params.Item.URI, doc.rawKf, doc.currentParse(), params.Item))
+}
+
+func (l *lspHandler) handleOutgoingCalls(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := callHierarchyCallsParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling outgoing calls params", slog.String("err", err.Error()))
+		return
+	}
+
+	// the item may be declared in a file of the database that isn't open
+	if src, res := l.databaseParse(params.Item.URI); src != nil {
+		calls := getOutgoingCalls(params.Item.URI, src.text, res, params.Item)
+		for i := range calls {
+			calls[i].To = src.toFileItem(calls[i].To)
+			calls[i].FromRanges = src.toFileRanges(calls[i].FromRanges)
+		}
+		conn.Reply(ctx, req.ID, calls)
+		return
+	}
+
+	docID := string(params.Item.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	conn.Reply(ctx, req.ID, getOutgoingCalls(params.Item.URI, doc.rawKf, doc.currentParse(), params.Item))
+}
+
+// handleDataAccess reports the tables and columns each action and procedure
+// of a document accesses.
+func (l *lspHandler) handleDataAccess(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := documentParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling data access params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		// only the methods declared in the document
+		methods := slices.DeleteFunc(getDataAccess(res), func(m methodDataAccess) bool {
+			return !src.declaredIn(res, m.Name, params.TextDocument.URI)
+		})
+		conn.Reply(ctx, req.ID, methods)
+		return
+	}
+	conn.Reply(ctx, req.ID, getDataAccess(doc.currentParse()))
+}
+
+// handleSchemaDiff compares a document with another version of it.
+func (l *lspHandler) handleSchemaDiff(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := schemaDiffParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling schema diff params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	baseText, current := params.Base, doc.currentParse()
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		// the base is another version of the document in its database
+		baseText, current = src.withText(params.TextDocument.URI, params.Base).text, res
+	}
+	base, _ := parse.ParseAndValidate([]byte(baseText))
+	switch {
+	case base == nil || base.Err() != nil:
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "the base schema has errors"})
+	case current == nil || current.Err() != nil:
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: docID + " has errors"})
+	default:
+		conn.Reply(ctx, req.ID, diffSchemas(base, current))
+	}
+}
+
+// handleCompiledSchema replies with the schema of a document as it would be
+// deployed.
+func (l *lspHandler) handleCompiledSchema(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params := documentParams{}
+	err := json.Unmarshal(*req.Params, &params)
+	if err != nil {
+		l.logger.Error("error unmarshalling compiled schema params", slog.String("err", err.Error()))
+		return
+	}
+
+	docID := string(params.TextDocument.URI)
+	doc, ok := l.docs[docID]
+	if !ok {
+		l.logger.Error("document not found", slog.String("docID", docID))
+		return
+	}
+
+	res := l.documentSchema(params.TextDocument.URI, doc)
+	if res == nil || res.Schema == nil || res.Err() != nil {
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: docID + " has errors"})
+		return
+	}
+	conn.Reply(ctx, req.ID, res.Schema)
+}
+
+// documentSchema returns the parse of the whole schema a document is part
+// of: the database it belongs to, or else the document.
+func (l *lspHandler) documentSchema(uri lsp.DocumentURI, doc *kfDocs) *parse.SchemaParseResult {
+	if src, res := l.databaseParse(uri); src != nil {
+		return res
+	}
+	return doc.currentParse()
 }
 
 func (l *lspHandler) handleDefinition(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	params := lsp.TextDocumentPositionParams{}
 	err := json.Unmarshal(*req.Params, &params)
 	if err != nil {
-		l.logger.Error("error unmarshalling definition params: %v", slog.String("err", err.Error()))
+		l.logger.Error("error unmarshalling definition params", slog.String("err", err.Error()))
 		return
 	}
 
-	l.logger.Debug("Definition params: ", slog.Any("", params))
+	l.logger.Debug("definition", slog.String("uri", string(params.TextDocument.URI)),
+		slog.Int("line", params.Position.Line), slog.Int("character", params.Position.Character))
 
 	docID := string(params.TextDocument.URI)
 	doc, ok := l.docs[docID]
 	if !ok {
-		l.logger.Error("document not found: %s", slog.String("docID", docID))
+		l.logger.Error("document not found", slog.String("docID", docID))
 		return
 	}
 
 	token, err := l.getToken(doc.rawKf, params.Position.Line, params.Position.Character)
 	if err != nil {
-		l.logger.Error("Error getting token at position: ", slog.String("err", err.Error()))
+		l.logger.Error("error getting token at position", slog.String("err", err.Error()))
 		return
 	}
 
-	l.logger.Debug("Definition offset: ", slog.String("token", token))
-
 	loc := getTokenPosition(params.TextDocument.URI, doc.parsedSchema, token)
-	l.logger.Debug("Definition location: ", slog.Any("", loc))
+	if src, res := l.databaseParse(params.TextDocument.URI); src != nil {
+		loc = src.toFileLocations(getTokenPosition(params.TextDocument.URI, res, token))
+	}
+	l.logger.Debug("definition location", slog.String("token", token), slog.Any("location", loc))
 
 	conn.Reply(ctx, req.ID, loc)
 }
@@ -185,30 +927,35 @@ func (l *lspHandler) handleCompletion(ctx context.Context, conn *jsonrpc2.Conn,
 	params := lsp.CompletionParams{}
 	err := json.Unmarshal(*req.Params, &params)
 	if err != nil {
-		l.logger.Error("error unmarshalling completion params: ", slog.String("err", err.Error()))
+		l.logger.Error("error unmarshalling completion params", slog.String("err", err.Error()))
 		return
 	}
 
 	docID := string(params.TextDocument.URI)
 	doc, ok := l.docs[docID]
 	if !ok {
-		l.logger.Error("document not found: %s", slog.String("docID", docID))
+		l.logger.Error("document not found", slog.String("docID", docID))
 		return
 	}
 
-	_, ds := l.validateKfDocument(docID, doc.rawKf)
-	conn.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
-		URI:         params.TextDocument.URI,
-		Diagnostics: ds,
-	})
+	l.publishDiagnostics(ctx, conn, params.TextDocument.URI)
+
+	// the cursor is in the current text, while the names and doc comments
+	// come from the last valid parse; files of a database split across
+	// files complete in the merged source
+	current, text, res, pos := doc.rawKf, doc.parsedKf, doc.parsedSchema, params.Position
+	if src, merged := l.databaseParse(params.TextDocument.URI); src != nil {
+		current, text, res, pos = src.text, src.text, merged, src.toMerged(params.TextDocument.URI, pos)
+	}
 
-	offset, err := l.getOffset(doc.rawKf, params.Position.Line, params.Position.Character)
+	offset, err := l.getOffset(current, pos.Line, pos.Character)
 	if err != nil {
-		l.logger.Error("Error getting completionTriggerCharacter offset: ", slog.String("err", err.Error()))
+		l.logger.Error("error getting completion offset", slog.String("err", err.Error()))
 		return
 	}
 
-	items := l.getCompletionItems(doc.parsedSchema, offset)
+	settings := l.settingsFor(params.TextDocument.URI)
+	items := l.getCompletionItems(text, res, offset, &settings)
 	l.printSuggestions(items)
 	conn.Reply(ctx, req.ID, items)
 }
@@ -223,10 +970,27 @@ func (l *lspHandler) printSuggestions(items []lsp.CompletionItem) {
 	for _, item := range items {
 		labels = append(labels, item.Label)
 	}
-	l.logger.Debug("Suggestions: ", slog.Any("", labels))
+	l.logger.Debug("suggestions", slog.Any("labels", labels))
 }
 
 func (l *lspHandler) validateKfDocument(uri string, text string) (*parse.SchemaParseResult, []lsp.Diagnostic) {
+	res, diagnostics := analyzeKfDocument(text, l.settingsFor(lsp.DocumentURI(uri)))
+	if res != nil && len(res.ParseErrs.Errors()) == 0 {
+		doc, ok := l.docs[uri]
+		if !ok {
+			doc = &kfDocs{rawKf: text}
+			l.docs[uri] = doc
+		}
+		doc.parsedSchema = res
+		doc.parsedKf = text
+	}
+
+	return res, diagnostics
+}
+
+// analyzeKfDocument parses and validates a document. It is shared by the
+// language server and the command line, so both report the same diagnostics.
+func analyzeKfDocument(text string, settings serverSettings) (*parse.SchemaParseResult, []lsp.Diagnostic) {
 	res, err := parse.ParseAndValidate([]byte(text))
 	if err != nil {
 		return nil, []lsp.Diagnostic{
@@ -237,15 +1001,8 @@ func (l *lspHandler) validateKfDocument(uri string, text string) (*parse.SchemaP
 		}
 	}
 
-	if len(res.ParseErrs.Errors()) == 0 {
-		doc, ok := l.docs[uri]
-		if !ok {
-			l.docs[uri] = &kfDocs{rawKf: text}
-		}
-		doc.parsedSchema = res
-	}
-
-	return res, getDiagnostics(res)
+	diagnostics := append(getDiagnostics(res), runLints(text, res, settings.Lint)...)
+	return res, append(diagnostics, checkCompatibility(text, res, settings)...)
 }
 
 // getOffset returns the offset of the given line and column in the text
@@ -293,6 +1050,15 @@ func (l *lspHandler) getToken(text string, line, col int) (string, error) {
 	return "", fmt.Errorf("no token found at line %d, col %d", line, col)
 }
 
+// endPosition returns the position just past the last character of the text.
+func endPosition(text string) lsp.Position {
+	line := strings.Count(text, "\n")
+	return lsp.Position{
+		Line:      line,
+		Character: len(text) - strings.LastIndex(text, "\n") - 1,
+	}
+}
+
 // isTokenChar checks if the character is alphanumeric or an underscore
 func isTokenChar(ch rune) bool {
 	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_'
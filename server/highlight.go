@@ -0,0 +1,330 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Document highlights for the name under the cursor: $variables within their
+// action or procedure, @contextual variables, tables, columns and actions or
+// procedures. Occurrences are found with the lexer; the ASTs tell which of
+// them assign a variable or write a column, and which table a column belongs
+// to.
+
+// tokenKey identifies a token by its zero based line and column.
+type tokenKey struct {
+	line, col int
+}
+
+func getDocumentHighlights(text string, r *parse.SchemaParseResult, pos lsp.Position) []lsp.DocumentHighlight {
+	toks := lexKf(text)
+	i := tokenIndexAt(toks, positionOffset(lineOffsets(text), pos))
+	if i < 0 {
+		return nil
+	}
+
+	tok := toks[i]
+	switch {
+	case tok.kind == tokVariable && strings.HasPrefix(tok.text, "@"):
+		return highlightTokens(toks, 0, len(toks), func(j int) (int, bool) {
+			return lsp.Read, toks[j].kind == tokVariable && toks[j].is(tok.text)
+		})
+	case tok.kind == tokVariable:
+		return highlightVariable(toks, r, i)
+	case tok.kind == tokIdent && r != nil && r.Schema != nil:
+		return highlightName(toks, r, i)
+	}
+	return nil
+}
+
+// highlightTokens highlights the tokens in toks[from:to] accepted by match.
+func highlightTokens(toks []token, from, to int, match func(i int) (kind int, ok bool)) []lsp.DocumentHighlight {
+	var highlights []lsp.DocumentHighlight
+	for i := from; i < to; i++ {
+		if kind, ok := match(i); ok {
+			highlights = append(highlights, lsp.DocumentHighlight{Range: tokenRange(toks[i]), Kind: kind})
+		}
+	}
+	return highlights
+}
+
+// highlightVariable highlights a $variable in the action or procedure it is
+// used in. Parameters, declarations and assignments are writes.
+func highlightVariable(toks []token, r *parse.SchemaParseResult, i int) []lsp.DocumentHighlight {
+	from, to, body := 0, len(toks), -1
+	if r != nil && r.SchemaInfo != nil {
+		for _, block := range r.SchemaInfo.Blocks {
+			if toks[i].offset < block.AbsStart || toks[i].offset > block.AbsEnd {
+				continue
+			}
+			from, to = len(toks), len(toks)
+			for j, tok := range toks {
+				if tok.offset >= block.AbsStart && from == len(toks) {
+					from = j
+				}
+				if body < 0 && from < len(toks) && tok.text == "{" {
+					body = j
+				}
+				if tok.offset > block.AbsEnd {
+					to = j
+					break
+				}
+			}
+			break
+		}
+	}
+
+	writes := variableWrites(toks, r)
+	return highlightTokens(toks, from, to, func(j int) (int, bool) {
+		if toks[j].kind != tokVariable || !toks[j].is(toks[i].text) {
+			return 0, false
+		}
+		if j < body || writes[tokenKey{toks[j].line, toks[j].col}] {
+			return lsp.Write, true
+		}
+		return lsp.Read, true
+	})
+}
+
+// variableWrites returns the variables assigned by declarations, assignments,
+// loops and calls.
+func variableWrites(toks []token, r *parse.SchemaParseResult) map[tokenKey]bool {
+	writes := make(map[tokenKey]bool)
+	add := func(e parse.Node) {
+		if arr, ok := e.(*parse.ExpressionArrayAccess); ok {
+			e = arr.Array
+		}
+		if v, ok := e.(*parse.ExpressionVariable); ok && hasPosition(&v.Position) {
+			writes[tokenKey{v.StartLine - 1, v.StartCol}] = true
+		}
+	}
+
+	walkBodies(r, func(method string, n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ProcedureStmtDeclaration:
+			add(n.Variable)
+		case *parse.ProcedureStmtAssign:
+			add(n.Variable)
+		case *parse.ProcedureStmtForLoop:
+			add(n.Receiver)
+		case *parse.ProcedureStmtCall:
+			for _, v := range n.Receivers {
+				add(v)
+			}
+		case *parse.ActionStmtExtensionCall:
+			// receivers are only names, so find them before the =
+			if !hasPosition(&n.Position) {
+				break
+			}
+			for j := tokenIndexAt(toks, tokenOffset(toks, n.StartLine-1, n.StartCol)); j >= 0 && j < len(toks); j++ {
+				if toks[j].text == "=" {
+					break
+				}
+				if toks[j].kind == tokVariable {
+					writes[tokenKey{toks[j].line, toks[j].col}] = true
+				}
+			}
+		}
+		return true
+	})
+	return writes
+}
+
+// highlightName highlights a table, column, action or procedure name.
+func highlightName(toks []token, r *parse.SchemaParseResult, i int) []lsp.DocumentHighlight {
+	name := normalizeIdent(toks[i].text)
+	isTable, isColumn, isMethod := false, false, false
+	for _, table := range r.Schema.Tables {
+		isTable = isTable || strings.EqualFold(table.Name, name)
+		for _, col := range table.Columns {
+			isColumn = isColumn || strings.EqualFold(col.Name, name)
+		}
+	}
+	for _, method := range append(append(getActions(r), getProcedures(r)...), foreignProcedureNames(r)...) {
+		isMethod = isMethod || strings.EqualFold(method, name)
+	}
+
+	// a name used both ways is resolved by the context of the cursor
+	if isTable && isColumn {
+		isColumn = !isTableReference(toks, i)
+		isTable = !isColumn
+	}
+
+	switch {
+	case isTable:
+		return highlightTokens(toks, 0, len(toks), func(j int) (int, bool) {
+			if !isNameToken(toks, j, name) || (isColumn && !isTableReference(toks, j)) {
+				return 0, false
+			}
+			return tableAccess(toks, j), true
+		})
+	case isColumn:
+		// only the occurrences of the same table.column
+		resolver := newColumnResolver(toks, r)
+		table := resolver.table(i)
+		if table == nil {
+			return nil
+		}
+		defs, writes := columnDefinitions(toks, r), columnWrites(toks, r)
+		return highlightTokens(toks, 0, len(toks), func(j int) (int, bool) {
+			if !isNameToken(toks, j, name) || (isTable && isTableReference(toks, j)) {
+				return 0, false
+			}
+			if t := resolver.table(j); t == nil || !strings.EqualFold(t.Name, table.Name) {
+				return 0, false
+			}
+			if defs[tokenKey{toks[j].line, toks[j].col}] {
+				return int(lsp.Text), true
+			}
+			if writes[tokenKey{toks[j].line, toks[j].col}] {
+				return lsp.Write, true
+			}
+			return lsp.Read, true
+		})
+	case isMethod:
+		return highlightTokens(toks, 0, len(toks), func(j int) (int, bool) {
+			if !isNameToken(toks, j, name) {
+				return 0, false
+			}
+			if prev, ok := prevToken(toks, j); ok && (prev.is("action") || prev.is("procedure")) {
+				return int(lsp.Text), true
+			}
+			return lsp.Read, true
+		})
+	}
+	return nil
+}
+
+func foreignProcedureNames(r *parse.SchemaParseResult) []string {
+	var names []string
+	for _, proc := range r.Schema.ForeignProcedures {
+		names = append(names, proc.Name)
+	}
+	return names
+}
+
+// isNameToken reports whether toks[i] is the identifier name, and not a
+// field or method of something else.
+func isNameToken(toks []token, i int, name string) bool {
+	if toks[i].kind != tokIdent || !toks[i].is(name) {
+		return false
+	}
+	prev, ok := prevToken(toks, i)
+	return !ok || prev.text != "." || isQualifiedColumn(toks, i)
+}
+
+// isQualifiedColumn reports whether toks[i] is the column in table.column.
+func isQualifiedColumn(toks []token, i int) bool {
+	return i >= 2 && toks[i-1].text == "." && toks[i-2].kind == tokIdent
+}
+
+// isTableReference reports whether the identifier at i names a table rather
+// than a column, judging by the keyword before it.
+func isTableReference(toks []token, i int) bool {
+	if i+1 < len(toks) && toks[i+1].text == "." {
+		return true
+	}
+	prev, ok := prevToken(toks, i)
+	if !ok {
+		return false
+	}
+	for _, kw := range []string{"table", "from", "join", "into", "update", "references"} {
+		if prev.is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableAccess classifies a table reference: its declaration is text, the
+// target of INSERT, UPDATE or DELETE a write, anything else a read.
+func tableAccess(toks []token, i int) int {
+	prev, ok := prevToken(toks, i)
+	if !ok {
+		return lsp.Read
+	}
+	switch {
+	case prev.is("table"):
+		return int(lsp.Text)
+	case prev.is("into"), prev.is("update"):
+		return lsp.Write
+	case prev.is("from"):
+		if j := i - 2; j >= 0 && toks[j].is("delete") {
+			return lsp.Write
+		}
+	}
+	return lsp.Read
+}
+
+// columnDefinitions returns the names starting the items of table blocks.
+func columnDefinitions(toks []token, r *parse.SchemaParseResult) map[tokenKey]bool {
+	defs := make(map[tokenKey]bool)
+	if r.SchemaInfo == nil {
+		return defs
+	}
+	for _, block := range r.SchemaInfo.Blocks {
+		open, _, ok := blockBody(toks, block)
+		if !ok || !isTableBlock(toks, block) {
+			continue
+		}
+		depth := 0
+		for i := open + 1; i < len(toks) && toks[i].offset < block.AbsEnd; i++ {
+			switch toks[i].text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if prev, _ := prevToken(toks, i); depth == 0 && toks[i].kind == tokIdent && (prev.text == "{" || prev.text == ",") {
+				defs[tokenKey{toks[i].line, toks[i].col}] = true
+			}
+		}
+	}
+	return defs
+}
+
+// columnWrites returns the columns written by UPDATE SET clauses and listed
+// by INSERT statements.
+func columnWrites(toks []token, r *parse.SchemaParseResult) map[tokenKey]bool {
+	writes := make(map[tokenKey]bool)
+	walkBodies(r, func(method string, n parse.Node) bool {
+		if set, ok := n.(*parse.UpdateSetClause); ok && hasPosition(&set.Position) {
+			writes[tokenKey{set.StartLine - 1, set.StartCol}] = true
+		}
+		return true
+	})
+
+	// INSERT INTO table (columns...)
+	for i := 0; i+2 < len(toks); i++ {
+		if !toks[i].is("into") || toks[i+2].text != "(" {
+			continue
+		}
+		for j := i + 3; j < len(toks) && toks[j].text != ")"; j++ {
+			if toks[j].kind == tokIdent {
+				writes[tokenKey{toks[j].line, toks[j].col}] = true
+			}
+		}
+	}
+	return writes
+}
+
+// prevToken returns the token before toks[i], skipping comments.
+func prevToken(toks []token, i int) (token, bool) {
+	for j := i - 1; j >= 0; j-- {
+		if toks[j].kind != tokComment {
+			return toks[j], true
+		}
+	}
+	return token{}, false
+}
+
+// tokenOffset returns the offset of the token starting at a zero based line
+// and column, or -1.
+func tokenOffset(toks []token, line, col int) int {
+	if tok, ok := tokenAt(toks, line, col); ok {
+		return tok.offset
+	}
+	return -1
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_DocumentHighlights(t *testing.T) {
+	src := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+action rename($id, $name) public {
+    UPDATE users SET name = $name WHERE id = $id;
+}
+
+action add($id, $name) public {
+    INSERT INTO users (id, name) VALUES ($id, $name);
+}
+
+procedure count_users() public view returns (total int) {
+    $total int := 0;
+    for $row in SELECT * FROM users {
+        $total := $total + 1;
+    }
+    return $total;
+}
+
+action get_name($id) public view {
+    SELECT name FROM users WHERE users.id = $id;
+}
+`
+	lines := strings.Split(src, "\n")
+	res, _ := parse.ParseAndValidate([]byte(src))
+	kinds := map[int]string{1: "text", 2: "read", 3: "write"}
+
+	tests := []struct {
+		pos  lsp.Position
+		want []string
+	}{
+		{
+			// $name in rename, but not in add
+			pos:  lsp.Position{Line: 8, Character: 29},
+			want: []string{"7:19 write", "8:28 read"},
+		},
+		{
+			pos:  lsp.Position{Line: 18, Character: 10},
+			want: []string{"16:4 write", "18:8 write", "18:18 read", "20:11 read"},
+		},
+		{
+			pos:  lsp.Position{Line: 4, Character: 5},
+			want: []string{"4:4 text", "8:21 write", "12:27 write", "24:11 read"},
+		},
+		{
+			pos:  lsp.Position{Line: 8, Character: 12},
+			want: []string{"2:6 text", "8:11 write", "12:16 write", "17:30 read", "24:21 read", "24:33 read"},
+		},
+		{
+			// the column in users.id
+			pos:  lsp.Position{Line: 24, Character: 39},
+			want: []string{"3:4 text", "8:40 read", "12:23 write", "24:39 read"},
+		},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, h := range getDocumentHighlights(src, res, tt.pos) {
+			got = append(got, fmt.Sprintf("%d:%d %s", h.Range.Start.Line, h.Range.Start.Character, kinds[h.Kind]))
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("at %v (%q): expected %v, got %v", tt.pos, lines[tt.pos.Line], tt.want, got)
+		}
+	}
+}
+
+func Test_DocumentHighlightsResolveColumns(t *testing.T) {
+	src := `database blog;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+table posts {
+    id uuid primary key,
+    author uuid notnull,
+    name text notnull,
+    foreign key (author) references users(id)
+}
+
+action rename_post($id, $name) public {
+    UPDATE posts SET name = $name WHERE id = $id;
+}
+
+action get_author($id) public view {
+    SELECT u.name FROM posts AS p INNER JOIN users AS u ON p.author = u.id WHERE p.id = $id;
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pos  lsp.Position
+		want []string
+	}{
+		{"users.id", lsp.Position{Line: 3, Character: 5}, []string{"3:4", "11:42", "19:72"}},
+		{"posts.id", lsp.Position{Line: 15, Character: 41}, []string{"8:4", "15:40", "19:83"}},
+		{"users.name", lsp.Position{Line: 19, Character: 14}, []string{"4:4", "19:13"}},
+		{"posts.name", lsp.Position{Line: 15, Character: 22}, []string{"10:4", "15:21"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, h := range getDocumentHighlights(src, res, tt.pos) {
+			got = append(got, fmt.Sprintf("%d:%d", h.Range.Start.Line, h.Range.Start.Character))
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// hover names the table the column belongs to
+	if h := getHover(src, res, lsp.Position{Line: 15, Character: 41}); h == nil || !strings.Contains(h.Contents.Value, "posts.id uuid") {
+		t.Errorf("unexpected hover %+v", h)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Hover shows the declaration of the table, column, action, procedure or
+// parameter under the cursor, with its doc comment.
+
+func getHover(text string, r *parse.SchemaParseResult, pos lsp.Position) *hover {
+	if r == nil || r.Schema == nil {
+		return nil
+	}
+	toks := lexKf(text)
+	i := tokenIndexAt(toks, positionOffset(lineOffsets(text), pos))
+	if i < 0 {
+		return nil
+	}
+
+	docs := collectDocComments(text, r)
+	var decl, doc string
+	switch tok := toks[i]; tok.kind {
+	case tokVariable:
+		decl, doc = hoverParameter(toks, r, docs, i)
+	case tokIdent:
+		decl, doc = hoverName(toks, r, docs, i)
+	}
+	if decl == "" {
+		return nil
+	}
+
+	value := "```kuneiform\n" + decl + "\n```"
+	if doc != "" {
+		value += "\n\n" + doc
+	}
+	rng := tokenRange(toks[i])
+	return &hover{Contents: markupContent{Kind: markupMarkdown, Value: value}, Range: &rng}
+}
+
+// hoverName describes a table, column, action, procedure or foreign
+// procedure name.
+func hoverName(toks []token, r *parse.SchemaParseResult, docs declarationDocs, i int) (string, string) {
+	name := normalizeIdent(toks[i].text)
+	if prev, ok := prevToken(toks, i); ok && prev.text == "." && !isQualifiedColumn(toks, i) {
+		return "", "" // extension method
+	}
+
+	if signature, params, _, ok := methodSignature(r, name); ok && !isQualifiedColumn(toks, i) {
+		return signature, docs.of(name).markdown(params)
+	}
+
+	table, isTable := r.Schema.FindTable(name)
+	column := newColumnResolver(toks, r).table(i)
+	if isTable && (column == nil || isTableReference(toks, i)) {
+		return "table " + table.Name, docs.of(table.Name).markdown(nil)
+	}
+	if column == nil {
+		return "", ""
+	}
+
+	col, _ := column.FindColumn(name)
+	decl := fmt.Sprintf("%s.%s %s", column.Name, col.Name, col.Type.String())
+	for _, attr := range col.Attributes {
+		decl += " " + attributeText(attr)
+	}
+	return decl, docs.column(column.Name, col.Name).markdown(nil)
+}
+
+// hoverParameter describes a parameter of the action or procedure the
+// variable is used in.
+func hoverParameter(toks []token, r *parse.SchemaParseResult, docs declarationDocs, i int) (string, string) {
+	method := enclosingMethod(r, toks[i].offset)
+	if method == "" {
+		return "", ""
+	}
+	_, params, labels, _ := methodSignature(r, method)
+	for j, param := range params {
+		if toks[i].is(param) {
+			doc := fmt.Sprintf("Parameter of %s.", method)
+			if d := docs.of(method).param(param); d != "" {
+				doc += "\n\n" + d
+			}
+			return labels[j], doc
+		}
+	}
+	return "", ""
+}
+
+// columnResolver resolves column names to the table they belong to: the
+// table they are declared in, the table a foreign key references, or the
+// tables of the SQL statement they are used in, as data access does.
+type columnResolver struct {
+	toks       []token
+	r          *parse.SchemaParseResult
+	statements []statementScope
+}
+
+// statementScope is a SQL statement spanning the tokens from start to end.
+type statementScope struct {
+	start, end int
+	scope      *sqlScope
+}
+
+func newColumnResolver(toks []token, r *parse.SchemaParseResult) *columnResolver {
+	c := &columnResolver{toks: toks, r: r}
+	walkBodies(r, func(method string, n parse.Node) bool {
+		if stmt, ok := n.(*parse.SQLStatement); ok && hasPosition(&stmt.Position) {
+			start := tokenIndexAt(toks, tokenOffset(toks, stmt.StartLine-1, stmt.StartCol))
+			end := tokenIndexAt(toks, tokenOffset(toks, stmt.EndLine-1, stmt.EndCol))
+			if start >= 0 && end >= start {
+				c.statements = append(c.statements, statementScope{start, end, newSQLScope(r.Schema, stmt)})
+			}
+		}
+		return true
+	})
+	return c
+}
+
+// table returns the table of the column named at i, or nil if it cannot be
+// resolved.
+func (c *columnResolver) table(i int) *types.Table {
+	toks, name := c.toks, c.toks[i].text
+	var qualifier string
+	if isQualifiedColumn(toks, i) {
+		qualifier = toks[i-2].text
+	}
+
+	resolved := ""
+	if c.r.SchemaInfo != nil {
+		for blockName, block := range c.r.SchemaInfo.Blocks {
+			if toks[i].offset >= block.AbsStart && toks[i].offset <= block.AbsEnd && isTableBlock(toks, block) {
+				resolved = blockName
+				if ref, ok := referencedTable(toks, i); ok {
+					resolved = ref
+				}
+			}
+		}
+	}
+	if resolved == "" {
+		// statements nested in others come later
+		for j := len(c.statements) - 1; j >= 0; j-- {
+			if stmt := c.statements[j]; stmt.start <= i && i <= stmt.end {
+				resolved = stmt.scope.columnTable(qualifier, name)
+				break
+			}
+		}
+	}
+
+	table, ok := c.r.Schema.FindTable(resolved)
+	if !ok {
+		return nil
+	}
+	if _, ok := table.FindColumn(name); !ok {
+		return nil
+	}
+	return table
+}
+
+// referencedTable returns the table of a foreign key whose columns are listed
+// around i, as in references users(id).
+func referencedTable(toks []token, i int) (string, bool) {
+	depth := 0
+	for j := i - 1; j >= 2; j-- {
+		switch toks[j].text {
+		case "{", "}", ";":
+			return "", false
+		case ")":
+			depth++
+		case "(":
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if toks[j-1].kind == tokIdent && toks[j-2].is("references") {
+				return toks[j-1].text, true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// enclosingMethod returns the action or procedure declared around offset.
+func enclosingMethod(r *parse.SchemaParseResult, offset int) string {
+	if r.SchemaInfo == nil {
+		return ""
+	}
+	for name, block := range r.SchemaInfo.Blocks {
+		if offset < block.AbsStart || offset > block.AbsEnd {
+			continue
+		}
+		if isAction(r, name) || isProcedure(r, name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const docCommentSchema = `database bank;
+
+// accounts hold balances.
+table accounts {
+    id int primary key,
+    // balance in the smallest unit
+    balance int notnull
+}
+
+// Moves tokens between two accounts.
+// @param $from the paying account
+// @param $amount how much to send,
+//   in the smallest unit
+action transfer($from, $to, $amount) public {
+    UPDATE accounts SET balance = balance - $amount WHERE id = $from;
+    UPDATE accounts SET balance = balance + $amount WHERE id = $to;
+}
+
+action pay($to) public {
+    transfer(1, $to, 10);
+}
+`
+
+func Test_ParseDocComment(t *testing.T) {
+	d := parseDocComment("Moves tokens.\n\n@param $from the payer\n@param amount how much,\n  at most 10")
+	if d.description != "Moves tokens." || d.param("$from") != "the payer" || d.param("$AMOUNT") != "how much, at most 10" {
+		t.Errorf("unexpected doc comment %+v", d)
+	}
+
+	want := "Moves tokens.\n\n**Parameters**\n\n- `$from`: the payer\n- `$amount`: how much, at most 10"
+	if got := d.markdown([]string{"$from", "$to", "$amount"}); got != want {
+		t.Errorf("expected markdown\n%s\ngot\n%s", want, got)
+	}
+}
+
+func Test_Hover(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(docCommentSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pos  lsp.Position
+		want string // empty for no hover
+	}{
+		{"action", lsp.Position{Line: 19, Character: 6}, "```kuneiform\naction transfer($from, $to, $amount) public\n```\n\nMoves tokens between two accounts.\n\n**Parameters**\n\n- `$from`: the paying account\n- `$amount`: how much to send, in the smallest unit"},
+		{"table", lsp.Position{Line: 14, Character: 12}, "```kuneiform\ntable accounts\n```\n\naccounts hold balances."},
+		{"column", lsp.Position{Line: 14, Character: 25}, "```kuneiform\naccounts.balance int notnull\n```\n\nbalance in the smallest unit"},
+		{"parameter", lsp.Position{Line: 14, Character: 45}, "```kuneiform\n$amount\n```\n\nParameter of transfer.\n\nhow much to send, in the smallest unit"},
+		{"keyword", lsp.Position{Line: 14, Character: 6}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := getHover(docCommentSchema, res, tt.pos)
+			got := ""
+			if h != nil {
+				got = h.Contents.Value
+			}
+			if got != tt.want {
+				t.Errorf("expected hover\n%s\ngot\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_SignatureHelp(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(docCommentSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the call is being typed, so the text doesn't parse
+	text := strings.Replace(docCommentSchema, "transfer(1, $to, 10);", "transfer(1, $to", 1)
+	help := getSignatureHelp(text, res, docCommentSchema, lsp.Position{Line: 19, Character: 19})
+	if help == nil {
+		t.Fatal("expected signature help")
+	}
+	sig := help.Signatures[0]
+	if sig.Label != "action transfer($from, $to, $amount) public" || sig.Documentation != "Moves tokens between two accounts." || help.ActiveParameter != 1 {
+		t.Errorf("unexpected signature help %+v", help)
+	}
+	if len(sig.Parameters) != 3 || sig.Parameters[0].Documentation != "the paying account" || sig.Parameters[1].Documentation != "" {
+		t.Errorf("unexpected parameters %+v", sig.Parameters)
+	}
+
+	if help := getSignatureHelp(docCommentSchema, res, docCommentSchema, lsp.Position{Line: 19, Character: 25}); help != nil {
+		t.Errorf("expected no signature help after the call, got %+v", help)
+	}
+}
+
+func Test_MissingDocCommentLint(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(docCommentSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ds := runLints(docCommentSchema, res, lintSettings{}); len(ds) != 0 {
+		t.Errorf("expected the rule to be off by default, got %+v", ds)
+	}
+
+	ds := runLints(docCommentSchema, res, lintSettings{Rules: map[string]string{"missing-doc-comment": "warning"}})
+	if len(ds) != 1 || ds[0].Message != "public action pay has no doc comment" || ds[0].Range.Start.Line != 18 || ds[0].Severity != lsp.Warning {
+		t.Errorf("unexpected diagnostics %+v", ds)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Inlay hints: parameter names before the arguments of action and procedure
+// calls, the types the analyzer infers for $variables that are assigned
+// without a declaration, and the columns of the rows a for loop iterates
+// over.
+
+func getInlayHints(text string, r *parse.SchemaParseResult, rng lsp.Range) []inlayHint {
+	hints := make([]inlayHint, 0)
+	if r == nil || r.Schema == nil {
+		return hints
+	}
+	toks := lexKf(text)
+	lines := lineOffsets(text)
+	add := func(hint inlayHint) {
+		offset := positionOffset(lines, hint.Position)
+		if positionOffset(lines, rng.Start) <= offset && offset <= positionOffset(lines, rng.End) {
+			hints = append(hints, hint)
+		}
+	}
+
+	walkBodies(r, func(method string, n parse.Node) bool {
+		switch n := n.(type) {
+		case *parse.ActionStmtActionCall:
+			addParameterHints(add, calleeParameters(r, n.Action), n.Args)
+		case *parse.ExpressionFunctionCall:
+			addParameterHints(add, calleeParameters(r, n.Name), n.Args)
+		}
+		return true
+	})
+
+	for _, proc := range r.Schema.Procedures {
+		addVariableHints(add, toks, r, proc)
+	}
+
+	sort.SliceStable(hints, func(i, j int) bool {
+		return positionOffset(lines, hints[i].Position) < positionOffset(lines, hints[j].Position)
+	})
+	return hints
+}
+
+// calleeParameters returns the parameter names of an action or procedure, or
+// nil if name is neither.
+func calleeParameters(r *parse.SchemaParseResult, name string) []string {
+	for _, action := range r.Schema.Actions {
+		if strings.EqualFold(action.Name, name) {
+			return action.Parameters
+		}
+	}
+	for _, proc := range r.Schema.Procedures {
+		if strings.EqualFold(proc.Name, name) {
+			params := make([]string, len(proc.Parameters))
+			for i, param := range proc.Parameters {
+				params[i] = param.Name
+			}
+			return params
+		}
+	}
+	return nil
+}
+
+// addParameterHints labels each argument with its parameter, unless the
+// argument is a variable of the same name.
+func addParameterHints(add func(inlayHint), params []string, args []parse.Expression) {
+	for i, arg := range args {
+		if i >= len(params) || isNilNode(arg) || !hasPosition(arg.GetPosition()) {
+			break
+		}
+		if v, ok := arg.(*parse.ExpressionVariable); ok && strings.EqualFold(v.String(), params[i]) {
+			continue
+		}
+		pos := arg.GetPosition()
+		add(inlayHint{
+			Position:     lsp.Position{Line: pos.StartLine - 1, Character: pos.StartCol},
+			Label:        strings.TrimPrefix(params[i], "$") + ":",
+			Kind:         inlayHintParameter,
+			PaddingRight: true,
+		})
+	}
+}
+
+// addVariableHints shows the type of each variable where it is first
+// assigned without a declared type, and the row of for loops over SQL.
+func addVariableHints(add func(inlayHint), toks []token, r *parse.SchemaParseResult, proc *types.Procedure) {
+	analyzed, err := parse.ParseProcedure(proc, r.Schema)
+	if err != nil || analyzed == nil {
+		return
+	}
+
+	declared := make(map[string]bool)
+	for _, param := range proc.Parameters {
+		declared[strings.ToLower(param.Name)] = true
+	}
+
+	hintType := func(v *parse.ExpressionVariable, label string) {
+		if v == nil || !hasPosition(&v.Position) || label == "" {
+			return
+		}
+		add(inlayHint{
+			Position: nodeRange(toks, &v.Position).End,
+			Label:    ": " + label,
+			Kind:     inlayHintType,
+		})
+	}
+	inferred := func(v *parse.ExpressionVariable) {
+		if v == nil || declared[strings.ToLower(v.String())] {
+			return
+		}
+		declared[strings.ToLower(v.String())] = true
+		if dt, ok := analyzed.Variables[v.String()]; ok && dt != nil {
+			hintType(v, dt.String())
+		}
+	}
+
+	for _, stmt := range r.ParsedProcedures[proc.Name] {
+		walkNode(stmt, func(n parse.Node) bool {
+			switch n := n.(type) {
+			case *parse.ProcedureStmtDeclaration:
+				if n.Variable != nil {
+					declared[strings.ToLower(n.Variable.String())] = true
+				}
+			case *parse.ProcedureStmtAssign:
+				if v, ok := n.Variable.(*parse.ExpressionVariable); ok && n.Type == nil {
+					inferred(v)
+				}
+			case *parse.ProcedureStmtCall:
+				for _, v := range n.Receivers {
+					inferred(v)
+				}
+			case *parse.ProcedureStmtForLoop:
+				if term, ok := n.LoopTerm.(*parse.LoopTermSQL); ok {
+					hintType(n.Receiver, rowColumns(r.Schema, term.Statement))
+				} else if n.Receiver != nil {
+					if dt, ok := analyzed.Variables[n.Receiver.String()]; ok && dt != nil {
+						hintType(n.Receiver, dt.String())
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// rowColumns describes the columns returned by a SELECT, with their types
+// where they come straight from a table.
+func rowColumns(schema *types.Schema, stmt *parse.SQLStatement) string {
+	if stmt == nil {
+		return ""
+	}
+	sel, ok := stmt.SQL.(*parse.SelectStatement)
+	if !ok || len(sel.SelectCores) == 0 {
+		return ""
+	}
+	core := sel.SelectCores[0]
+
+	// tables in scope, by alias and name
+	var relations []*parse.RelationTable
+	if rel, ok := core.From.(*parse.RelationTable); ok {
+		relations = append(relations, rel)
+	}
+	for _, join := range core.Joins {
+		if rel, ok := join.Relation.(*parse.RelationTable); ok {
+			relations = append(relations, rel)
+		}
+	}
+	tableOf := func(name string) *types.Table {
+		for _, rel := range relations {
+			if name == "" || strings.EqualFold(rel.Alias, name) || strings.EqualFold(rel.Table, name) {
+				if table, ok := schema.FindTable(rel.Table); ok {
+					return table
+				}
+			}
+		}
+		return nil
+	}
+	column := func(qualifier, name string) *types.Column {
+		for _, rel := range relations {
+			if qualifier != "" && !strings.EqualFold(rel.Alias, qualifier) && !strings.EqualFold(rel.Table, qualifier) {
+				continue
+			}
+			if table, ok := schema.FindTable(rel.Table); ok {
+				if col, ok := table.FindColumn(name); ok {
+					return col
+				}
+			}
+		}
+		return nil
+	}
+
+	var cols []string
+	for _, rc := range core.Columns {
+		switch rc := rc.(type) {
+		case *parse.ResultColumnWildcard:
+			if rc.Table == "" {
+				for _, rel := range relations {
+					if table, ok := schema.FindTable(rel.Table); ok {
+						for _, col := range table.Columns {
+							cols = append(cols, col.Name+" "+col.Type.String())
+						}
+					}
+				}
+			} else if table := tableOf(rc.Table); table != nil {
+				for _, col := range table.Columns {
+					cols = append(cols, col.Name+" "+col.Type.String())
+				}
+			}
+		case *parse.ResultColumnExpression:
+			name := rc.Alias
+			var col *types.Column
+			switch e := rc.Expression.(type) {
+			case *parse.ExpressionColumn:
+				col = column(e.Table, e.Column)
+				if name == "" {
+					name = e.Column
+				}
+			case *parse.ExpressionFunctionCall:
+				if name == "" {
+					name = e.Name
+				}
+			}
+			if name == "" {
+				name = "?column?"
+			}
+			if col != nil {
+				name += " " + col.Type.String()
+			}
+			cols = append(cols, name)
+		}
+	}
+	if len(cols) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(cols, ", ") + ")"
+}
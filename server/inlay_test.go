@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_InlayHints(t *testing.T) {
+	src := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull,
+    age int
+}
+
+procedure create_user($id uuid, $name text, $age int) public {
+    INSERT INTO users (id, name, age) VALUES ($id, $name, $age);
+}
+
+procedure total_age() public returns (total int) {
+    $total := 0;
+    for $row in SELECT name, age AS years FROM users {
+        $total := $total + $row.years;
+    }
+    for $i in 1..3 {
+        create_user(uuid_generate_v5('6ba7b810-9dad-11d1-80b4-00c04fd430c8'::uuid, 'x'), 'x', $i);
+    }
+    return $total;
+}
+
+action greet($name, $age) public view {
+    SELECT $name, $age;
+}
+
+action add($age) public view {
+    greet('x', $age);
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, hint := range getInlayHints(src, res, lsp.Range{End: lsp.Position{Line: 100}}) {
+		got = append(got, fmt.Sprintf("%d:%d %s", hint.Position.Line, hint.Position.Character, hint.Label))
+	}
+
+	want := []string{
+		"13:10 : int",
+		"14:12 : (name text, years int)",
+		"17:10 : int",
+		"18:20 id:",
+		"18:89 name:",
+		"18:94 age:",
+		"28:10 name:",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected hints\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// only hints in the requested range
+	if hints := getInlayHints(src, res, lsp.Range{Start: lsp.Position{Line: 28}, End: lsp.Position{Line: 29}}); len(hints) != 1 {
+		t.Errorf("expected one hint in the action, got %v", hints)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import "strings"
+
+// A small, forgiving lexer for Kuneiform source text. The parser in kwil-db
+// only exposes the AST, so anything that needs to reason about the raw text
+// (formatting, comments, token lookups) uses this instead. It never fails:
+// unterminated strings and comments run until the end of the input.
+
+type tokenKind int
+
+const (
+	tokIdent    tokenKind = iota // table, users, select, ...
+	tokVariable                  // $param or @contextual
+	tokNumber                    // 42, 0xff
+	tokString                    // 'text' or "quoted identifier"
+	tokComment                   // // line or /* block */ comment
+	tokPunct                     // {, }, (, ), ;, :=, ...
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// offset is the byte offset of the token in the source.
+	offset int
+	// line and col are zero based, matching the LSP positions.
+	line, col int
+}
+
+// end returns the byte offset just past the token.
+func (t token) end() int {
+	return t.offset + len(t.text)
+}
+
+// is reports whether the token is the given keyword or symbol, ignoring case.
+func (t token) is(text string) bool {
+	return strings.EqualFold(t.text, text)
+}
+
+// multi-character operators, longest first
+var punctuators = []string{"::", ":=", "..", "||", "==", "!=", "<>", "<=", ">="}
+
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+	// dashComments treats `--` as a line comment, as in plain SQL.
+	dashComments bool
+}
+
+// lexKf splits Kuneiform source into tokens, including comments.
+func lexKf(src string) []token {
+	l := &lexer{src: src}
+	return l.all()
+}
+
+func (l *lexer) all() []token {
+	var toks []token
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func (l *lexer) next() (token, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.src) {
+		return token{}, false
+	}
+
+	start, line, col := l.pos, l.line, l.col
+	kind := tokPunct
+	ch := l.src[l.pos]
+
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "//") || (l.dashComments && strings.HasPrefix(l.src[l.pos:], "--")):
+		kind = tokComment
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.advance()
+		}
+	case strings.HasPrefix(l.src[l.pos:], "/*"):
+		kind = tokComment
+		l.advance()
+		l.advance()
+		for l.pos < len(l.src) && !strings.HasPrefix(l.src[l.pos:], "*/") {
+			l.advance()
+		}
+		if l.pos < len(l.src) {
+			l.advance()
+			l.advance()
+		}
+	case ch == '\'' || ch == '"':
+		kind = tokString
+		l.advance()
+		for l.pos < len(l.src) && l.src[l.pos] != ch {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.advance()
+			}
+			l.advance()
+		}
+		if l.pos < len(l.src) {
+			l.advance()
+		}
+	case (ch == '$' || ch == '@') && l.pos+1 < len(l.src) && isIdentStart(l.src[l.pos+1]):
+		kind = tokVariable
+		l.advance()
+		l.advanceWhile(isIdentChar)
+	case isIdentStart(ch):
+		kind = tokIdent
+		l.advanceWhile(isIdentChar)
+	case isDigit(ch):
+		kind = tokNumber
+		l.advanceWhile(isIdentChar) // covers 0x prefixes as well
+	default:
+		width := 1
+		for _, p := range punctuators {
+			if strings.HasPrefix(l.src[l.pos:], p) {
+				width = len(p)
+				break
+			}
+		}
+		for i := 0; i < width; i++ {
+			l.advance()
+		}
+	}
+
+	return token{
+		kind:   kind,
+		text:   l.src[start:l.pos],
+		offset: start,
+		line:   line,
+		col:    col,
+	}, true
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.advance()
+	}
+}
+
+func (l *lexer) advanceWhile(f func(byte) bool) {
+	for l.pos < len(l.src) && f(l.src[l.pos]) {
+		l.advance()
+	}
+}
+
+func (l *lexer) advance() {
+	if l.src[l.pos] == '\n' {
+		l.line++
+		l.col = 0
+	} else {
+		l.col++
+	}
+	l.pos++
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == '\v' || ch == '\f'
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentChar(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
+
+// normalizeIdent returns the canonical form of an identifier. Kuneiform is
+// case insensitive, and the parser lower cases all declared names.
+func normalizeIdent(s string) string {
+	return strings.ToLower(s)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Lints are checks on top of the parser's validation. They only run on
+// schemas without parse errors, since they rely on the ASTs.
+
+const lintSource = "kuneiform-lint"
+
+type lintRule struct {
+	name        string
+	description string
+	severity    lsp.DiagnosticSeverity
+	// optional rules only run when given a severity in the settings.
+	optional bool
+	check    func(doc *lintDoc) []lsp.Diagnostic
+}
+
+// lintDoc is the document a lint rule runs on.
+type lintDoc struct {
+	text   string
+	toks   []token
+	result *parse.SchemaParseResult
+}
+
+var lintRules = []*lintRule{
+	{
+		name:        "unused-parameter",
+		description: "action and procedure parameters should be used in the body",
+		severity:    lsp.Warning,
+		check:       lintUnusedParameters,
+	},
+	{
+		name:        "update-without-where",
+		description: "UPDATE statements without a WHERE clause change every row of a table",
+		severity:    lsp.Warning,
+		check:       lintUpdateWithoutWhere,
+	},
+	{
+		name:        "delete-without-where",
+		description: "DELETE statements without a WHERE clause remove every row of a table",
+		severity:    lsp.Warning,
+		check:       lintDeleteWithoutWhere,
+	},
+	{
+		name:        "missing-doc-comment",
+		description: "public actions should have a doc comment",
+		severity:    lsp.Information,
+		optional:    true,
+		check:       lintMissingDocComments,
+	},
+}
+
+// findLintRule returns the rule with the given name, or nil.
+func findLintRule(name string) *lintRule {
+	for _, rule := range lintRules {
+		if rule.name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// runLints runs the lint rules on a parsed document. The severities of rules
+// can be overridden, or rules turned off, by the lint settings.
+func runLints(text string, r *parse.SchemaParseResult, settings lintSettings) []lsp.Diagnostic {
+	diagnostics := make([]lsp.Diagnostic, 0)
+	if r == nil || r.Schema == nil || r.SchemaInfo == nil || r.Err() != nil {
+		return diagnostics
+	}
+
+	doc := &lintDoc{text: text, toks: lexKf(text), result: r}
+	for _, rule := range lintRules {
+		severity := rule.severity
+		configured, ok := settings.Rules[rule.name]
+		if !ok && rule.optional {
+			continue
+		}
+		if ok {
+			s, off, err := parseLintSeverity(configured)
+			if off {
+				continue
+			}
+			if err == nil {
+				severity = s
+			}
+		}
+
+		for _, d := range rule.check(doc) {
+			d.Severity = severity
+			d.Code = rule.name
+			d.Source = lintSource
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+func lintUnusedParameters(doc *lintDoc) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	check := func(kind, name, body string, params []string) {
+		used := make(map[string]bool)
+		for _, tok := range lexKf(body) {
+			if tok.kind == tokVariable {
+				used[normalizeIdent(tok.text)] = true
+			}
+		}
+
+		block, ok := doc.result.SchemaInfo.Blocks[name]
+		if !ok {
+			return
+		}
+		for _, param := range params {
+			if used[normalizeIdent(param)] {
+				continue
+			}
+			tok, ok := findHeaderVariable(doc.toks, block, param)
+			if !ok {
+				continue
+			}
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:   tokenRange(tok),
+				Message: fmt.Sprintf("parameter %s is never used in %s %s", param, kind, name),
+			})
+		}
+	}
+
+	for _, action := range doc.result.Schema.Actions {
+		check("action", action.Name, action.Body, action.Parameters)
+	}
+	for _, procedure := range doc.result.Schema.Procedures {
+		var params []string
+		for _, param := range procedure.Parameters {
+			params = append(params, param.Name)
+		}
+		check("procedure", procedure.Name, procedure.Body, params)
+	}
+	return diagnostics
+}
+
+func lintUpdateWithoutWhere(doc *lintDoc) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	walkBodies(doc.result, func(method string, n parse.Node) bool {
+		if stmt, ok := n.(*parse.UpdateStatement); ok && stmt.Where == nil && hasPosition(&stmt.Position) {
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:   nodeRange(doc.toks, &stmt.Position),
+				Message: fmt.Sprintf("UPDATE of table %s in %s has no WHERE clause and changes every row", stmt.Table, method),
+			})
+		}
+		return true
+	})
+	return diagnostics
+}
+
+func lintDeleteWithoutWhere(doc *lintDoc) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	walkBodies(doc.result, func(method string, n parse.Node) bool {
+		if stmt, ok := n.(*parse.DeleteStatement); ok && stmt.Where == nil && hasPosition(&stmt.Position) {
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:   nodeRange(doc.toks, &stmt.Position),
+				Message: fmt.Sprintf("DELETE from table %s in %s has no WHERE clause and removes every row", stmt.Table, method),
+			})
+		}
+		return true
+	})
+	return diagnostics
+}
+
+func lintMissingDocComments(doc *lintDoc) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	docs := collectDocComments(doc.text, doc.result)
+	for _, action := range doc.result.Schema.Actions {
+		if !action.Public || docs.of(action.Name).description != "" {
+			continue
+		}
+		block, ok := doc.result.SchemaInfo.Blocks[action.Name]
+		if !ok {
+			continue
+		}
+		tok, ok := declaredName(doc.toks, block, action.Name)
+		if !ok {
+			continue
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:   tokenRange(tok),
+			Message: fmt.Sprintf("public action %s has no doc comment", action.Name),
+		})
+	}
+	return diagnostics
+}
+
+// findHeaderVariable finds a parameter in the declaration of an action or
+// procedure, i.e. before the opening brace of its body.
+func findHeaderVariable(toks []token, block *parse.Block, name string) (token, bool) {
+	for _, tok := range toks {
+		if tok.offset < block.AbsStart {
+			continue
+		}
+		if tok.offset > block.AbsEnd || tok.text == "{" {
+			break
+		}
+		if tok.kind == tokVariable && tok.is(name) {
+			return tok, true
+		}
+	}
+	return token{}, false
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Logging is shared by all sessions of the process. The destination, format
+// and level can be changed while the server runs, either from the command
+// line flags or from the "kuneiform.logging" client settings. Every session
+// can additionally forward its logs to the editor with window/logMessage.
+
+// logSettings are the "kuneiform.logging" client settings.
+type logSettings struct {
+	// Level is the minimum level written to the log file: debug, info, warn or error.
+	Level string `json:"level"`
+	// File is the log file, "-" for stderr. Empty means ~/.kwil-ls/lsp.log.
+	File string `json:"file"`
+	// Format is text or json.
+	Format string `json:"format"`
+	// MaxSizeMB is the size at which the log file is rotated, 0 to never rotate.
+	MaxSizeMB int `json:"maxSizeMB"`
+	// MaxBackups is the number of rotated log files to keep.
+	MaxBackups int `json:"maxBackups"`
+	// ClientLevel is the minimum level forwarded to the editor, or "off".
+	ClientLevel string `json:"clientLevel"`
+}
+
+var defaultLogSettings = logSettings{
+	Level:       "info",
+	Format:      "text",
+	MaxSizeMB:   10,
+	MaxBackups:  3,
+	ClientLevel: "warn",
+}
+
+// withDefaults fills in unset fields from defaultLogSettings.
+func (s logSettings) withDefaults() logSettings {
+	if s.Level == "" {
+		s.Level = defaultLogSettings.Level
+	}
+	if s.Format == "" {
+		s.Format = defaultLogSettings.Format
+	}
+	if s.MaxSizeMB < 0 {
+		s.MaxSizeMB = 0
+	}
+	if s.MaxBackups < 0 {
+		s.MaxBackups = 0
+	}
+	if s.ClientLevel == "" {
+		s.ClientLevel = defaultLogSettings.ClientLevel
+	}
+	return s
+}
+
+// logOutput is the process wide log destination. Records are handled under
+// a read lock, so a reconfiguration waits for the records being written to
+// the previous destination before closing it.
+type logOutput struct {
+	mu       sync.RWMutex
+	settings logSettings
+	handler  slog.Handler
+	closer   io.Closer // nil for stderr
+	opened   bool
+}
+
+var logs = &logOutput{handler: slog.NewTextHandler(io.Discard, nil)}
+
+// configure switches the log destination, format and level. The previous
+// destination is kept if the new one can't be opened.
+func (o *logOutput) configure(s logSettings) error {
+	s = s.withDefaults()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q", s.Level)
+	}
+	if s.Format != "text" && s.Format != "json" {
+		return fmt.Errorf("invalid log format %q", s.Format)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if s.File == o.settings.File && s.Format == o.settings.Format &&
+		s.MaxSizeMB == o.settings.MaxSizeMB && s.MaxBackups == o.settings.MaxBackups && o.opened {
+		o.settings = s
+		logLevel.Set(level)
+		return nil
+	}
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer
+	if s.File != "-" {
+		path := s.File
+		if path == "" {
+			homedir, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("error getting home directory: %w", err)
+			}
+			path = filepath.Join(homedir, lsDir, logFile)
+		}
+
+		f, err := openRotatingFile(path, int64(s.MaxSizeMB)<<20, s.MaxBackups)
+		if err != nil {
+			return err
+		}
+		w, closer = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if s.Format == "json" {
+		o.handler = slog.NewJSONHandler(w, opts)
+	} else {
+		o.handler = slog.NewTextHandler(w, opts)
+	}
+
+	if o.closer != nil {
+		o.closer.Close()
+	}
+	o.closer = closer
+	o.opened = true
+	o.settings = s
+	logLevel.Set(level)
+	return nil
+}
+
+// handle writes a record to the current destination, with ops applied to
+// its handler.
+func (o *logOutput) handle(ctx context.Context, r slog.Record, ops []func(slog.Handler) slog.Handler) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	handler := o.handler
+	for _, op := range ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+// outputHandler writes to whatever logOutput is currently configured, so
+// loggers created before a reconfiguration follow it.
+type outputHandler struct {
+	out *logOutput
+	// ops replays WithAttrs and WithGroup on the current handler.
+	ops []func(slog.Handler) slog.Handler
+}
+
+func newOutputLogger(out *logOutput) *slog.Logger {
+	return slog.New(&outputHandler{out: out})
+}
+
+func (h *outputHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *outputHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.out.handle(ctx, r, h.ops)
+}
+
+func (h *outputHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &outputHandler{out: h.out, ops: append(slices.Clip(h.ops), func(handler slog.Handler) slog.Handler {
+		return handler.WithAttrs(attrs)
+	})}
+}
+
+func (h *outputHandler) WithGroup(name string) slog.Handler {
+	return &outputHandler{out: h.out, ops: append(slices.Clip(h.ops), func(handler slog.Handler) slog.Handler {
+		return handler.WithGroup(name)
+	})}
+}
+
+// clientLogHandler forwards records to the editor with window/logMessage.
+type clientLogHandler struct {
+	conn  *atomic.Pointer[jsonrpc2.Conn]
+	level *slog.LevelVar
+	off   *atomic.Bool
+	attrs string
+}
+
+func newClientLogHandler() *clientLogHandler {
+	h := &clientLogHandler{
+		conn:  &atomic.Pointer[jsonrpc2.Conn]{},
+		level: &slog.LevelVar{},
+		off:   &atomic.Bool{},
+	}
+	h.setLevel(defaultLogSettings.ClientLevel)
+	return h
+}
+
+func (h *clientLogHandler) setConn(conn *jsonrpc2.Conn) {
+	h.conn.Store(conn)
+}
+
+// setLevel sets the minimum level forwarded to the editor, or "off".
+func (h *clientLogHandler) setLevel(level string) error {
+	if level == "off" {
+		h.off.Store(true)
+		return nil
+	}
+	if err := h.level.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid client log level %q", level)
+	}
+	h.off.Store(false)
+	return nil
+}
+
+func (h *clientLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return !h.off.Load() && level >= h.level.Level() && h.conn.Load() != nil
+}
+
+func (h *clientLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	conn := h.conn.Load()
+	if conn == nil {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	sb.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&sb, "", a)
+		return true
+	})
+
+	// the connection may already be closed, and there is nowhere to report that
+	conn.Notify(context.Background(), "window/logMessage", lsp.LogMessageParams{
+		Type:    logMessageType(r.Level),
+		Message: sb.String(),
+	})
+	return nil
+}
+
+func (h *clientLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeAttr(&sb, "", a)
+	}
+	return &clientLogHandler{conn: h.conn, level: h.level, off: h.off, attrs: sb.String()}
+}
+
+// WithGroup is ignored: messages in the editor are for people, not tools.
+func (h *clientLogHandler) WithGroup(name string) slog.Handler {
+	return h
+}
+
+func writeAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(sb, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	fmt.Fprintf(sb, " %s%s=%v", prefix, a.Key, a.Value)
+}
+
+func logMessageType(level slog.Level) lsp.MessageType {
+	switch {
+	case level >= slog.LevelError:
+		return lsp.MTError
+	case level >= slog.LevelWarn:
+		return lsp.MTWarning
+	case level >= slog.LevelInfo:
+		return lsp.Info
+	default:
+		return lsp.Log
+	}
+}
+
+// teeHandler sends records to every handler that accepts them.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := make(teeHandler, len(t))
+	for i, h := range t {
+		res[i] = h.WithAttrs(attrs)
+	}
+	return res
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	res := make(teeHandler, len(t))
+	for i, h := range t {
+		res[i] = h.WithGroup(name)
+	}
+	return res
+}
+
+// rotatingFile is a log file that is moved to path.1, path.2, ... once it
+// grows past maxSize. A log left by a previous run is rotated on open.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.rotate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new, empty file.
+func (f *rotatingFile) rotate() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	if info, err := os.Stat(f.path); err == nil && info.Size() > 0 && f.maxBackups > 0 {
+		os.Remove(backupPath(f.path, f.maxBackups))
+		for i := f.maxBackups - 1; i > 0; i-- {
+			os.Rename(backupPath(f.path, i), backupPath(f.path, i+1))
+		}
+		if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil {
+			return fmt.Errorf("error rotating log file: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating log file: %w", err)
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
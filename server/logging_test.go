@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_RotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lsp.log")
+	if err := os.WriteFile(path, []byte("previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the log of the previous run fell off the end
+	expected := map[string]string{
+		path:                "third\n",
+		backupPath(path, 1): "second\n",
+		backupPath(path, 2): "first\n",
+		backupPath(path, 3): "",
+	}
+	for file, content := range expected {
+		b, err := os.ReadFile(file)
+		if content == "" {
+			if err == nil {
+				t.Errorf("expected %s to not exist", file)
+			}
+			continue
+		}
+		if string(b) != content {
+			t.Errorf("%s: expected %q, got %q", file, content, string(b))
+		}
+	}
+}
+
+func Test_ReconfigureWhileLogging(t *testing.T) {
+	dir := t.TempDir()
+	out := &logOutput{}
+	if err := out.configure(logSettings{File: filepath.Join(dir, "0.log")}); err != nil {
+		t.Fatal(err)
+	}
+	logger := newOutputLogger(out)
+
+	const writers, lines = 8, 2000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				logger.Info("line")
+			}
+		}()
+	}
+	// every destination is a new file, so none is rotated away
+	for i := 1; i <= 200; i++ {
+		if err := out.configure(logSettings{File: filepath.Join(dir, strconv.Itoa(i)+".log")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	out.closer.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := 0
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written += strings.Count(string(b), "msg=line")
+	}
+	if written != writers*lines {
+		t.Errorf("expected %d lines, got %d", writers*lines, written)
+	}
+}
+
+func Test_ClientLogLevel(t *testing.T) {
+	h := newClientLogHandler()
+	ctx := context.Background()
+
+	// nothing is forwarded before the connection is set
+	if h.Enabled(ctx, slog.LevelError) {
+		t.Error("expected forwarding to be disabled without a connection")
+	}
+
+	if err := h.setLevel("loud"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if err := h.setLevel("off"); err != nil || !h.off.Load() {
+		t.Errorf("expected forwarding to be turned off, got %v", err)
+	}
+	if err := h.setLevel("debug"); err != nil || h.off.Load() || h.level.Level() != slog.LevelDebug {
+		t.Errorf("expected debug level, got %v", err)
+	}
+
+	var sb strings.Builder
+	writeAttr(&sb, "", slog.Group("doc", slog.String("uri", "file:///a.kf")))
+	if sb.String() != " doc.uri=file:///a.kf" {
+		t.Errorf("unexpected attribute formatting %q", sb.String())
+	}
+}
@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
 
 const (
-	lsDir   = ".kwil-ls"
-	logFile = "lsp.log"
+	binaryName = "kuneiform-lsp"
+	lsDir      = ".kwil-ls"
+	logFile    = "lsp.log"
 )
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 var logLevel = &slog.LevelVar{}
 
+// serverLogSettings are the logging settings from the command line. Client
+// settings are applied on top of them.
+var serverLogSettings = defaultLogSettings
+
 type stdioRWC struct{}
 
 func (s *stdioRWC) Close() error {
@@ -32,48 +42,101 @@ func (s *stdioRWC) Write(p []byte) (n int, err error) {
 }
 
 func main() {
-	ctx := context.Background()
-	logLevel.Set(slog.LevelDebug)
-	logger := getLogger(logLevel)
-
-	// Initialize the language server  and register the handlers
-	lshandler := &lspHandler{
-		docs:     make(map[string]*kfDocs),
-		handlers: make(map[string]func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request)),
-		logger:   logger,
+	if len(os.Args) > 1 {
+		if cmd, ok := findCommand(os.Args[1]); ok {
+			os.Exit(runCommand(cmd, os.Args[2:]))
+		}
 	}
-	lshandler.registerHandlers()
 
-	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(&stdioRWC{}, jsonrpc2.VSCodeObjectCodec{}), lshandler)
-
-	logger.Info("Connected to the client...")
-	defer conn.Close()
+	os.Exit(runServer(os.Args[1:]))
+}
 
-	<-conn.DisconnectNotify()
+// checkTransports rejects conflicting transport flags: --stdio, which is the
+// default, given together with --tcp or --ws, or no transport at all.
+func checkTransports(fs *flag.FlagSet, stdio bool, tcp, ws string) error {
+	stdioSet := false
+	fs.Visit(func(f *flag.Flag) {
+		stdioSet = stdioSet || f.Name == "stdio"
+	})
+	network := tcp != "" || ws != ""
+	if stdioSet && stdio && network {
+		return errors.New("--stdio cannot be combined with --tcp or --ws")
+	}
+	if !stdio && !network {
+		return errors.New("no transport, use --stdio, --tcp or --ws")
+	}
+	return nil
 }
 
-func getLogger(level *slog.LevelVar) *slog.Logger {
-	// Initialize the logger
-	homedir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error getting home directory")
-		os.Exit(1)
+// runServer starts the language server and returns the process exit code.
+func runServer(args []string) int {
+	fs := flag.NewFlagSet(binaryName, flag.ContinueOnError)
+	level := fs.String("log-level", defaultLogSettings.Level, "log level: debug, info, warn or error")
+	file := fs.String("log-file", "", "log file, or - for stderr (default ~/"+lsDir+"/"+logFile+")")
+	format := fs.String("log-format", defaultLogSettings.Format, "log format: text or json")
+	maxSize := fs.Int("log-max-size", defaultLogSettings.MaxSizeMB, "rotate the log file at this size in MB, 0 to never rotate")
+	stdio := fs.Bool("stdio", true, "serve the language server over stdin and stdout")
+	tcp := fs.String("tcp", "", "serve the language server on a TCP address instead of stdio, e.g. localhost:7000")
+	ws := fs.String("ws", "", "serve the language server over WebSocket on an address instead of stdio, e.g. localhost:7001")
+	wsOrigins := fs.String("ws-origins", "", "comma separated browser origins allowed to connect over WebSocket, or * for any")
+	showVersion := fs.Bool("version", false, "print the version and exit")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "usage: %s [flags]\n       %s <command> [arguments]\n\nflags:\n", binaryName, binaryName)
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\ncommands:\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.summary)
+		}
 	}
 
-	logDir := filepath.Join(homedir, lsDir)
-	err = os.MkdirAll(logDir, 0755)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error creating log directory %s", logDir)
-		os.Exit(1)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
 	}
 
-	logFile := filepath.Join(logDir, logFile)
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error creating log file %s", logFile)
-		os.Exit(1)
+	if *showVersion {
+		fmt.Println(binaryName, version)
+		return 0
+	}
+	if err := checkTransports(fs, *stdio, *tcp, *ws); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	serverLogSettings.Level = *level
+	serverLogSettings.File = *file
+	serverLogSettings.Format = *format
+	serverLogSettings.MaxSizeMB = *maxSize
+	if err := logs.configure(serverLogSettings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	logger := newOutputLogger(logs)
+
+	ctx := context.Background()
+	if *stdio && *tcp == "" && *ws == "" {
+		serve(ctx, jsonrpc2.NewBufferedStream(&stdioRWC{}, jsonrpc2.VSCodeObjectCodec{}), logger, false)
+		return 0
+	}
+
+	// network servers run until one of them fails
+	errc := make(chan error, 2)
+	if *tcp != "" {
+		go func() { errc <- serveTCP(ctx, *tcp, logger) }()
+	}
+	if *ws != "" {
+		var origins []string
+		if *wsOrigins != "" {
+			origins = strings.Split(*wsOrigins, ",")
+		}
+		go func() { errc <- serveWebSocket(ctx, *ws, origins, logger) }()
 	}
 
-	handler := slog.NewTextHandler(file, &slog.HandlerOptions{Level: level})
-	return slog.New(handler)
+	err := <-errc
+	logger.Error("server failed", slog.String("err", err.Error()))
+	fmt.Fprintln(os.Stderr, err)
+	return 1
 }
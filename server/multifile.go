@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// A project manifest, kuneiform.json at the workspace root or in any
+// directory above the schemas, describes the databases of a project: the
+// files each is split across, e.g. tables in one file and procedures in
+// others, and the kwil-db version, lint rules and extension catalogs that
+// apply to it:
+//
+//	{
+//	  "databases": [
+//	    {
+//	      "name": "app",
+//	      "files": ["app/tables.kf", "app/actions.kf"],
+//	      "version": "v0.8",
+//	      "lint": {"rules": {"update-without-where": "error"}}
+//	    }
+//	  ]
+//	}
+//
+// The files don't declare the database. They are merged, in the order
+// listed and after a "database" line for the name, into one schema that is
+// validated as a whole, and positions in it are mapped back to the files.
+// The settings of a database override the editor settings and the project
+// file.
+
+const manifestFile = "kuneiform.json"
+
+type projectManifest struct {
+	Databases []manifestDatabase `json:"databases"`
+
+	// dir is the directory of the manifest, which paths are relative to.
+	dir string
+}
+
+type manifestDatabase struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+	// Version is the kwil-db release the database is written for. Only the
+	// bundled parser's release is supported; others are reported.
+	Version    string             `json:"version"`
+	Lint       lintSettings       `json:"lint"`
+	Extensions []extensionCatalog `json:"extensions"`
+}
+
+// apply applies the settings of the database. Its lint rules and extension
+// catalogs are added to those of the settings.
+func (db *manifestDatabase) apply(s *serverSettings) {
+	if db.Version != "" {
+		s.Parser.Version = db.Version
+	}
+	if s.Lint.Rules == nil {
+		s.Lint.Rules = make(map[string]string)
+	}
+	for name, severity := range db.Lint.Rules {
+		s.Lint.Rules[name] = severity
+	}
+	s.Extensions = append(s.Extensions, db.Extensions...)
+}
+
+// paths returns the absolute paths of the files of a database.
+func (m *projectManifest) paths(db *manifestDatabase) []string {
+	paths := make([]string, len(db.Files))
+	for i, file := range db.Files {
+		paths[i] = filepath.Clean(file)
+		if !filepath.IsAbs(file) {
+			paths[i] = filepath.Join(m.dir, file)
+		}
+	}
+	return paths
+}
+
+// databaseOf returns the database a file belongs to, if any.
+func (m *projectManifest) databaseOf(path string) *manifestDatabase {
+	path = filepath.Clean(path)
+	for i := range m.Databases {
+		for _, p := range m.paths(&m.Databases[i]) {
+			if p == path {
+				return &m.Databases[i]
+			}
+		}
+	}
+	return nil
+}
+
+// problems returns the mistakes in the manifest that settings don't catch:
+// databases listed twice, files that are missing or part of two databases.
+func (m *projectManifest) problems() []string {
+	var problems []string
+	names := make(map[string]bool)
+	owners := make(map[string]string)
+	for i := range m.Databases {
+		db := &m.Databases[i]
+		if names[db.Name] {
+			problems = append(problems, fmt.Sprintf("database %s is listed twice", db.Name))
+		}
+		names[db.Name] = true
+
+		for _, path := range m.paths(db) {
+			if owner, ok := owners[path]; ok && owner != db.Name {
+				problems = append(problems, fmt.Sprintf("%s is part of databases %s and %s", path, owner, db.Name))
+			}
+			owners[path] = db.Name
+			if _, err := os.Stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("database %s: %v", db.Name, err))
+			}
+		}
+	}
+	return problems
+}
+
+var manifests = newFileCache(readManifest)
+
+// lookupManifest returns the nearest manifest for a directory. The path is
+// empty if there is none.
+func lookupManifest(dir string) (string, *projectManifest, error) {
+	for {
+		path := filepath.Join(dir, manifestFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			m, err := manifests.loadAt(path, info.ModTime())
+			return path, m, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, nil
+		}
+		dir = parent
+	}
+}
+
+func readManifest(path string) (*projectManifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &projectManifest{dir: filepath.Dir(path)}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, db := range m.Databases {
+		if db.Name == "" {
+			return nil, fmt.Errorf("%s: database without a name", path)
+		}
+		if len(db.Files) == 0 {
+			return nil, fmt.Errorf("%s: database %s has no files", path, db.Name)
+		}
+	}
+	return m, nil
+}
+
+// lookupDatabase returns the nearest manifest of a file and the database
+// the file is part of, if any.
+func lookupDatabase(path string) (string, *projectManifest, *manifestDatabase, error) {
+	manifestPath, m, err := lookupManifest(filepath.Dir(path))
+	if err != nil || m == nil {
+		return manifestPath, nil, nil, err
+	}
+	return manifestPath, m, m.databaseOf(path), nil
+}
+
+// readDatabaseSource returns the merged source of the database a file is
+// part of, read from disk, or nil if it isn't part of one.
+func readDatabaseSource(file string) (*mergedSource, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	manifestPath, m, db, err := lookupDatabase(abs)
+	if err != nil || db == nil {
+		return nil, err
+	}
+
+	var files []sourceFile
+	for _, path := range m.paths(db) {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("database %s in %s: %w", db.Name, manifestPath, err)
+		}
+		files = append(files, sourceFile{uri: fileURI(path), text: string(text)})
+	}
+	return mergeSources(db.Name, files), nil
+}
+
+// readSchema returns the text of the schema a file is part of: the merged
+// files of its database, or else the file itself.
+func readSchema(file string) ([]byte, error) {
+	src, err := readDatabaseSource(file)
+	if err != nil {
+		return nil, err
+	}
+	if src != nil {
+		return []byte(src.text), nil
+	}
+	return os.ReadFile(file)
+}
+
+// mergedSource is the text of a database split across files.
+type mergedSource struct {
+	database string
+	text     string
+	files    []sourceFile
+}
+
+type sourceFile struct {
+	uri  lsp.DocumentURI
+	text string
+	// line is the first line of the file in the merged text.
+	line  int
+	lines int
+}
+
+// mergeSources merges the files of a database after a line declaring it.
+func mergeSources(database string, files []sourceFile) *mergedSource {
+	var b strings.Builder
+	fmt.Fprintf(&b, "database %s;\n", database)
+	line := 1
+	src := &mergedSource{database: database}
+	for _, file := range files {
+		text := file.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		file.line = line
+		file.lines = strings.Count(text, "\n")
+		line += file.lines
+		b.WriteString(text)
+		src.files = append(src.files, file)
+	}
+	src.text = b.String()
+	return src
+}
+
+// file returns the file with the given URI.
+func (s *mergedSource) file(uri lsp.DocumentURI) *sourceFile {
+	for i := range s.files {
+		if s.files[i].uri == uri {
+			return &s.files[i]
+		}
+	}
+	return nil
+}
+
+// withText returns the source with the text of a file replaced, e.g. by
+// another version of it.
+func (s *mergedSource) withText(uri lsp.DocumentURI, text string) *mergedSource {
+	files := slices.Clone(s.files)
+	for i := range files {
+		if files[i].uri == uri {
+			files[i].text = text
+		}
+	}
+	return mergeSources(s.database, files)
+}
+
+// fileAt returns the file containing a line of the merged text. The
+// database line belongs to the first file.
+func (s *mergedSource) fileAt(line int) *sourceFile {
+	for i := range s.files {
+		if line < s.files[i].line+s.files[i].lines {
+			return &s.files[i]
+		}
+	}
+	return &s.files[len(s.files)-1]
+}
+
+// toMerged returns the position in the merged text of a position in a file.
+func (s *mergedSource) toMerged(uri lsp.DocumentURI, pos lsp.Position) lsp.Position {
+	if f := s.file(uri); f != nil {
+		pos.Line += f.line
+	}
+	return pos
+}
+
+// toFile returns the file and range in it of a range of the merged text. A
+// range spanning files is cut at the end of the first.
+func (s *mergedSource) toFile(rng lsp.Range) (lsp.DocumentURI, lsp.Range) {
+	f := s.fileAt(rng.Start.Line)
+	if rng.End.Line >= f.line+f.lines {
+		rng.End = lsp.Position{Line: f.line + f.lines - 1}
+	}
+	rng.Start.Line = max(rng.Start.Line-f.line, 0)
+	rng.End.Line = max(rng.End.Line-f.line, 0)
+	return f.uri, rng
+}
+
+// toFileLocations maps locations in the merged text to the files.
+func (s *mergedSource) toFileLocations(locs []lsp.Location) []lsp.Location {
+	res := make([]lsp.Location, 0, len(locs))
+	for _, loc := range locs {
+		uri, rng := s.toFile(loc.Range)
+		res = append(res, lsp.Location{URI: uri, Range: rng})
+	}
+	return res
+}
+
+// inFile returns the range in a file of a range of the merged text, if it
+// starts in that file. Nothing is in a file on the database line.
+func (s *mergedSource) inFile(uri lsp.DocumentURI, rng lsp.Range) (lsp.Range, bool) {
+	if rng.Start.Line < s.files[0].line {
+		return lsp.Range{}, false
+	}
+	fileURI, rng := s.toFile(rng)
+	return rng, fileURI == uri
+}
+
+// fileSymbols returns the symbols of the merged text declared in a file.
+func (s *mergedSource) fileSymbols(uri lsp.DocumentURI, symbols []lsp.SymbolInformation) []lsp.SymbolInformation {
+	res := make([]lsp.SymbolInformation, 0, len(symbols))
+	for _, sym := range symbols {
+		if rng, ok := s.inFile(uri, sym.Location.Range); ok {
+			sym.Location = lsp.Location{URI: uri, Range: rng}
+			res = append(res, sym)
+		}
+	}
+	return res
+}
+
+// fileFoldingRanges returns the folding ranges of the merged text starting
+// in a file.
+func (s *mergedSource) fileFoldingRanges(uri lsp.DocumentURI, ranges []foldingRange) []foldingRange {
+	res := make([]foldingRange, 0, len(ranges))
+	for _, fr := range ranges {
+		rng, ok := s.inFile(uri, lsp.Range{Start: lsp.Position{Line: fr.StartLine}, End: lsp.Position{Line: fr.EndLine}})
+		if ok && rng.End.Line > rng.Start.Line {
+			fr.StartLine, fr.EndLine = rng.Start.Line, rng.End.Line
+			res = append(res, fr)
+		}
+	}
+	return res
+}
+
+// fileInlayHints returns the inlay hints of the merged text in a file.
+func (s *mergedSource) fileInlayHints(uri lsp.DocumentURI, hints []inlayHint) []inlayHint {
+	res := make([]inlayHint, 0, len(hints))
+	for _, h := range hints {
+		if rng, ok := s.inFile(uri, lsp.Range{Start: h.Position, End: h.Position}); ok {
+			h.Position = rng.Start
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// fileCodeLenses returns the code lenses of the merged text in a file, with
+// the locations they show mapped to their files.
+func (s *mergedSource) fileCodeLenses(uri lsp.DocumentURI, lenses []lsp.CodeLens) []lsp.CodeLens {
+	res := make([]lsp.CodeLens, 0, len(lenses))
+	for _, lens := range lenses {
+		rng, ok := s.inFile(uri, lens.Range)
+		if !ok {
+			continue
+		}
+		var locs []lsp.Location
+		if args := lens.Command.Arguments; len(args) == 3 {
+			locs, _ = args[2].([]lsp.Location)
+		}
+		res = append(res, referencesLens(uri, rng, lens.Command.Title, s.toFileLocations(locs)))
+	}
+	return res
+}
+
+// fileSelectionRange returns a selection range of the merged text for a
+// position in a file: the ranges in the file, growing to the whole file
+// instead of the merged text.
+func (s *mergedSource) fileSelectionRange(uri lsp.DocumentURI, sel selectionRange) selectionRange {
+	var chain []lsp.Range // innermost first
+	for r := &sel; r != nil; r = r.Parent {
+		if rng, ok := s.inFile(uri, r.Range); ok {
+			chain = append(chain, rng)
+		}
+	}
+	if f := s.file(uri); f != nil {
+		whole := lsp.Range{End: endPosition(f.text)}
+		if len(chain) == 0 || chain[len(chain)-1] != whole {
+			chain = append(chain, whole)
+		}
+	}
+
+	var res *selectionRange
+	for i := len(chain) - 1; i >= 0; i-- {
+		res = &selectionRange{Range: chain[i], Parent: res}
+	}
+	return *res
+}
+
+// toFileItem maps a call hierarchy item of the merged text to its file.
+func (s *mergedSource) toFileItem(item callHierarchyItem) callHierarchyItem {
+	item.URI, item.Range = s.toFile(item.Range)
+	_, item.SelectionRange = s.toFile(item.SelectionRange)
+	return item
+}
+
+// toFileRanges maps ranges of the merged text to their file.
+func (s *mergedSource) toFileRanges(ranges []lsp.Range) []lsp.Range {
+	res := make([]lsp.Range, len(ranges))
+	for i, rng := range ranges {
+		_, res[i] = s.toFile(rng)
+	}
+	return res
+}
+
+// splitDiagnostics returns the diagnostics of the merged text by file. Every
+// file has an entry, so diagnostics that were fixed are cleared.
+func (s *mergedSource) splitDiagnostics(diagnostics []lsp.Diagnostic) map[lsp.DocumentURI][]lsp.Diagnostic {
+	res := make(map[lsp.DocumentURI][]lsp.Diagnostic, len(s.files))
+	for _, f := range s.files {
+		res[f.uri] = []lsp.Diagnostic{}
+	}
+	for _, d := range diagnostics {
+		uri, rng := s.toFile(d.Range)
+		d.Range = rng
+		res[uri] = append(res[uri], d)
+	}
+	return res
+}
+
+// databaseSource returns the merged source of the database a document
+// belongs to, or nil if it isn't part of one. Open documents are read from
+// the editor and the other files from disk.
+func (l *lspHandler) databaseSource(uri lsp.DocumentURI) *mergedSource {
+	path, ok := uriPath(uri)
+	if !ok {
+		return nil
+	}
+	manifestPath, m, db, err := lookupDatabase(path)
+	if err != nil {
+		l.reportProblem(fmt.Sprintf("error reading %s: %v", manifestPath, err))
+		return nil
+	}
+	if db == nil {
+		return nil
+	}
+
+	open := make(map[string]string)
+	for docURI := range l.docs {
+		if p, ok := uriPath(lsp.DocumentURI(docURI)); ok {
+			open[filepath.Clean(p)] = docURI
+		}
+	}
+
+	var files []sourceFile
+	for _, p := range m.paths(db) {
+		if docURI, ok := open[p]; ok {
+			files = append(files, sourceFile{uri: lsp.DocumentURI(docURI), text: l.docs[docURI].rawKf})
+			continue
+		}
+		text, err := os.ReadFile(p)
+		if err != nil {
+			l.reportProblem(fmt.Sprintf("database %s in %s: %v", db.Name, manifestPath, err))
+			continue
+		}
+		files = append(files, sourceFile{uri: fileURI(p), text: string(text)})
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return mergeSources(db.Name, files)
+}
+
+// databaseParse returns the merged source of the database a document
+// belongs to and its parse, or nil if it isn't part of one.
+func (l *lspHandler) databaseParse(uri lsp.DocumentURI) (*mergedSource, *parse.SchemaParseResult) {
+	src := l.databaseSource(uri)
+	if src == nil {
+		return nil, nil
+	}
+	res, _ := parse.ParseAndValidate([]byte(src.text))
+	return src, res
+}
+
+// declaredIn reports whether a table, action or procedure of the merged
+// source is declared in a file.
+func (s *mergedSource) declaredIn(r *parse.SchemaParseResult, name string, uri lsp.DocumentURI) bool {
+	if r == nil || r.SchemaInfo == nil {
+		return false
+	}
+	block, ok := r.SchemaInfo.Blocks[name]
+	return ok && s.fileAt(block.StartLine-1).uri == uri
+}
+
+// loadManifests reads the manifests of the workspace folders and reports
+// their problems.
+func (l *lspHandler) loadManifests() {
+	for _, folder := range l.folders {
+		dir, ok := uriPath(folder)
+		if !ok {
+			continue
+		}
+		path, m, err := lookupManifest(dir)
+		if err != nil {
+			l.reportProblem(fmt.Sprintf("error reading %s: %v", path, err))
+			continue
+		}
+		if m == nil {
+			continue
+		}
+		for _, problem := range m.problems() {
+			l.reportProblem(fmt.Sprintf("%s: %s", path, problem))
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const (
+	multiFileTables = `table users {
+    id int primary key,
+    name text notnull
+}
+`
+	multiFileActions = `action get_user($id) public view {
+    select * from users where id = $id;
+}
+
+action missing() public view {
+    select * from nope;
+}
+`
+)
+
+func Test_MultiFileDatabase(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		manifestFile:       `{"databases": [{"name": "app", "files": ["app/tables.kf", "app/actions.kf"]}]}`,
+		"app/tables.kf":    multiFileTables,
+		"app/actions.kf":   multiFileActions,
+		"app/unrelated.kf": "database other;\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tablesURI := fileURI(filepath.Join(root, "app", "tables.kf"))
+	actionsURI := fileURI(filepath.Join(root, "app", "actions.kf"))
+
+	l := newLspHandler(newOutputLogger(logs))
+	if src := l.databaseSource(fileURI(filepath.Join(root, "app", "unrelated.kf"))); src != nil {
+		t.Errorf("expected a file outside of the manifest to be analyzed alone")
+	}
+
+	// the open document is used instead of the file on disk
+	l.docs[string(actionsURI)] = &kfDocs{rawKf: multiFileActions}
+	src, res := l.databaseParse(tablesURI)
+	if src == nil || len(src.files) != 2 || src.files[0].uri != tablesURI || src.files[1].uri != actionsURI {
+		t.Fatalf("expected the two files of the database, got %+v", src)
+	}
+	if !strings.HasPrefix(src.text, "database app;\ntable users {") {
+		t.Errorf("unexpected merged text %q", src.text)
+	}
+
+	// diagnostics are reported in the file they belong to
+	_, diagnostics := analyzeKfDocument(src.text, defaultSettings())
+	byFile := src.splitDiagnostics(diagnostics)
+	if len(byFile[tablesURI]) != 0 {
+		t.Errorf("expected no diagnostics for the tables, got %v", byFile[tablesURI])
+	}
+	if ds := byFile[actionsURI]; len(ds) != 1 || !strings.Contains(ds[0].Message, "nope") || ds[0].Range.Start.Line != 5 {
+		t.Errorf("expected the unknown table on line 5 of the actions, got %v", ds)
+	}
+
+	// definitions and references cross files
+	defs := src.toFileLocations(getTokenPosition(actionsURI, res, "get_user"))
+	if len(defs) != 1 || defs[0].URI != actionsURI || defs[0].Range.Start.Line != 0 {
+		t.Errorf("unexpected definition %v", defs)
+	}
+
+	pos := src.toMerged(tablesURI, lsp.Position{Line: 0, Character: 7}) // users
+	refs := src.toFileLocations(getReferences(tablesURI, src.text, res, pos, true))
+	var inActions, inTables bool
+	for _, ref := range refs {
+		inTables = inTables || ref.URI == tablesURI && ref.Range.Start.Line == 0
+		inActions = inActions || ref.URI == actionsURI && ref.Range.Start.Line == 1
+	}
+	if !inTables || !inActions {
+		t.Errorf("expected references in both files, got %v", refs)
+	}
+
+	// per-document requests only return what is in the document
+	symbols := src.fileSymbols(actionsURI, getDocumentSymbols(actionsURI, src.text, res))
+	if len(symbols) != 2 || symbols[0].Name != "get_user" || symbols[0].Location.Range.Start.Line != 0 || symbols[1].Location.Range.Start.Line != 4 {
+		t.Errorf("expected the two actions, got %v", symbols)
+	}
+	folds := src.fileFoldingRanges(tablesURI, getFoldingRanges(src.text))
+	if len(folds) != 1 || folds[0].StartLine != 0 || folds[0].EndLine != 2 {
+		t.Errorf("expected the table to fold, got %v", folds)
+	}
+	lenses := src.fileCodeLenses(tablesURI, getCodeLenses(tablesURI, src.text, res))
+	if len(lenses) != 1 || lenses[0].Range.Start.Line != 0 {
+		t.Fatalf("expected a lens on the table, got %v", lenses)
+	}
+	if locs := lenses[0].Command.Arguments[2].([]lsp.Location); len(locs) != 1 || locs[0].URI != actionsURI || locs[0].Range.Start.Line != 1 {
+		t.Errorf("expected the reference in the actions, got %v", locs)
+	}
+	sel := src.fileSelectionRange(actionsURI, getSelectionRanges(src.text, []lsp.Position{src.toMerged(actionsURI, lsp.Position{Line: 1, Character: 20})})[0])
+	var chain []lsp.Range
+	for r := &sel; r != nil; r = r.Parent {
+		chain = append(chain, r.Range)
+	}
+	if n := len(chain); n < 3 || chain[n-1] != (lsp.Range{End: endPosition(multiFileActions)}) || chain[n-2].Start.Line != 0 || chain[n-2].End.Line != 2 {
+		t.Errorf("expected the selection to grow to the action and the file, got %v", chain)
+	}
+	items := prepareCallHierarchy(actionsURI, src.text, res, src.toMerged(actionsURI, lsp.Position{Line: 4, Character: 8}))
+	if len(items) != 1 || src.toFileItem(items[0]).URI != actionsURI || src.toFileItem(items[0]).SelectionRange.Start.Line != 4 {
+		t.Errorf("expected the missing action, got %v", items)
+	}
+}
+
+func Test_ManifestCommands(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		manifestFile: `{"databases": [{
+			"name": "app",
+			"files": ["app/tables.kf", "app/actions.kf"],
+			"version": "v0.8",
+			"lint": {"rules": {"update-without-where": "error"}}
+		}]}`,
+		"app/tables.kf":  multiFileTables,
+		"app/actions.kf": "action rename($name) public {\n    update users set name = $name;\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the database's lint rules apply, and diagnostics go to their file
+	var out bytes.Buffer
+	var code exitCode
+	if err := runCheck([]string{"-format", "json", root}, &out); !errors.As(err, &code) || code != 1 {
+		t.Fatalf("expected exit code 1, got %v", err)
+	}
+	var report checkJSONReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, out.String())
+	}
+	if len(report.Files) != 2 || report.Errors != 1 || report.Warnings != 0 {
+		t.Fatalf("expected one error in two files, got %+v", report)
+	}
+	for _, file := range report.Files {
+		if strings.HasSuffix(file.Path, "actions.kf") != (len(file.Diagnostics) == 1) {
+			t.Errorf("unexpected diagnostics for %s: %+v", file.Path, file.Diagnostics)
+		}
+		for _, d := range file.Diagnostics {
+			if d.Code != "update-without-where" || d.Severity != "error" || d.Line != 2 {
+				t.Errorf("unexpected diagnostic %+v", d)
+			}
+		}
+	}
+
+	// any file of the database stands for all of it
+	out.Reset()
+	if err := runCompile([]string{filepath.Join(root, "app", "tables.kf")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"name": "app"`) || !strings.Contains(out.String(), `"name": "rename"`) {
+		t.Errorf("expected the compiled database, got\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runSymbols([]string{filepath.Join(root, "app", "actions.kf")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "actions.kf:1:1: action rename\n"; !strings.HasSuffix(out.String(), want) || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("expected only the symbols of the file, got\n%s", out.String())
+	}
+
+	// stdin is another version of a file of the database
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("// no actions yet\n")
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	out.Reset()
+	if err := runDiff([]string{"-", filepath.Join(root, "app", "actions.kf")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "+ action rename: action rename($name) public\n"; out.String() != want {
+		t.Errorf("expected the added action, got\n%s", out.String())
+	}
+
+	// mistakes in the manifest are reported
+	m := &projectManifest{dir: root, Databases: []manifestDatabase{
+		{Name: "app", Files: []string{"app/tables.kf"}},
+		{Name: "app", Files: []string{"app/gone.kf"}},
+		{Name: "other", Files: []string{"app/tables.kf"}},
+	}}
+	if problems := m.problems(); len(problems) != 3 {
+		t.Errorf("expected 3 problems, got %v", problems)
+	}
+}
+
+func Test_WatchProjectFiles(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go acceptTCP(ctx, lis, newOutputLogger(logs))
+
+	client, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registrations := make(chan registrationParams, 1)
+	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(client, jsonrpc2.VSCodeObjectCodec{}),
+		jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			if req.Method == "client/registerCapability" {
+				var params registrationParams
+				json.Unmarshal(*req.Params, &params)
+				registrations <- params
+			}
+			return nil, nil
+		}))
+	defer conn.Close()
+
+	var init initializeParams
+	init.Capabilities.Workspace.DidChangeWatchedFiles = &struct {
+		DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	}{DynamicRegistration: true}
+	var res initializeResult
+	if err := conn.Call(ctx, "initialize", init, &res); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Notify(ctx, "initialized", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case params := <-registrations:
+		raw, _ := json.Marshal(params)
+		if len(params.Registrations) != 1 || params.Registrations[0].Method != "workspace/didChangeWatchedFiles" || !strings.Contains(string(raw), manifestFile) {
+			t.Errorf("unexpected registration %s", raw)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the project files were not watched")
+	}
+}
@@ -0,0 +1,952 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Import of PostgreSQL DDL: the CREATE TABLE, CREATE INDEX and
+// ALTER TABLE ... ADD CONSTRAINT or ADD COLUMN statements of a file, as
+// written by hand or by pg_dump, become the tables of a Kuneiform schema.
+// Anything that has no equivalent is reported as a problem and left out, so
+// the result is a skeleton to review rather than a faithful copy. Names that
+// are Kuneiform keywords get a trailing underscore.
+
+// importProblem is a construct of the DDL that was not imported as written.
+// line is 1-based, or 0 for problems not tied to a line of the DDL.
+type importProblem struct {
+	line    int
+	message string
+	// invalid marks errors of the generated schema.
+	invalid bool
+}
+
+func (p importProblem) String() string {
+	if p.line == 0 {
+		return p.message
+	}
+	return fmt.Sprintf("line %d: %s", p.line, p.message)
+}
+
+type importedTable struct {
+	name    string
+	line    int
+	columns []*importedColumn
+	// primary holds the columns of a composite primary key.
+	primary     []string
+	indexes     []importedIndex
+	foreignKeys []importedForeignKey
+}
+
+type importedColumn struct {
+	name  string
+	typ   string
+	attrs []string
+}
+
+type importedIndex struct {
+	name, kind string // kind is index or unique
+	columns    []string
+}
+
+type importedForeignKey struct {
+	columns    []string
+	parent     string
+	parentKeys []string // empty for the primary key of parent
+	actions    []string
+	line       int
+}
+
+func (t *importedTable) column(name string) *importedColumn {
+	for _, c := range t.columns {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// primaryKey returns the columns of the primary key of t.
+func (t *importedTable) primaryKey() []string {
+	if len(t.primary) > 0 {
+		return t.primary
+	}
+	for _, c := range t.columns {
+		for _, attr := range c.attrs {
+			if attr == "primary key" {
+				return []string{c.name}
+			}
+		}
+	}
+	return nil
+}
+
+type ddlImporter struct {
+	tables   []*importedTable
+	problems []importProblem
+}
+
+// importDDL converts PostgreSQL DDL to a Kuneiform schema for the named
+// database. The schema is validated; its errors are problems too.
+func importDDL(src, source, database string) (string, []importProblem) {
+	im := &ddlImporter{}
+	if name := kuneiformName(database); name != database {
+		im.problems = append(im.problems, importProblem{message: fmt.Sprintf("database name %s is a Kuneiform keyword, renamed to %s", database, name)})
+		database = name
+	}
+	for _, stmt := range splitStatements(src) {
+		im.statement(stmt)
+	}
+	im.resolveForeignKeys()
+	slices.SortStableFunc(im.problems, func(a, b importProblem) int { return a.line - b.line })
+
+	kf := im.render(source, database)
+	res, err := parse.ParseAndValidate([]byte(kf))
+	if err != nil {
+		im.problems = append(im.problems, importProblem{message: fmt.Sprintf("generated schema: %v", err), invalid: true})
+	}
+	for _, d := range getDiagnostics(res) {
+		im.problems = append(im.problems, importProblem{message: fmt.Sprintf("generated schema line %d: %s", d.Range.Start.Line+1, d.Message), invalid: true})
+	}
+	return kf, im.problems
+}
+
+func (im *ddlImporter) problem(tok token, format string, args ...any) {
+	im.problems = append(im.problems, importProblem{line: tok.line + 1, message: fmt.Sprintf(format, args...)})
+}
+
+// declared reports the name declared by tok if it was renamed.
+func (im *ddlImporter) declared(tok token, kind string) {
+	if name := ddlName(tok); name != kuneiformName(name) {
+		im.problem(tok, "%s name %s is a Kuneiform keyword, renamed to %s", kind, name, kuneiformName(name))
+	}
+}
+
+func (im *ddlImporter) table(name string) *importedTable {
+	for _, t := range im.tables {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// splitStatements splits DDL into statements without comments. Function
+// bodies in dollar quotes are kept together.
+func splitStatements(src string) [][]token {
+	l := &lexer{src: src, dashComments: true}
+	var stmts [][]token
+	var stmt []token
+	dollarTag := ""
+	for _, tok := range l.all() {
+		if tok.kind == tokComment {
+			continue
+		}
+		// $$ and $tag$ open and close dollar quotes
+		if tag, ok := dollarQuote(stmt, tok); ok {
+			if dollarTag == "" {
+				dollarTag = tag
+			} else if dollarTag == tag {
+				dollarTag = ""
+			}
+		}
+		if tok.text == ";" && dollarTag == "" {
+			if len(stmt) > 0 {
+				stmts = append(stmts, stmt)
+			}
+			stmt = nil
+			continue
+		}
+		stmt = append(stmt, tok)
+	}
+	if len(stmt) > 0 {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+// dollarQuote reports whether tok ends a dollar quote delimiter.
+func dollarQuote(stmt []token, tok token) (string, bool) {
+	if tok.text != "$" || len(stmt) == 0 {
+		return "", false
+	}
+	prev := stmt[len(stmt)-1]
+	if prev.end() != tok.offset || (prev.text != "$" && prev.kind != tokVariable) {
+		return "", false
+	}
+	return prev.text + "$", true
+}
+
+// ddlTokens is a cursor over the tokens of a statement.
+type ddlTokens struct {
+	toks []token
+	pos  int
+}
+
+func (d *ddlTokens) done() bool {
+	return d.pos >= len(d.toks)
+}
+
+func (d *ddlTokens) peek() token {
+	if d.done() {
+		return token{}
+	}
+	return d.toks[d.pos]
+}
+
+func (d *ddlTokens) next() token {
+	tok := d.peek()
+	d.pos++
+	return tok
+}
+
+// accept consumes the given words if they come next.
+func (d *ddlTokens) accept(words ...string) bool {
+	if d.pos+len(words) > len(d.toks) {
+		return false
+	}
+	for i, w := range words {
+		if !d.toks[d.pos+i].is(w) {
+			return false
+		}
+	}
+	d.pos += len(words)
+	return true
+}
+
+// group consumes a parenthesized group and returns its tokens, without the
+// parentheses, split at top-level commas.
+func (d *ddlTokens) group() ([][]token, bool) {
+	if !d.accept("(") {
+		return nil, false
+	}
+	var items [][]token
+	var item []token
+	depth := 0
+	for !d.done() {
+		tok := d.next()
+		switch tok.text {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			if depth == 0 && tok.text == ")" {
+				return append(items, item), true
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				items = append(items, item)
+				item = nil
+				continue
+			}
+		}
+		item = append(item, tok)
+	}
+	return append(items, item), false
+}
+
+// skipGroup consumes a parenthesized group if one comes next.
+func (d *ddlTokens) skipGroup() {
+	if d.peek().text == "(" {
+		d.group()
+	}
+}
+
+// name consumes a possibly schema-qualified name and returns its last
+// part.
+func (d *ddlTokens) name() (string, bool) {
+	tok := d.peek()
+	if tok.kind != tokIdent && tok.kind != tokString {
+		return "", false
+	}
+	d.next()
+	name := ddlIdent(tok)
+	for d.peek().text == "." {
+		d.next()
+		name = ddlIdent(d.next())
+	}
+	return name, name != ""
+}
+
+// ddlIdent converts a name to the Kuneiform name it is imported as.
+func ddlIdent(tok token) string {
+	return kuneiformName(ddlName(tok))
+}
+
+// ddlName unquotes a name. Kuneiform names are lower case.
+func ddlName(tok token) string {
+	if tok.kind == tokString && strings.HasPrefix(tok.text, `"`) {
+		return strings.ToLower(strings.Trim(tok.text, `"`))
+	}
+	if tok.kind != tokIdent {
+		return ""
+	}
+	return strings.ToLower(tok.text)
+}
+
+// kuneiformKeywords are the words the Kuneiform lexer reserves, which
+// cannot be used as names.
+var kuneiformKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range []string{
+		"database", "use", "table", "action", "procedure", "public", "private",
+		"view", "owner", "foreign", "primary", "key", "on", "do", "unique",
+		"cascade", "restrict", "set", "default", "null", "delete", "update",
+		"references", "ref", "not", "index", "and", "or", "like", "ilike", "in",
+		"between", "is", "exists", "all", "any", "join", "left", "right", "inner",
+		"as", "asc", "desc", "limit", "offset", "order", "by", "group", "having",
+		"returns", "no", "with", "case", "when", "then", "end", "distinct", "from",
+		"where", "collate", "select", "insert", "values", "full", "union",
+		"intersect", "except", "nulls", "first", "last", "returning", "into",
+		"conflict", "nothing", "for", "if", "elseif", "else", "break", "return",
+		"next", "true", "false", "foreign_key", "on_update", "on_delete",
+		"set_default", "set_null", "no_action",
+	} {
+		kuneiformKeywords[kw] = true
+	}
+}
+
+// kuneiformName renames keywords by appending an underscore.
+func kuneiformName(name string) string {
+	if kuneiformKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+// names converts the items of a group to column names.
+func names(items [][]token) ([]string, bool) {
+	var cols []string
+	for _, item := range items {
+		if len(item) == 0 {
+			return nil, false
+		}
+		name := ddlIdent(item[0])
+		// the order of index columns doesn't matter to Kuneiform
+		for _, tok := range item[1:] {
+			if !tok.is("asc") && !tok.is("desc") && !tok.is("nulls") && !tok.is("first") && !tok.is("last") {
+				return nil, false
+			}
+		}
+		if name == "" {
+			return nil, false
+		}
+		cols = append(cols, name)
+	}
+	return cols, len(cols) > 0
+}
+
+func statementText(stmt []token) string {
+	var words []string
+	for _, tok := range stmt {
+		if tok.kind != tokIdent || len(words) == 2 {
+			break
+		}
+		words = append(words, strings.ToUpper(tok.text))
+	}
+	return strings.Join(words, " ")
+}
+
+func (im *ddlImporter) statement(stmt []token) {
+	d := &ddlTokens{toks: stmt}
+	first := d.peek()
+	switch {
+	case d.accept("create", "table"), d.accept("create", "unlogged", "table"):
+		im.createTable(d)
+	case d.accept("create", "temporary", "table"), d.accept("create", "temp", "table"):
+		im.problem(first, "temporary table skipped")
+	case d.accept("create", "unique", "index"):
+		im.createIndex(d, "unique")
+	case d.accept("create", "index"):
+		im.createIndex(d, "index")
+	case d.accept("alter", "table"):
+		im.alterTable(d)
+	case d.accept("create", "schema"):
+		// the database is the schema
+	case first.is("set"), first.is("select"), first.is("begin"), first.is("commit"), first.is("start"):
+		// session settings and transactions of dumps
+	default:
+		im.problem(first, "unsupported statement %s skipped", statementText(stmt))
+	}
+}
+
+func (im *ddlImporter) createTable(d *ddlTokens) {
+	start := d.peek()
+	d.accept("if", "not", "exists")
+	name, ok := d.name()
+	if !ok {
+		im.problem(start, "expected a table name")
+		return
+	}
+	im.declared(d.toks[d.pos-1], "table")
+	if im.table(name) != nil {
+		im.problem(start, "table %s is declared twice, skipped", name)
+		return
+	}
+	elements, ok := d.group()
+	if !ok {
+		im.problem(start, "table %s: expected a list of columns", name)
+		return
+	}
+	t := &importedTable{name: name, line: start.line + 1}
+	im.tables = append(im.tables, t)
+
+	// columns first, so that constraints can refer to them
+	var constraints [][]token
+	for _, el := range elements {
+		if len(el) == 0 {
+			continue
+		}
+		if isTableConstraint(el[0]) {
+			constraints = append(constraints, el)
+			continue
+		}
+		im.column(t, el)
+	}
+	for _, el := range constraints {
+		im.tableConstraint(t, &ddlTokens{toks: el})
+	}
+	if !d.done() {
+		im.problem(d.peek(), "table %s: options from %s on ignored", name, strings.ToUpper(d.peek().text))
+	}
+}
+
+func isTableConstraint(tok token) bool {
+	for _, w := range []string{"constraint", "primary", "unique", "foreign", "check", "exclude", "like"} {
+		if tok.is(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnConstraintWords start the constraints following a column type.
+var columnConstraintWords = []string{"constraint", "not", "null", "primary", "unique", "default", "check", "references", "collate", "generated"}
+
+func isColumnConstraint(tok token) bool {
+	for _, w := range columnConstraintWords {
+		if tok.is(w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *ddlImporter) column(t *importedTable, el []token) {
+	d := &ddlTokens{toks: el}
+	start := d.peek()
+	name := ddlIdent(d.next())
+	if name == "" {
+		im.problem(start, "table %s: expected a column name", t.name)
+		return
+	}
+	im.declared(start, "column")
+	if t.column(name) != nil {
+		im.problem(start, "column %s.%s is declared twice, skipped", t.name, name)
+		return
+	}
+
+	// the type runs until the first constraint
+	typeStart := d.pos
+	for !d.done() && !isColumnConstraint(d.peek()) {
+		if d.peek().text == "(" {
+			d.skipGroup()
+			continue
+		}
+		d.next()
+	}
+	typ, attrs, problem := kuneiformType(d.toks[typeStart:d.pos])
+	if problem != "" {
+		im.problem(start, "column %s.%s: %s", t.name, name, problem)
+	}
+	col := &importedColumn{name: name, typ: typ, attrs: attrs}
+	t.columns = append(t.columns, col)
+
+	for !d.done() {
+		tok := d.next()
+		switch {
+		case tok.is("constraint"):
+			d.next() // the name
+		case tok.is("not") && d.accept("null"):
+			col.attrs = append(col.attrs, "notnull")
+		case tok.is("null"):
+		case tok.is("primary") && d.accept("key"):
+			col.attrs = append(col.attrs, "primary key")
+		case tok.is("unique"):
+			col.attrs = append(col.attrs, "unique")
+		case tok.is("default"):
+			var expr []token
+			for !d.done() && !isColumnConstraint(d.peek()) {
+				expr = append(expr, d.next())
+			}
+			if lit, ok := ddlLiteral(expr); ok {
+				col.attrs = append(col.attrs, "default("+lit+")")
+			} else if !(len(expr) == 1 && expr[0].is("null")) {
+				im.problem(tok, "column %s.%s: default %s is not a literal, dropped", t.name, name, tokensText(expr))
+			}
+		case tok.is("check"):
+			items, _ := d.group()
+			if attrs, ok := checkAttributes(name, items); ok {
+				col.attrs = append(col.attrs, attrs...)
+			} else {
+				im.problem(tok, "column %s.%s: check constraint dropped", t.name, name)
+			}
+		case tok.is("references"):
+			fk := importedForeignKey{columns: []string{name}, line: tok.line + 1}
+			im.references(d, &fk)
+			t.foreignKeys = append(t.foreignKeys, fk)
+		case tok.is("collate"):
+			d.name()
+			im.problem(tok, "column %s.%s: collation ignored", t.name, name)
+		case tok.is("generated"):
+			d.accept("always")
+			d.accept("by", "default")
+			d.accept("as")
+			if d.accept("identity") {
+				im.problem(tok, "column %s.%s: identity dropped, values must be supplied", t.name, name)
+			} else {
+				im.problem(tok, "column %s.%s: generated value dropped", t.name, name)
+			}
+			d.skipGroup()
+			d.accept("stored")
+		default:
+			im.problem(tok, "column %s.%s: unsupported constraint %s ignored", t.name, name, strings.ToUpper(tok.text))
+			for !d.done() && !isColumnConstraint(d.peek()) {
+				d.next()
+			}
+		}
+	}
+}
+
+// references parses REFERENCES parent [(columns)] and the actions of a
+// foreign key.
+func (im *ddlImporter) references(d *ddlTokens, fk *importedForeignKey) {
+	fk.parent, _ = d.name()
+	if d.peek().text == "(" {
+		items, _ := d.group()
+		fk.parentKeys, _ = names(items)
+	}
+	for !d.done() {
+		start := d.peek()
+		switch {
+		case d.accept("on", "delete"):
+			fk.actions = append(fk.actions, "on_delete "+foreignKeyAction(d))
+		case d.accept("on", "update"):
+			fk.actions = append(fk.actions, "on_update "+foreignKeyAction(d))
+		case d.accept("match"):
+			d.next()
+		case d.accept("not", "deferrable"), d.accept("deferrable"), d.accept("initially", "deferred"), d.accept("initially", "immediate"), d.accept("not", "valid"):
+		default:
+			if isColumnConstraint(start) {
+				return
+			}
+			d.next()
+			im.problem(start, "foreign key option %s ignored", strings.ToUpper(start.text))
+		}
+	}
+}
+
+func foreignKeyAction(d *ddlTokens) string {
+	switch {
+	case d.accept("cascade"):
+		return "cascade"
+	case d.accept("restrict"):
+		return "restrict"
+	case d.accept("set", "null"):
+		return "set_null"
+	case d.accept("set", "default"):
+		return "set_default"
+	default:
+		d.accept("no", "action")
+		return "no_action"
+	}
+}
+
+func (im *ddlImporter) tableConstraint(t *importedTable, d *ddlTokens) {
+	name := ""
+	if d.accept("constraint") {
+		im.declared(d.peek(), "constraint")
+		name = ddlIdent(d.next())
+	}
+	start := d.peek()
+	switch {
+	case d.accept("primary", "key"):
+		items, _ := d.group()
+		cols, ok := names(items)
+		if !ok || !im.hasColumns(t, start, cols) {
+			im.problem(start, "table %s: primary key dropped", t.name)
+			return
+		}
+		if len(cols) == 1 {
+			t.column(cols[0]).attrs = append(t.column(cols[0]).attrs, "primary key")
+		} else {
+			t.primary = cols
+		}
+	case d.accept("unique"):
+		items, _ := d.group()
+		cols, ok := names(items)
+		if !ok || !im.hasColumns(t, start, cols) {
+			im.problem(start, "table %s: unique constraint dropped", t.name)
+			return
+		}
+		if name == "" {
+			name = t.name + "_" + strings.Join(cols, "_") + "_key"
+		}
+		t.indexes = append(t.indexes, importedIndex{name: name, kind: "unique", columns: cols})
+	case d.accept("foreign", "key"):
+		items, _ := d.group()
+		cols, ok := names(items)
+		if !ok || !d.accept("references") || !im.hasColumns(t, start, cols) {
+			im.problem(start, "table %s: foreign key dropped", t.name)
+			return
+		}
+		fk := importedForeignKey{columns: cols, line: start.line + 1}
+		im.references(d, &fk)
+		t.foreignKeys = append(t.foreignKeys, fk)
+	default:
+		im.problem(start, "table %s: %s constraint dropped", t.name, strings.ToUpper(start.text))
+	}
+}
+
+func (im *ddlImporter) hasColumns(t *importedTable, tok token, cols []string) bool {
+	for _, c := range cols {
+		if t.column(c) == nil {
+			im.problem(tok, "table %s has no column %s", t.name, c)
+			return false
+		}
+	}
+	return true
+}
+
+func (im *ddlImporter) createIndex(d *ddlTokens, kind string) {
+	start := d.peek()
+	d.accept("concurrently")
+	d.accept("if", "not", "exists")
+	name := ""
+	if !d.peek().is("on") {
+		name, _ = d.name()
+		im.declared(d.toks[d.pos-1], "index")
+	}
+	if !d.accept("on") {
+		im.problem(start, "expected ON in CREATE INDEX")
+		return
+	}
+	d.accept("only")
+	tableName, _ := d.name()
+	t := im.table(tableName)
+	if t == nil {
+		im.problem(start, "index %s on unknown table %s skipped", name, tableName)
+		return
+	}
+	if d.accept("using") {
+		if method := d.next(); !method.is("btree") {
+			im.problem(method, "index %s: %s index imported as a btree index", name, strings.ToUpper(method.text))
+		}
+	}
+	items, _ := d.group()
+	cols, ok := names(items)
+	if !ok || !im.hasColumns(t, start, cols) {
+		im.problem(start, "index %s: only indexes on columns are supported, skipped", name)
+		return
+	}
+	if !d.done() {
+		if d.peek().is("where") {
+			im.problem(d.peek(), "partial index %s skipped", name)
+			return
+		}
+		im.problem(d.peek(), "index %s: options from %s on ignored", name, strings.ToUpper(d.peek().text))
+	}
+	if name == "" {
+		name = t.name + "_" + strings.Join(cols, "_") + "_idx"
+	}
+	t.indexes = append(t.indexes, importedIndex{name: name, kind: kind, columns: cols})
+}
+
+// alterTable handles the ADD CONSTRAINT statements pg_dump writes for keys,
+// and added columns.
+func (im *ddlImporter) alterTable(d *ddlTokens) {
+	start := d.peek()
+	d.accept("if", "exists")
+	d.accept("only")
+	name, _ := d.name()
+	t := im.table(name)
+	switch {
+	case d.peek().is("owner"):
+		// ownership doesn't apply
+		return
+	case t == nil:
+		im.problem(start, "ALTER TABLE of unknown table %s skipped", name)
+		return
+	}
+
+	for _, action := range splitCommas(d.toks[d.pos:]) {
+		a := &ddlTokens{toks: action}
+		switch {
+		case !a.accept("add"):
+			im.problem(a.peek(), "unsupported ALTER TABLE %s %s skipped", name, strings.ToUpper(a.peek().text))
+		case a.accept("column") || !isTableConstraint(a.peek()):
+			a.accept("if", "not", "exists")
+			im.column(t, a.toks[a.pos:])
+		default:
+			im.tableConstraint(t, a)
+		}
+	}
+}
+
+// splitCommas splits tokens at top-level commas.
+func splitCommas(toks []token) [][]token {
+	var parts [][]token
+	var part []token
+	depth := 0
+	for _, tok := range toks {
+		switch tok.text {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ",":
+			if depth == 0 {
+				parts = append(parts, part)
+				part = nil
+				continue
+			}
+		}
+		part = append(part, tok)
+	}
+	return append(parts, part)
+}
+
+// resolveForeignKeys runs after all statements, since dumps add the keys
+// after creating the tables.
+func (im *ddlImporter) resolveForeignKeys() {
+	for _, t := range im.tables {
+		if len(t.primaryKey()) == 0 {
+			im.problems = append(im.problems, importProblem{line: t.line, message: fmt.Sprintf("table %s has no primary key, which Kuneiform requires", t.name)})
+		}
+		var kept []importedForeignKey
+		for _, fk := range t.foreignKeys {
+			parent := im.table(fk.parent)
+			if parent == nil {
+				im.problems = append(im.problems, importProblem{line: fk.line, message: fmt.Sprintf("table %s: foreign key to unknown table %s dropped", t.name, fk.parent)})
+				continue
+			}
+			if len(fk.parentKeys) == 0 {
+				fk.parentKeys = parent.primaryKey()
+			}
+			kept = append(kept, fk)
+		}
+		t.foreignKeys = kept
+	}
+}
+
+// kuneiformType maps a PostgreSQL type to a Kuneiform type and the
+// attributes that carry its limits.
+func kuneiformType(toks []token) (typ string, attrs []string, problem string) {
+	var words []string
+	var args []string
+	array := false
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch {
+		case tok.text == "[":
+			array = true
+		case tok.text == "]", tok.text == "(", tok.text == ")", tok.text == ",":
+			if tok.text == "(" {
+				for i++; i < len(toks) && toks[i].text != ")"; i++ {
+					if toks[i].kind == tokNumber {
+						args = append(args, toks[i].text)
+					}
+				}
+			}
+		case tok.text == ".":
+			words = nil // schema-qualified type
+		case tok.is("array"):
+			array = true
+		default:
+			words = append(words, strings.ToLower(tok.text))
+		}
+	}
+	name := strings.Join(words, " ")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, " with time zone"), " without time zone")
+
+	switch name {
+	case "text", "citext", "name":
+		typ = "text"
+	case "varchar", "character varying", "char", "character", "bpchar":
+		typ = "text"
+		if len(args) == 1 {
+			attrs = append(attrs, "maxlen("+args[0]+")")
+		}
+	case "int", "integer", "int4", "int8", "bigint", "smallint", "int2":
+		typ = "int"
+	case "serial", "serial4", "bigserial", "serial8", "smallserial", "serial2":
+		typ, problem = "int", "serial mapped to int, values must be supplied"
+	case "bool", "boolean":
+		typ = "bool"
+	case "bytea":
+		typ = "blob"
+	case "uuid":
+		typ = "uuid"
+	case "uint256":
+		typ = "uint256"
+	case "numeric", "decimal":
+		if len(args) == 0 {
+			typ, problem = "decimal(1000,0)", "numeric without precision mapped to decimal(1000,0)"
+			break
+		}
+		scale := "0"
+		if len(args) > 1 {
+			scale = args[1]
+		}
+		typ = "decimal(" + args[0] + "," + scale + ")"
+	case "timestamp", "timestamptz", "date", "time", "timetz":
+		typ, problem = "int", name+" mapped to int, e.g. for unix time"
+	case "json", "jsonb", "xml", "inet", "cidr", "macaddr", "interval", "money":
+		typ, problem = "text", name+" mapped to text"
+	case "real", "float4", "double precision", "float8", "float":
+		typ, problem = "text", name+" has no exact equivalent, mapped to text; consider decimal"
+	default:
+		typ, problem = "text", fmt.Sprintf("unknown type %q mapped to text", name)
+	}
+	if array {
+		// limits would apply to the elements, which Kuneiform can't express
+		return typ + "[]", nil, problem
+	}
+	return typ, attrs, problem
+}
+
+// ddlLiteral converts a literal default value, dropping casts like
+// 'x'::text.
+func ddlLiteral(expr []token) (string, bool) {
+	for i, tok := range expr {
+		if tok.text == "::" {
+			expr = expr[:i]
+			break
+		}
+	}
+	if len(expr) > 0 && expr[0].text == "(" && expr[len(expr)-1].text == ")" {
+		expr = expr[1 : len(expr)-1]
+	}
+	switch {
+	case len(expr) == 1 && expr[0].kind == tokNumber:
+		return expr[0].text, true
+	case len(expr) == 2 && expr[0].text == "-" && expr[1].kind == tokNumber:
+		return "-" + expr[1].text, true
+	case len(expr) == 1 && expr[0].kind == tokString && strings.HasPrefix(expr[0].text, "'"):
+		return expr[0].text, true
+	case len(expr) == 1 && (expr[0].is("true") || expr[0].is("false")):
+		return strings.ToLower(expr[0].text), true
+	}
+	return "", false
+}
+
+func tokensText(toks []token) string {
+	var b strings.Builder
+	for i, tok := range toks {
+		if i > 0 && toks[i-1].end() != tok.offset {
+			b.WriteString(" ")
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// checkAttributes converts simple checks on the column, like
+// col >= 0 or length(col) <= 64, to attributes.
+func checkAttributes(col string, items [][]token) ([]string, bool) {
+	if len(items) != 1 {
+		return nil, false
+	}
+	var attrs []string
+	for _, cond := range splitAnd(items[0]) {
+		attr, ok := checkAttribute(col, cond)
+		if !ok {
+			return nil, false
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, len(attrs) > 0
+}
+
+func splitAnd(toks []token) [][]token {
+	var parts [][]token
+	var part []token
+	for _, tok := range toks {
+		if tok.is("and") {
+			parts = append(parts, part)
+			part = nil
+			continue
+		}
+		part = append(part, tok)
+	}
+	return append(parts, part)
+}
+
+func checkAttribute(col string, cond []token) (string, bool) {
+	if len(cond) > 0 && cond[0].text == "(" && cond[len(cond)-1].text == ")" {
+		cond = cond[1 : len(cond)-1]
+	}
+	length := false
+	switch {
+	case len(cond) == 3 && ddlIdent(cond[0]) == col:
+		cond = cond[1:]
+	case len(cond) == 6 && (cond[0].is("length") || cond[0].is("char_length") || cond[0].is("octet_length")) &&
+		cond[1].text == "(" && ddlIdent(cond[2]) == col && cond[3].text == ")":
+		length, cond = true, cond[4:]
+	default:
+		return "", false
+	}
+	n, err := strconv.Atoi(cond[1].text)
+	if err != nil {
+		return "", false
+	}
+	attr := ""
+	switch cond[0].text {
+	case ">=":
+		attr = "min"
+	case ">":
+		attr, n = "min", n+1
+	case "<=":
+		attr = "max"
+	case "<":
+		attr, n = "max", n-1
+	default:
+		return "", false
+	}
+	if length {
+		attr += "len"
+	}
+	return fmt.Sprintf("%s(%d)", attr, n), true
+}
+
+func (im *ddlImporter) render(source, database string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Imported from %s by %s import.\n\n", source, binaryName)
+	fmt.Fprintf(&b, "database %s;\n", database)
+	for _, t := range im.tables {
+		var items []string
+		for _, c := range t.columns {
+			items = append(items, strings.Join(append([]string{c.name, c.typ}, c.attrs...), " "))
+		}
+		if len(t.primary) > 0 {
+			items = append(items, fmt.Sprintf("#%s_pkey primary(%s)", t.name, strings.Join(t.primary, ", ")))
+		}
+		for _, idx := range t.indexes {
+			items = append(items, fmt.Sprintf("#%s %s(%s)", idx.name, idx.kind, strings.Join(idx.columns, ", ")))
+		}
+		for _, fk := range t.foreignKeys {
+			item := fmt.Sprintf("foreign_key (%s) references %s(%s)", strings.Join(fk.columns, ", "), fk.parent, strings.Join(fk.parentKeys, ", "))
+			for _, action := range fk.actions {
+				item += " " + action
+			}
+			items = append(items, item)
+		}
+		fmt.Fprintf(&b, "\ntable %s {\n    %s\n}\n", t.name, strings.Join(items, ",\n    "))
+	}
+	return b.String()
+}
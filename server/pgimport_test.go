@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+func Test_ImportDDL(t *testing.T) {
+	ddl := `-- dumped
+SET statement_timeout = 0;
+
+CREATE TABLE public.orgs (
+    id bigint NOT NULL,
+    name character varying(100) NOT NULL,
+    created_at timestamp without time zone DEFAULT now()
+);
+
+CREATE TABLE "Users" (
+    id uuid PRIMARY KEY,
+    org_id bigint REFERENCES orgs ON DELETE CASCADE,
+    age integer CHECK (age >= 0 AND age < 150) DEFAULT 18,
+    nick text DEFAULT 'none'::text,
+    score numeric(10, 2),
+    CONSTRAINT nick_chk CHECK (nick <> '')
+);
+
+CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql;
+
+ALTER TABLE ONLY public.orgs ADD CONSTRAINT orgs_pkey PRIMARY KEY (id);
+CREATE UNIQUE INDEX orgs_name_idx ON public.orgs USING btree (name);
+CREATE INDEX users_nick_lower ON users (lower(nick));
+`
+	kf, problems := importDDL(ddl, "app.sql", "app")
+	want := `// Imported from app.sql by kuneiform-lsp import.
+
+database app;
+
+table orgs {
+    id int notnull primary key,
+    name text maxlen(100) notnull,
+    created_at int,
+    #orgs_name_idx unique(name)
+}
+
+table users {
+    id uuid primary key,
+    org_id int,
+    age int min(0) max(149) default(18),
+    nick text default('none'),
+    score decimal(10,2),
+    foreign_key (org_id) references orgs(id) on_delete cascade
+}
+`
+	if kf != want {
+		t.Errorf("expected schema\n%s\ngot\n%s", want, kf)
+	}
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	wantProblems := []string{
+		"line 7: column orgs.created_at: timestamp mapped to int, e.g. for unix time",
+		"line 7: column orgs.created_at: default now() is not a literal, dropped",
+		"line 16: table users: CHECK constraint dropped",
+		"line 19: unsupported statement CREATE FUNCTION skipped",
+		"line 23: index users_nick_lower: only indexes on columns are supported, skipped",
+	}
+	if strings.Join(got, "\n") != strings.Join(wantProblems, "\n") {
+		t.Errorf("expected problems\n%s\ngot\n%s", strings.Join(wantProblems, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func Test_ImportDDLInvalid(t *testing.T) {
+	_, problems := importDDL(`CREATE TABLE logs (msg text);`, "logs.sql", "logs")
+	if len(problems) == 0 || problems[0].String() != "line 1: table logs has no primary key, which Kuneiform requires" {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	if last := problems[len(problems)-1]; last.line != 0 || !strings.HasPrefix(last.message, "generated schema") {
+		t.Errorf("expected the errors of the generated schema, got %v", problems)
+	}
+}
+
+// Exported DDL imports as the schema it came from.
+func Test_ImportExportedDDL(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(ddlTestSchema))
+	ddl, err := renderDDL(res.Schema, "ds_shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kf, problems := importDDL(ddl, "shop.sql", "shop")
+	if len(problems) != 1 || !strings.Contains(problems[0].message, "CREATE DOMAIN") {
+		t.Errorf("expected only the uint256 domain to be skipped, got %v", problems)
+	}
+	imported, _ := parse.ParseAndValidate([]byte(kf))
+	if err := imported.Err(); err != nil {
+		t.Fatalf("imported schema has errors: %v\n%s", err, kf)
+	}
+	// composite primary keys have no name in the DDL
+	for _, c := range diffSchemas(res, imported) {
+		if c.Kind != "index" || !strings.Contains(c.Old+c.New, "primary(") {
+			t.Errorf("unexpected change %v\n%s", c, kf)
+		}
+	}
+}
+
+func Test_ImportDDLKeywords(t *testing.T) {
+	ddl := `CREATE TABLE "order" (
+    id int PRIMARY KEY,
+    "desc" text,
+    CONSTRAINT key UNIQUE ("desc")
+);
+CREATE TABLE items (
+    id int PRIMARY KEY,
+    order_id int REFERENCES "order" (id)
+);
+ALTER TABLE "order" ADD COLUMN note text NOT NULL, ADD total int;
+ALTER TABLE items DROP COLUMN order_id;
+`
+	kf, problems := importDDL(ddl, "in.sql", databaseName("in.sql"))
+	want := `// Imported from in.sql by kuneiform-lsp import.
+
+database in_;
+
+table order_ {
+    id int primary key,
+    desc_ text,
+    note text notnull,
+    total int,
+    #key_ unique(desc_)
+}
+
+table items {
+    id int primary key,
+    order_id int,
+    foreign_key (order_id) references order_(id)
+}
+`
+	if kf != want {
+		t.Errorf("expected schema\n%s\ngot\n%s", want, kf)
+	}
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	wantProblems := []string{
+		"database name in is a Kuneiform keyword, renamed to in_",
+		"line 1: table name order is a Kuneiform keyword, renamed to order_",
+		"line 3: column name desc is a Kuneiform keyword, renamed to desc_",
+		"line 4: constraint name key is a Kuneiform keyword, renamed to key_",
+		"line 11: unsupported ALTER TABLE items DROP skipped",
+	}
+	if strings.Join(got, "\n") != strings.Join(wantProblems, "\n") {
+		t.Errorf("expected problems\n%s\ngot\n%s", strings.Join(wantProblems, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import "github.com/sourcegraph/go-lsp"
+
+// Protocol types that go-lsp predates. They follow the LSP 3.17
+// specification, limited to the fields the server uses.
+
+type serverCapabilities struct {
+	lsp.ServerCapabilities
+	FoldingRangeProvider   bool `json:"foldingRangeProvider,omitempty"`
+	SelectionRangeProvider bool `json:"selectionRangeProvider,omitempty"`
+	InlayHintProvider      bool `json:"inlayHintProvider,omitempty"`
+	CallHierarchyProvider  bool `json:"callHierarchyProvider,omitempty"`
+	// CodeActionProvider replaces go-lsp's boolean, which can't ask for
+	// codeAction/resolve.
+	CodeActionProvider *codeActionOptions `json:"codeActionProvider,omitempty"`
+}
+
+type codeActionOptions struct {
+	ResolveProvider bool `json:"resolveProvider,omitempty"`
+}
+
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+}
+
+type foldingRangeParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+const foldingRangeComment = "comment"
+
+type foldingRange struct {
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Kind      string `json:"kind,omitempty"`
+}
+
+type selectionRangeParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Positions    []lsp.Position             `json:"positions"`
+}
+
+type selectionRange struct {
+	Range  lsp.Range       `json:"range"`
+	Parent *selectionRange `json:"parent,omitempty"`
+}
+
+type inlayHintParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Range        lsp.Range                  `json:"range"`
+}
+
+const (
+	inlayHintType      = 1
+	inlayHintParameter = 2
+)
+
+type inlayHint struct {
+	Position     lsp.Position `json:"position"`
+	Label        string       `json:"label"`
+	Kind         int          `json:"kind,omitempty"`
+	PaddingLeft  bool         `json:"paddingLeft,omitempty"`
+	PaddingRight bool         `json:"paddingRight,omitempty"`
+}
+
+type callHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           lsp.SymbolKind  `json:"kind"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            lsp.DocumentURI `json:"uri"`
+	Range          lsp.Range       `json:"range"`
+	SelectionRange lsp.Range       `json:"selectionRange"`
+}
+
+type callHierarchyCallsParams struct {
+	Item callHierarchyItem `json:"item"`
+}
+
+type callHierarchyIncomingCall struct {
+	From       callHierarchyItem `json:"from"`
+	FromRanges []lsp.Range       `json:"fromRanges"`
+}
+
+type callHierarchyOutgoingCall struct {
+	To         callHierarchyItem `json:"to"`
+	FromRanges []lsp.Range       `json:"fromRanges"`
+}
+
+// documentParams are the parameters of the server's own requests about a
+// whole document, e.g. kuneiform/dataAccess.
+type documentParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// markupContent is the documentation format replacing go-lsp's marked
+// strings.
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+const markupMarkdown = "markdown"
+
+type hover struct {
+	Contents markupContent `json:"contents"`
+	Range    *lsp.Range    `json:"range,omitempty"`
+}
+
+// schemaDiffParams are the parameters of kuneiform/schemaDiff. Base is the
+// text of the version to compare the document with, e.g. its last commit.
+type schemaDiffParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+	Base         string                     `json:"base"`
+}
+
+type codeAction struct {
+	Title string             `json:"title"`
+	Kind  lsp.CodeActionKind `json:"kind,omitempty"`
+	Edit  *workspaceEdit     `json:"edit,omitempty"`
+	Data  *codeActionData    `json:"data,omitempty"`
+}
+
+// codeActionData identifies the client a code action generates until it is
+// resolved.
+type codeActionData struct {
+	URI      lsp.DocumentURI `json:"uri"`
+	Language string          `json:"language"`
+}
+
+// workspaceEdit holds documentChanges, which go-lsp's WorkspaceEdit lacks.
+// Its elements are createFile and textDocumentEdit.
+type workspaceEdit struct {
+	DocumentChanges []any `json:"documentChanges"`
+}
+
+type createFile struct {
+	Kind    string          `json:"kind"` // always "create"
+	URI     lsp.DocumentURI `json:"uri"`
+	Options struct {
+		Overwrite bool `json:"overwrite,omitempty"`
+	} `json:"options"`
+}
+
+type textDocumentEdit struct {
+	TextDocument struct {
+		URI     lsp.DocumentURI `json:"uri"`
+		Version *int            `json:"version"`
+	} `json:"textDocument"`
+	Edits []lsp.TextEdit `json:"edits"`
+}
+
+// registrationParams are the parameters of client/registerCapability.
+type registrationParams struct {
+	Registrations []registration `json:"registrations"`
+}
+
+type registration struct {
+	ID              string `json:"id"`
+	Method          string `json:"method"`
+	RegisterOptions any    `json:"registerOptions,omitempty"`
+}
+
+type didChangeWatchedFilesRegistrationOptions struct {
+	Watchers []fileSystemWatcher `json:"watchers"`
+}
+
+type fileSystemWatcher struct {
+	GlobPattern string `json:"globPattern"`
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// References are the occurrences found by document highlights, as locations.
+// Code lenses above tables, actions and procedures count them, and the calls
+// of actions and procedures, so unused declarations stand out.
+
+// showReferencesCommand is implemented by the client: it shows the locations
+// passed as arguments in the references peek view.
+const showReferencesCommand = "kuneiform.showReferences"
+
+func getReferences(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult, pos lsp.Position, includeDeclaration bool) []lsp.Location {
+	locs := make([]lsp.Location, 0)
+	for _, h := range getDocumentHighlights(text, r, pos) {
+		if h.Kind == int(lsp.Text) && !includeDeclaration {
+			continue
+		}
+		locs = append(locs, lsp.Location{URI: uri, Range: h.Range})
+	}
+	return locs
+}
+
+func getCodeLenses(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult) []lsp.CodeLens {
+	lenses := make([]lsp.CodeLens, 0)
+	if r == nil || r.Schema == nil || r.SchemaInfo == nil {
+		return lenses
+	}
+	toks := lexKf(text)
+	graph := buildCallGraph(toks, r)
+
+	names := make([]string, 0, len(r.SchemaInfo.Blocks))
+	for name := range r.SchemaInfo.Blocks {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return r.SchemaInfo.Blocks[names[i]].AbsStart < r.SchemaInfo.Blocks[names[j]].AbsStart
+	})
+
+	for _, name := range names {
+		block := r.SchemaInfo.Blocks[name]
+		keyword, ok := tokenAtOffset(toks, block.AbsStart)
+		if !ok || !(keyword.is("table") || keyword.is("action") || keyword.is("procedure")) {
+			continue
+		}
+		nameTok, ok := declaredName(toks, block, name)
+		if !ok {
+			continue
+		}
+		rng := tokenRange(nameTok)
+
+		refs := getReferences(uri, text, r, rng.Start, false)
+		lenses = append(lenses, referencesLens(uri, rng, plural(len(refs), "reference", "references"), refs))
+
+		if keyword.is("table") {
+			continue
+		}
+		var calls []lsp.Location
+		for _, call := range graph.callsTo(name) {
+			calls = append(calls, lsp.Location{URI: uri, Range: call.rng})
+		}
+		lenses = append(lenses, referencesLens(uri, rng, callersTitle(r, graph.callers(name)), calls))
+	}
+	return lenses
+}
+
+// declaredName returns the token naming the declaration of a block.
+func declaredName(toks []token, block *parse.Block, name string) (token, bool) {
+	for i := tokenIndexAt(toks, block.AbsStart); i >= 0 && i < len(toks) && toks[i].offset <= block.AbsEnd; i++ {
+		if toks[i].kind == tokIdent && toks[i].is(name) {
+			return toks[i], true
+		}
+	}
+	return token{}, false
+}
+
+func referencesLens(uri lsp.DocumentURI, rng lsp.Range, title string, locs []lsp.Location) lsp.CodeLens {
+	if locs == nil {
+		locs = make([]lsp.Location, 0)
+	}
+	return lsp.CodeLens{
+		Range: rng,
+		Command: lsp.Command{
+			Title:     title,
+			Command:   showReferencesCommand,
+			Arguments: []any{uri, rng.Start, locs},
+		},
+	}
+}
+
+// callersTitle describes the callers of an action or procedure, e.g.
+// "called by 2 actions, 1 procedure".
+func callersTitle(r *parse.SchemaParseResult, callers []string) string {
+	actions, procedures := 0, 0
+	for _, caller := range callers {
+		if isAction(r, caller) {
+			actions++
+		} else {
+			procedures++
+		}
+	}
+
+	var parts []string
+	if actions > 0 {
+		parts = append(parts, plural(actions, "action", "actions"))
+	}
+	if procedures > 0 {
+		parts = append(parts, plural(procedures, "procedure", "procedures"))
+	}
+	if len(parts) == 0 {
+		return "not called"
+	}
+	return "called by " + strings.Join(parts, ", ")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, one)
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_CodeLenses(t *testing.T) {
+	src := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+table unused {
+    id int primary key
+}
+
+procedure get_name($id uuid) public view returns (name text) {
+    for $row in SELECT name FROM users WHERE id = $id {
+        return $row.name;
+    }
+}
+
+procedure greet($id uuid) public view returns (greeting text) {
+    return 'hello ' || get_name($id);
+}
+
+action rename($id, $name) public {
+    UPDATE users SET name = $name WHERE id = $id;
+}
+
+action hello($id) public {
+    rename($id, 'hello');
+}
+`
+	res, _ := parse.ParseAndValidate([]byte(src))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	uri := lsp.DocumentURI("file:///glow.kf")
+	var titles []string
+	for _, lens := range getCodeLenses(uri, src, res) {
+		titles = append(titles, lens.Command.Title)
+		if lens.Command.Command != showReferencesCommand {
+			t.Errorf("unexpected command %q", lens.Command.Command)
+		}
+	}
+
+	want := []string{
+		"2 references",                         // users
+		"0 references",                         // unused
+		"1 reference", "called by 1 procedure", // get_name
+		"0 references", "not called", // greet
+		"1 reference", "called by 1 action", // rename
+		"0 references", "not called", // hello
+	}
+	if len(titles) != len(want) {
+		t.Fatalf("expected lenses %q, got %q", want, titles)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Errorf("lens %d: expected %q, got %q", i, want[i], titles[i])
+		}
+	}
+
+	// references to get_name, with and without its declaration
+	pos := lsp.Position{Line: 11, Character: 12}
+	if refs := getReferences(uri, src, res, pos, true); len(refs) != 2 {
+		t.Errorf("expected 2 references with the declaration, got %v", refs)
+	}
+	if refs := getReferences(uri, src, res, pos, false); len(refs) != 1 || refs[0].Range.Start.Line != 18 {
+		t.Errorf("expected 1 reference without the declaration, got %v", refs)
+	}
+}
@@ -16,6 +16,17 @@ const (
 type kfDocs struct {
 	rawKf        string
 	parsedSchema *parse.SchemaParseResult
+	parsedKf     string // the text parsedSchema was parsed from
+}
+
+// currentParse returns the parse of the document's current text. The last
+// valid parse is reused if the text hasn't changed since.
+func (d *kfDocs) currentParse() *parse.SchemaParseResult {
+	if d.parsedSchema != nil && d.parsedKf == d.rawKf {
+		return d.parsedSchema
+	}
+	res, _ := parse.ParseAndValidate([]byte(d.rawKf))
+	return res
 }
 
 // Action and Procedure
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Schema diffs: what changed between two versions of a schema, e.g. the
+// last commit and the working tree. A change is breaking if clients or
+// existing data may no longer work with the new schema:
+//
+//   - tables and columns are removed or change type,
+//   - constraints get stricter: new columns with notnull and no default, new
+//     notnull, unique or primary key attributes, new or narrower min, max,
+//     minlen or maxlen bounds, unique or primary indexes or foreign keys,
+//   - public actions and procedures are removed, made private, change their
+//     parameters or return types, stop being views or start requiring an
+//     owner or authentication.
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+type schemaChange struct {
+	// Change is added, removed or changed.
+	Change string `json:"change"`
+	// Kind is table, column, index, foreign key, extension, action,
+	// procedure or foreign procedure.
+	Kind string `json:"kind"`
+	// Name is the name of the object, table.name for columns, indexes and
+	// foreign keys.
+	Name     string `json:"name"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+	Breaking bool   `json:"breaking"`
+	// Reason explains why a change is breaking.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (c schemaChange) String() string {
+	var s string
+	switch c.Change {
+	case changeAdded:
+		s = fmt.Sprintf("+ %s %s: %s", c.Kind, c.Name, c.New)
+	case changeRemoved:
+		s = fmt.Sprintf("- %s %s: %s", c.Kind, c.Name, c.Old)
+	default:
+		s = fmt.Sprintf("~ %s %s: %s -> %s", c.Kind, c.Name, c.Old, c.New)
+	}
+	if c.Breaking {
+		s += " (breaking: " + c.Reason + ")"
+	}
+	return s
+}
+
+// diffSchemas compares two valid parses. Changes are listed by kind in
+// declaration order, with removals first.
+func diffSchemas(old, new *parse.SchemaParseResult) []schemaChange {
+	changes := make([]schemaChange, 0)
+	if old == nil || old.Schema == nil || new == nil || new.Schema == nil {
+		return changes
+	}
+	changes = append(changes, diffTables(old.Schema, new.Schema)...)
+	changes = append(changes, diffExtensions(old.Schema, new.Schema)...)
+	changes = append(changes, diffMethods("action", actionDecls(old.Schema), actionDecls(new.Schema))...)
+	changes = append(changes, diffMethods("procedure", procedureDecls(old.Schema), procedureDecls(new.Schema))...)
+	changes = append(changes, diffMethods("foreign procedure", foreignProcedureDecls(old.Schema), foreignProcedureDecls(new.Schema))...)
+	return changes
+}
+
+// hasBreakingChanges reports whether any of the changes is breaking.
+func hasBreakingChanges(changes []schemaChange) bool {
+	return slices.ContainsFunc(changes, func(c schemaChange) bool { return c.Breaking })
+}
+
+func diffTables(old, new *types.Schema) []schemaChange {
+	var changes []schemaChange
+	for _, t := range old.Tables {
+		if _, ok := new.FindTable(t.Name); !ok {
+			changes = append(changes, schemaChange{Change: changeRemoved, Kind: "table", Name: t.Name, Old: t.Name,
+				Breaking: true, Reason: "its data is dropped"})
+		}
+	}
+	for _, t := range new.Tables {
+		prev, ok := old.FindTable(t.Name)
+		if !ok {
+			changes = append(changes, schemaChange{Change: changeAdded, Kind: "table", Name: t.Name, New: t.Name})
+			continue
+		}
+		changes = append(changes, diffColumns(prev, t)...)
+		changes = append(changes, diffIndexes(prev, t)...)
+		changes = append(changes, diffForeignKeys(prev, t)...)
+	}
+	return changes
+}
+
+func columnText(col *types.Column) string {
+	parts := []string{col.Type.String()}
+	for _, attr := range col.Attributes {
+		parts = append(parts, attributeText(attr))
+	}
+	return strings.Join(parts, " ")
+}
+
+func diffColumns(old, new *types.Table) []schemaChange {
+	var changes []schemaChange
+	for _, col := range old.Columns {
+		if _, ok := new.FindColumn(col.Name); !ok {
+			changes = append(changes, schemaChange{Change: changeRemoved, Kind: "column", Name: new.Name + "." + col.Name, Old: columnText(col),
+				Breaking: true, Reason: "its data is dropped"})
+		}
+	}
+	for _, col := range new.Columns {
+		name := new.Name + "." + col.Name
+		prev, ok := old.FindColumn(col.Name)
+		if !ok {
+			c := schemaChange{Change: changeAdded, Kind: "column", Name: name, New: columnText(col)}
+			if col.HasAttribute(types.NOT_NULL) && !col.HasAttribute(types.DEFAULT) {
+				c.Breaking, c.Reason = true, "existing rows have no value for it"
+			}
+			changes = append(changes, c)
+			continue
+		}
+		if columnText(prev) == columnText(col) {
+			continue
+		}
+		c := schemaChange{Change: changeChanged, Kind: "column", Name: name, Old: columnText(prev), New: columnText(col)}
+		if prev.Type.String() != col.Type.String() {
+			c.Breaking, c.Reason = true, "its type changed"
+		} else if reason, ok := tightenedConstraint(prev, col); ok {
+			c.Breaking, c.Reason = true, reason
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// tightenedConstraint reports the first constraint of col that existing
+// values of prev may violate: a new notnull, unique or primary key, or a
+// bound that is new or narrower. Defaults and wider bounds are compatible.
+func tightenedConstraint(prev, col *types.Column) (string, bool) {
+	for _, attr := range col.Attributes {
+		old, existed := findAttribute(prev, attr.Type)
+		switch attr.Type {
+		case types.NOT_NULL, types.UNIQUE, types.PRIMARY_KEY:
+			if !existed {
+				return "constraint " + attributeText(attr) + " added", true
+			}
+		case types.MIN, types.MIN_LENGTH, types.MAX, types.MAX_LENGTH:
+			if !existed {
+				return "constraint " + attributeText(attr) + " added", true
+			}
+			lower := attr.Type == types.MIN || attr.Type == types.MIN_LENGTH
+			if narrower(old.Value, attr.Value, lower) {
+				return fmt.Sprintf("constraint %s narrowed to %s", attributeText(old), attributeText(attr)), true
+			}
+		}
+	}
+	return "", false
+}
+
+func findAttribute(col *types.Column, typ types.AttributeType) (*types.Attribute, bool) {
+	i := slices.IndexFunc(col.Attributes, func(a *types.Attribute) bool { return a.Type == typ })
+	if i < 0 {
+		return nil, false
+	}
+	return col.Attributes[i], true
+}
+
+// narrower reports whether a lower bound was raised, or an upper bound
+// lowered. Bounds that are not numbers are narrower if they differ.
+func narrower(from, to string, lower bool) bool {
+	o, ok1 := new(big.Rat).SetString(from)
+	n, ok2 := new(big.Rat).SetString(to)
+	if !ok1 || !ok2 {
+		return from != to
+	}
+	if lower {
+		return n.Cmp(o) > 0
+	}
+	return n.Cmp(o) < 0
+}
+
+func indexText(idx *types.Index) string {
+	kind := "index"
+	switch idx.Type {
+	case types.UNIQUE_BTREE:
+		kind = "unique"
+	case types.PRIMARY:
+		kind = "primary"
+	}
+	return fmt.Sprintf("%s(%s)", kind, strings.Join(idx.Columns, ", "))
+}
+
+func diffIndexes(old, new *types.Table) []schemaChange {
+	var changes []schemaChange
+	find := func(t *types.Table, name string) (*types.Index, bool) {
+		for _, idx := range t.Indexes {
+			if strings.EqualFold(idx.Name, name) {
+				return idx, true
+			}
+		}
+		return nil, false
+	}
+	for _, idx := range old.Indexes {
+		if _, ok := find(new, idx.Name); !ok {
+			changes = append(changes, schemaChange{Change: changeRemoved, Kind: "index", Name: new.Name + "." + idx.Name, Old: indexText(idx)})
+		}
+	}
+	for _, idx := range new.Indexes {
+		prev, ok := find(old, idx.Name)
+		if ok && indexText(prev) == indexText(idx) {
+			continue
+		}
+		c := schemaChange{Change: changeAdded, Kind: "index", Name: new.Name + "." + idx.Name, New: indexText(idx)}
+		if ok {
+			c.Change, c.Old = changeChanged, indexText(prev)
+		}
+		switch idx.Type {
+		case types.UNIQUE_BTREE:
+			c.Breaking, c.Reason = true, "existing rows may not be unique"
+		case types.PRIMARY:
+			c.Breaking, c.Reason = true, "existing rows may not be unique or have no value"
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func foreignKeyText(fk *types.ForeignKey) string {
+	s := fmt.Sprintf("(%s) references %s(%s)", strings.Join(fk.ChildKeys, ", "), fk.ParentTable, strings.Join(fk.ParentKeys, ", "))
+	for _, action := range fk.Actions {
+		s += strings.ToLower(fmt.Sprintf(" on %s %s", action.On, action.Do))
+	}
+	return s
+}
+
+// diffForeignKeys compares foreign keys by their child columns, since they
+// have no names.
+func diffForeignKeys(old, new *types.Table) []schemaChange {
+	var changes []schemaChange
+	key := func(fk *types.ForeignKey) string {
+		return new.Name + "." + strings.ToLower(strings.Join(fk.ChildKeys, "_"))
+	}
+	prev := make(map[string]*types.ForeignKey)
+	for _, fk := range old.ForeignKeys {
+		prev[key(fk)] = fk
+	}
+	current := make(map[string]bool)
+	for _, fk := range new.ForeignKeys {
+		current[key(fk)] = true
+	}
+
+	for _, fk := range old.ForeignKeys {
+		if !current[key(fk)] {
+			changes = append(changes, schemaChange{Change: changeRemoved, Kind: "foreign key", Name: key(fk), Old: foreignKeyText(fk)})
+		}
+	}
+	for _, fk := range new.ForeignKeys {
+		p, ok := prev[key(fk)]
+		switch {
+		case !ok:
+			changes = append(changes, schemaChange{Change: changeAdded, Kind: "foreign key", Name: key(fk), New: foreignKeyText(fk),
+				Breaking: true, Reason: "existing rows may not reference a parent"})
+		case foreignKeyText(p) != foreignKeyText(fk):
+			changes = append(changes, schemaChange{Change: changeChanged, Kind: "foreign key", Name: key(fk), Old: foreignKeyText(p), New: foreignKeyText(fk),
+				Breaking: true, Reason: "existing rows may not reference a parent"})
+		}
+	}
+	return changes
+}
+
+func extensionText(ext *types.Extension) string {
+	var config []string
+	for _, c := range ext.Initialization {
+		config = append(config, c.Key+": "+c.Value)
+	}
+	return fmt.Sprintf("use %s {%s} as %s", ext.Name, strings.Join(config, ", "), ext.Alias)
+}
+
+func diffExtensions(old, new *types.Schema) []schemaChange {
+	var changes []schemaChange
+	for _, ext := range old.Extensions {
+		if _, ok := new.FindExtensionImport(ext.Alias); !ok {
+			changes = append(changes, schemaChange{Change: changeRemoved, Kind: "extension", Name: ext.Alias, Old: extensionText(ext)})
+		}
+	}
+	for _, ext := range new.Extensions {
+		prev, ok := old.FindExtensionImport(ext.Alias)
+		switch {
+		case !ok:
+			changes = append(changes, schemaChange{Change: changeAdded, Kind: "extension", Name: ext.Alias, New: extensionText(ext)})
+		case extensionText(prev) != extensionText(ext):
+			changes = append(changes, schemaChange{Change: changeChanged, Kind: "extension", Name: ext.Alias, Old: extensionText(prev), New: extensionText(ext)})
+		}
+	}
+	return changes
+}
+
+// methodDecl is what the diff compares of actions and procedures.
+type methodDecl struct {
+	name      string
+	signature string
+	public    bool
+	// params are the parameters with their types, and returns the return
+	// types.
+	params    []string
+	returns   string
+	modifiers []types.Modifier
+	body      string
+}
+
+func actionDecls(schema *types.Schema) []methodDecl {
+	var decls []methodDecl
+	for _, a := range schema.Actions {
+		decls = append(decls, methodDecl{
+			name: a.Name, signature: actionSignature(a), public: a.Public,
+			params: a.Parameters, modifiers: a.Modifiers, body: a.Body,
+		})
+	}
+	return decls
+}
+
+func procedureDecls(schema *types.Schema) []methodDecl {
+	var decls []methodDecl
+	for _, p := range schema.Procedures {
+		d := methodDecl{
+			name: p.Name, signature: procedureSignature(p), public: p.Public,
+			returns: returnsText(p.Returns), modifiers: p.Modifiers, body: p.Body,
+		}
+		for _, param := range p.Parameters {
+			d.params = append(d.params, param.Name+" "+param.Type.String())
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// foreignProcedureDecls are never public: only the schema calls them.
+func foreignProcedureDecls(schema *types.Schema) []methodDecl {
+	var decls []methodDecl
+	for _, p := range schema.ForeignProcedures {
+		d := methodDecl{name: p.Name, signature: foreignProcedureSignature(p), returns: returnsText(p.Returns)}
+		for _, param := range p.Parameters {
+			d.params = append(d.params, param.String())
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+func diffMethods(kind string, old, new []methodDecl) []schemaChange {
+	var changes []schemaChange
+	find := func(decls []methodDecl, name string) (methodDecl, bool) {
+		for _, d := range decls {
+			if strings.EqualFold(d.name, name) {
+				return d, true
+			}
+		}
+		return methodDecl{}, false
+	}
+
+	for _, d := range old {
+		if _, ok := find(new, d.name); !ok {
+			c := schemaChange{Change: changeRemoved, Kind: kind, Name: d.name, Old: d.signature}
+			if d.public {
+				c.Breaking, c.Reason = true, "clients can no longer call it"
+			}
+			changes = append(changes, c)
+		}
+	}
+	for _, d := range new {
+		prev, ok := find(old, d.name)
+		if !ok {
+			changes = append(changes, schemaChange{Change: changeAdded, Kind: kind, Name: d.name, New: d.signature})
+			continue
+		}
+		if prev.signature == d.signature {
+			if normalizeBody(prev.body) != normalizeBody(d.body) {
+				changes = append(changes, schemaChange{Change: changeChanged, Kind: kind, Name: d.name, Old: "body", New: "body"})
+			}
+			continue
+		}
+		c := schemaChange{Change: changeChanged, Kind: kind, Name: d.name, Old: prev.signature, New: d.signature}
+		if prev.public {
+			c.Reason = breakingMethodChange(prev, d)
+			c.Breaking = c.Reason != ""
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// breakingMethodChange explains why a change of a public action or
+// procedure breaks its clients, or returns "".
+func breakingMethodChange(old, new methodDecl) string {
+	switch {
+	case !new.public:
+		return "it is no longer public"
+	case !slices.Equal(old.params, new.params):
+		return "its parameters changed"
+	case old.returns != new.returns:
+		return "its return type changed"
+	case slices.Contains(old.modifiers, types.ModifierView) && !slices.Contains(new.modifiers, types.ModifierView):
+		return "it is no longer a view"
+	case slices.Contains(new.modifiers, types.ModifierOwner) && !slices.Contains(old.modifiers, types.ModifierOwner):
+		return "only the owner can call it now"
+	case slices.Contains(new.modifiers, types.ModifierAuthenticated) && !slices.Contains(old.modifiers, types.ModifierAuthenticated):
+		return "it now requires authentication"
+	}
+	return ""
+}
+
+// normalizeBody collapses whitespace, so that formatting is not a change.
+func normalizeBody(body string) string {
+	return strings.Join(strings.Fields(body), " ")
+}
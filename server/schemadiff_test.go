@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+func Test_DiffSchemas(t *testing.T) {
+	old := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull,
+    bio text,
+    #name_idx index(name)
+}
+
+table sessions {
+    id uuid primary key
+}
+
+action get_user($id) public view {
+    SELECT * FROM users WHERE id = $id;
+}
+
+action delete_user($id) public owner {
+    DELETE FROM users WHERE id = $id;
+}
+
+procedure count_users() public view returns (n int) {
+    return 0;
+}
+
+procedure internal() private {
+}
+`
+	new := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull maxlen(32),
+    age int notnull,
+    #name_idx unique(name)
+}
+
+action get_user($id) public view {
+    SELECT id, name
+    FROM users WHERE id = $id;
+}
+
+action rename($id, $name) public {
+    UPDATE users SET name = $name WHERE id = $id;
+}
+
+procedure count_users($active bool) public view returns (n int) {
+    return 0;
+}
+`
+	oldRes, _ := parse.ParseAndValidate([]byte(old))
+	newRes, _ := parse.ParseAndValidate([]byte(new))
+	if err := oldRes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newRes.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range diffSchemas(oldRes, newRes) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"- table sessions: sessions (breaking: its data is dropped)",
+		"- column users.bio: text (breaking: its data is dropped)",
+		"~ column users.name: text notnull -> text notnull maxlen(32) (breaking: constraint maxlen(32) added)",
+		"+ column users.age: int notnull (breaking: existing rows have no value for it)",
+		"~ index users.name_idx: index(name) -> unique(name) (breaking: existing rows may not be unique)",
+		"- action delete_user: action delete_user($id) public owner (breaking: clients can no longer call it)",
+		"~ action get_user: body -> body",
+		"+ action rename: action rename($id, $name) public",
+		"- procedure internal: procedure internal() private",
+		"~ procedure count_users: procedure count_users() public view returns (n int) -> procedure count_users($active bool) public view returns (n int) (breaking: its parameters changed)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected changes\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	if changes := diffSchemas(newRes, newRes); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
+
+func Test_DiffColumnConstraints(t *testing.T) {
+	parseColumn := func(def string) *parse.SchemaParseResult {
+		t.Helper()
+		res, _ := parse.ParseAndValidate([]byte("database glow;\n\ntable t {\n    id int primary key,\n    v " + def + "\n}\n"))
+		if err := res.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	tests := []struct {
+		old, new string
+		reason   string // empty if not breaking
+	}{
+		{"text maxlen(50)", "text maxlen(100)", ""},
+		{"text maxlen(100)", "text maxlen(50)", "constraint maxlen(100) narrowed to maxlen(50)"},
+		{"text maxlen(9)", "text maxlen(10)", ""},
+		{"int min(10)", "int min(0)", ""},
+		{"int min(0)", "int min(10)", "constraint min(0) narrowed to min(10)"},
+		{"int max(10)", "int max(9)", "constraint max(10) narrowed to max(9)"},
+		{"text minlen(2)", "text", ""},
+		{"text", "text minlen(2)", "constraint minlen(2) added"},
+		{"text", "text default('x')", ""},
+		{"text", "text notnull", "constraint notnull added"},
+		{"text notnull", "text", ""},
+		{"text", "text unique", "constraint unique added"},
+	}
+	for _, tt := range tests {
+		changes := diffSchemas(parseColumn(tt.old), parseColumn(tt.new))
+		if len(changes) != 1 {
+			t.Errorf("%s -> %s: expected one change, got %v", tt.old, tt.new, changes)
+			continue
+		}
+		if c := changes[0]; c.Breaking != (tt.reason != "") || c.Reason != tt.reason {
+			t.Errorf("%s -> %s: expected reason %q, got %q", tt.old, tt.new, tt.reason, c.Reason)
+		}
+	}
+}
+
+func Test_DiffPrimaryIndex(t *testing.T) {
+	old := "database glow;\n\ntable t {\n    a int primary key,\n    b int notnull\n}\n"
+	new := "database glow;\n\ntable t {\n    a int notnull,\n    b int notnull,\n    #pk primary(a, b)\n}\n"
+	oldRes, _ := parse.ParseAndValidate([]byte(old))
+	newRes, _ := parse.ParseAndValidate([]byte(new))
+	if err := oldRes.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := newRes.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var index *schemaChange
+	for _, c := range diffSchemas(oldRes, newRes) {
+		if c.Kind == "index" {
+			index = &c
+		}
+	}
+	if index == nil || !index.Breaking || index.Reason != "existing rows may not be unique or have no value" {
+		t.Errorf("expected the added primary index to be breaking, got %+v", index)
+	}
+}
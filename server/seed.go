@@ -0,0 +1,525 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+)
+
+// Seed data: synthetic rows for every table of a schema that satisfy its
+// types, not null, length and range constraints, unique and primary keys
+// and foreign keys, in an order in which they can be inserted. The same
+// seed always gives the same rows.
+
+var seedFormats = []string{"sql", "json"}
+
+type seedOptions struct {
+	rows int
+	seed uint64
+}
+
+// seedTable holds the rows of a table. Values are nil, bool, int64, string
+// (also for uuid, uint256 and decimal), []byte or []any for arrays.
+type seedTable struct {
+	table *types.Table
+	rows  [][]any
+}
+
+// maxSeedAttempts bounds the retries for a row that violates a unique
+// constraint.
+const maxSeedAttempts = 100
+
+func generateSeed(schema *types.Schema, opts seedOptions) ([]seedTable, error) {
+	// cycles are broken at a foreign key with nullable columns, which is
+	// then left null
+	order, broken, err := tableOrder(schema, func(table *types.Table, fk *types.ForeignKey) bool {
+		return nullableColumns(table, fk.ChildKeys)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &seedGenerator{
+		rng:     rand.New(rand.NewPCG(opts.seed, opts.seed)),
+		rows:    opts.rows,
+		broken:  broken,
+		byTable: make(map[string]*seedTable),
+	}
+	var tables []seedTable
+	for _, table := range order {
+		st, err := g.table(table)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		g.byTable[strings.ToLower(table.Name)] = st
+		tables = append(tables, *st)
+	}
+	return tables, nil
+}
+
+func nullableColumns(table *types.Table, cols []string) bool {
+	for _, name := range cols {
+		col, ok := table.FindColumn(name)
+		if !ok || !nullable(col) {
+			return false
+		}
+	}
+	return true
+}
+
+func nullable(col *types.Column) bool {
+	return !col.HasAttribute(types.NOT_NULL) && !col.HasAttribute(types.PRIMARY_KEY)
+}
+
+type seedGenerator struct {
+	rng     *rand.Rand
+	rows    int
+	broken  map[*types.ForeignKey]bool
+	byTable map[string]*seedTable
+}
+
+func (g *seedGenerator) table(table *types.Table) (*seedTable, error) {
+	st := &seedTable{table: table}
+	columns := make(map[string]int)
+	for i, col := range table.Columns {
+		columns[strings.ToLower(col.Name)] = i
+	}
+
+	// the column sets whose values must be unique
+	var uniques [][]int
+	for i, col := range table.Columns {
+		if col.HasAttribute(types.UNIQUE) || col.HasAttribute(types.PRIMARY_KEY) {
+			uniques = append(uniques, []int{i})
+		}
+	}
+	for _, idx := range table.Indexes {
+		if idx.Type == types.BTREE {
+			continue
+		}
+		var set []int
+		for _, name := range idx.Columns {
+			set = append(set, columns[strings.ToLower(name)])
+		}
+		uniques = append(uniques, set)
+	}
+	seen := make([]map[string]bool, len(uniques))
+	for i := range seen {
+		seen[i] = make(map[string]bool)
+	}
+
+	// columns filled from the parent rows
+	fkColumns := make(map[int]bool)
+	for _, fk := range table.ForeignKeys {
+		for _, name := range fk.ChildKeys {
+			fkColumns[columns[strings.ToLower(name)]] = true
+		}
+	}
+
+	for i := 0; i < g.rows; i++ {
+		ok := false
+		for attempt := 0; attempt < maxSeedAttempts && !ok; attempt++ {
+			row := make([]any, len(table.Columns))
+			for c, col := range table.Columns {
+				if fkColumns[c] {
+					continue
+				}
+				v, err := g.value(col, i, attempt)
+				if err != nil {
+					return nil, fmt.Errorf("column %s: %w", col.Name, err)
+				}
+				row[c] = v
+			}
+			for _, fk := range table.ForeignKeys {
+				g.reference(st, table, fk, columns, row, i, attempt)
+			}
+
+			keys := make([]string, len(uniques))
+			ok = true
+			for u, set := range uniques {
+				keys[u] = uniqueKey(row, set)
+				if keys[u] != "" && seen[u][keys[u]] {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				for u, key := range keys {
+					seen[u][key] = true
+				}
+				st.rows = append(st.rows, row)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("could not generate %d rows with unique keys", g.rows)
+		}
+	}
+	return st, nil
+}
+
+// uniqueKey identifies the values of a unique column set, or is empty if a
+// value is null, as null never conflicts.
+func uniqueKey(row []any, set []int) string {
+	var parts []string
+	for _, c := range set {
+		if row[c] == nil {
+			return ""
+		}
+		parts = append(parts, fmt.Sprintf("%v", row[c]))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// reference fills the columns of a foreign key from a row of the parent,
+// or leaves them null.
+func (g *seedGenerator) reference(st *seedTable, table *types.Table, fk *types.ForeignKey, columns map[string]int, row []any, i, attempt int) {
+	if g.broken[fk] || (nullableColumns(table, fk.ChildKeys) && g.rng.IntN(10) == 0) {
+		return
+	}
+
+	var parent *seedTable
+	var parentRows [][]any
+	if strings.EqualFold(fk.ParentTable, table.Name) {
+		// a row can reference the rows before it and itself
+		parent = st
+		parentRows = append(slices.Clip(st.rows), row)
+	} else {
+		parent = g.byTable[strings.ToLower(fk.ParentTable)]
+		parentRows = parent.rows
+	}
+	if len(parentRows) == 0 {
+		return
+	}
+
+	// the first attempt walks through the parents, so that unique foreign
+	// keys get a parent each
+	pick := (i + attempt) % len(parentRows)
+	if attempt > 0 || !uniqueColumns(table, fk.ChildKeys) {
+		pick = g.rng.IntN(len(parentRows))
+	}
+	for k, name := range fk.ChildKeys {
+		parentCol := parentColumnIndex(parent.table, fk.ParentKeys[k])
+		row[columns[strings.ToLower(name)]] = parentRows[pick][parentCol]
+	}
+}
+
+func uniqueColumns(table *types.Table, cols []string) bool {
+	if len(cols) == 1 {
+		if col, ok := table.FindColumn(cols[0]); ok && (col.HasAttribute(types.UNIQUE) || col.HasAttribute(types.PRIMARY_KEY)) {
+			return true
+		}
+	}
+	for _, idx := range table.Indexes {
+		if idx.Type != types.BTREE && len(idx.Columns) == len(cols) && slices.EqualFunc(idx.Columns, cols, strings.EqualFold) {
+			return true
+		}
+	}
+	return false
+}
+
+func parentColumnIndex(table *types.Table, name string) int {
+	return slices.IndexFunc(table.Columns, func(c *types.Column) bool { return strings.EqualFold(c.Name, name) })
+}
+
+func (g *seedGenerator) value(col *types.Column, i, attempt int) (any, error) {
+	if nullable(col) && !col.HasAttribute(types.UNIQUE) && g.rng.IntN(10) == 0 {
+		return nil, nil
+	}
+	if !col.Type.IsArray {
+		return g.scalar(col, i, attempt)
+	}
+	n := g.rng.IntN(4)
+	elems := make([]any, n)
+	for k := range elems {
+		v, err := g.scalar(col, g.rng.IntN(g.rows*10+1), 1)
+		if err != nil {
+			return nil, err
+		}
+		elems[k] = v
+	}
+	return elems, nil
+}
+
+// scalar generates a value of the element type of col. The first attempt
+// for row i of a unique column is derived from i, so that it is likely
+// unique; later attempts are random.
+func (g *seedGenerator) scalar(col *types.Column, i, attempt int) (any, error) {
+	unique := col.HasAttribute(types.UNIQUE) || col.HasAttribute(types.PRIMARY_KEY)
+	switch col.Type.Name {
+	case "int":
+		lo, hi := intRange(col, 1, 1000)
+		if lo > hi {
+			return nil, fmt.Errorf("min %d is larger than max %d", lo, hi)
+		}
+		if unique && attempt == 0 && lo+int64(i) <= hi {
+			return lo + int64(i), nil
+		}
+		return lo + g.rng.Int64N(hi-lo+1), nil
+	case "bool":
+		return g.rng.IntN(2) == 0, nil
+	case "uuid":
+		var u [16]byte
+		for k := range u {
+			u[k] = byte(g.rng.IntN(256))
+		}
+		u[6] = u[6]&0x0f | 0x40 // version 4
+		u[8] = u[8]&0x3f | 0x80
+		h := hex.EncodeToString(u[:])
+		return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+	case "blob":
+		lo, hi := lengthRange(col, 4, 16)
+		b := make([]byte, lo+g.rng.IntN(hi-lo+1))
+		for k := range b {
+			b[k] = byte(g.rng.IntN(256))
+		}
+		return b, nil
+	case "uint256":
+		lo, hi := intRange(col, 0, 1_000_000_000)
+		if lo < 0 {
+			lo = 0
+		}
+		if unique && attempt == 0 && lo+int64(i) <= hi {
+			return strconv.FormatInt(lo+int64(i), 10), nil
+		}
+		return new(big.Int).SetInt64(lo + g.rng.Int64N(hi-lo+1)).String(), nil
+	case "decimal":
+		return g.decimal(col), nil
+	case "text":
+		return g.text(col, i, attempt), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", col.Type)
+	}
+}
+
+// intRange returns the min and max attributes of col, or the defaults.
+func intRange(col *types.Column, lo, hi int64) (int64, int64) {
+	if v, ok := attributeInt(col, types.MIN); ok {
+		lo = v
+		if hi < lo {
+			hi = lo + 1000
+		}
+	}
+	if v, ok := attributeInt(col, types.MAX); ok {
+		hi = v
+		if lo > hi {
+			lo = hi - 1000
+			if v, ok := attributeInt(col, types.MIN); ok {
+				lo = v
+			}
+		}
+	}
+	return lo, hi
+}
+
+func lengthRange(col *types.Column, lo, hi int) (int, int) {
+	if v, ok := attributeInt(col, types.MIN_LENGTH); ok {
+		lo = int(v)
+		hi = max(hi, lo)
+	}
+	if v, ok := attributeInt(col, types.MAX_LENGTH); ok {
+		hi = int(v)
+		lo = min(lo, hi)
+	}
+	return lo, hi
+}
+
+func attributeInt(col *types.Column, typ types.AttributeType) (int64, bool) {
+	for _, attr := range col.Attributes {
+		if attr.Type == typ {
+			v, err := strconv.ParseInt(attr.Value, 10, 64)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+func attributeFloat(col *types.Column, typ types.AttributeType) (float64, bool) {
+	for _, attr := range col.Attributes {
+		if attr.Type == typ {
+			v, err := strconv.ParseFloat(attr.Value, 64)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+// decimal generates a number that fits the precision and scale of col.
+func (g *seedGenerator) decimal(col *types.Column) string {
+	precision, scale := int(col.Type.Metadata[0]), int(col.Type.Metadata[1])
+	lo, hi := 0.0, math.Min(1000, math.Pow10(precision-scale)-1)
+	if v, ok := attributeFloat(col, types.MIN); ok {
+		lo = v
+		hi = math.Max(hi, lo)
+	}
+	if v, ok := attributeFloat(col, types.MAX); ok {
+		hi = v
+		lo = math.Min(lo, hi)
+	}
+	v := lo + g.rng.Float64()*(hi-lo)
+	// round down, so that the value stays within the range
+	unit := math.Pow10(scale)
+	v = math.Floor(v*unit) / unit
+	return strconv.FormatFloat(math.Max(v, lo), 'f', scale, 64)
+}
+
+var (
+	seedFirstNames = []string{"Ada", "Alan", "Barbara", "Claude", "Donald", "Edsger", "Frances", "Grace", "John", "Ken", "Leslie", "Margaret", "Niklaus", "Radia", "Tim", "Vint"}
+	seedLastNames  = []string{"Allen", "Cerf", "Dijkstra", "Hamilton", "Hopper", "Knuth", "Lamport", "Liskov", "Lovelace", "McCarthy", "Perlman", "Ritchie", "Shannon", "Thompson", "Turing", "Wirth"}
+	seedWords      = []string{"alpha", "bright", "cedar", "delta", "ember", "fable", "granite", "harbor", "island", "juniper", "kernel", "lumen", "meadow", "nectar", "orbit", "prism", "quartz", "river", "summit", "timber"}
+)
+
+// text generates a value that looks like what the column name suggests,
+// within its length limits.
+func (g *seedGenerator) text(col *types.Column, i, attempt int) string {
+	n := i + 1
+	if attempt > 0 {
+		n = g.rows + g.rng.IntN(1_000_000)
+	}
+	first, last := seedFirstNames[g.rng.IntN(len(seedFirstNames))], seedLastNames[g.rng.IntN(len(seedLastNames))]
+	name := strings.ToLower(col.Name)
+
+	var s string
+	switch {
+	case strings.Contains(name, "email"):
+		s = fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), n)
+	case strings.Contains(name, "url") || strings.Contains(name, "website") || strings.Contains(name, "link"):
+		s = fmt.Sprintf("https://example.com/%s/%d", name, n)
+	case name == "name" || strings.HasSuffix(name, "_name") || strings.Contains(name, "author"):
+		s = first + " " + last
+	case strings.Contains(name, "description") || strings.Contains(name, "content") || strings.Contains(name, "body") ||
+		strings.Contains(name, "bio") || strings.Contains(name, "text") || strings.Contains(name, "title"):
+		words := make([]string, 3+g.rng.IntN(6))
+		for k := range words {
+			words[k] = seedWords[g.rng.IntN(len(seedWords))]
+		}
+		s = strings.Join(words, " ")
+	default:
+		s = fmt.Sprintf("%s %s", seedWords[g.rng.IntN(len(seedWords))], strconv.Itoa(n))
+	}
+	unique := col.HasAttribute(types.UNIQUE) || col.HasAttribute(types.PRIMARY_KEY)
+	if unique && !strings.Contains(s, strconv.Itoa(n)) {
+		s = fmt.Sprintf("%s %d", s, n)
+	}
+
+	lo, hi := lengthRange(col, 0, math.MaxInt32)
+	for len(s) < lo {
+		s += " " + seedWords[g.rng.IntN(len(seedWords))]
+	}
+	if len(s) > hi {
+		if !unique {
+			s = s[:hi]
+			if strings.HasSuffix(s, " ") {
+				s = s[:hi-1] + "s" // no trailing space
+			}
+			return s
+		}
+		// keep the number, which makes the value unique
+		suffix := strconv.FormatInt(int64(n), 36)
+		if len(suffix) >= hi {
+			return suffix[len(suffix)-hi:]
+		}
+		s = s[:hi-len(suffix)] + suffix
+	}
+	return s
+}
+
+// renderSeed writes the rows as INSERT statements or JSON.
+func renderSeed(database string, tables []seedTable, format, pgSchema string, opts seedOptions) (string, error) {
+	switch strings.ToLower(format) {
+	case "sql", "":
+		return seedSQL(database, tables, pgSchema, opts), nil
+	case "json":
+		return seedJSON(tables)
+	default:
+		return "", fmt.Errorf("unknown seed format %q, expected %s", format, strings.Join(seedFormats, ", "))
+	}
+}
+
+func seedSQL(database string, tables []seedTable, pgSchema string, opts seedOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Seed data for the %s database, generated by %s with seed %d.\n", database, binaryName, opts.seed)
+	for _, st := range tables {
+		var cols []string
+		for _, col := range st.table.Columns {
+			cols = append(cols, col.Name)
+		}
+		fmt.Fprintf(&b, "\nINSERT INTO %s (%s) VALUES\n", qualifiedName(pgSchema, st.table.Name), strings.Join(cols, ", "))
+		for r, row := range st.rows {
+			values := make([]string, len(row))
+			for c, v := range row {
+				values[c] = sqlLiteral(v, st.table.Columns[c].Type)
+			}
+			sep := ","
+			if r == len(st.rows)-1 {
+				sep = ";"
+			}
+			fmt.Fprintf(&b, "    (%s)%s\n", strings.Join(values, ", "), sep)
+		}
+	}
+	return b.String()
+}
+
+func sqlLiteral(v any, typ *types.DataType) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return `'\x` + hex.EncodeToString(v) + `'`
+	case []any:
+		if len(v) == 0 {
+			return "'{}'"
+		}
+		elem := &types.DataType{Name: typ.Name, Metadata: typ.Metadata}
+		elems := make([]string, len(v))
+		for i, e := range v {
+			elems[i] = sqlLiteral(e, elem)
+		}
+		return "ARRAY[" + strings.Join(elems, ", ") + "]"
+	case string:
+		if typ.Name == "uint256" || typ.Name == "decimal" {
+			return v
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// seedJSON writes the tables in insert order, each row as an object.
+func seedJSON(tables []seedTable) (string, error) {
+	type fixture struct {
+		Table string           `json:"table"`
+		Rows  []map[string]any `json:"rows"`
+	}
+	fixtures := make([]fixture, 0, len(tables))
+	for _, st := range tables {
+		f := fixture{Table: st.table.Name, Rows: make([]map[string]any, 0, len(st.rows))}
+		for _, row := range st.rows {
+			obj := make(map[string]any, len(row))
+			for c, v := range row {
+				obj[st.table.Columns[c].Name] = v
+			}
+			f.Rows = append(f.Rows, obj)
+		}
+		fixtures = append(fixtures, f)
+	}
+	b, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
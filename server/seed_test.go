@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+const seedTestSchema = `database shop;
+
+table orders {
+    user_id uuid notnull,
+    num int notnull min(1) max(3),
+    price decimal(6,2) min(1),
+    tags text[],
+    #pk primary(user_id, num),
+    foreign_key (user_id) references users(id)
+}
+
+table users {
+    id uuid primary key,
+    email text notnull unique maxlen(20),
+    code text unique minlen(2) maxlen(2),
+    age int min(18) max(99),
+    bio text maxlen(10),
+    manager uuid,
+    foreign_key (manager) references users(id)
+}
+
+table profiles {
+    user_id uuid primary key,
+    foreign_key (user_id) references users(id) on_delete cascade
+}
+`
+
+func Test_Seed(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(seedTestSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := seedOptions{rows: 20, seed: 7}
+	tables, err := generateSeed(res.Schema, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, st := range tables {
+		order = append(order, st.table.Name)
+		if len(st.rows) != opts.rows {
+			t.Errorf("expected %d rows in %s, got %d", opts.rows, st.table.Name, len(st.rows))
+		}
+	}
+	if strings.Join(order, " ") != "users profiles orders" {
+		t.Errorf("expected parents first, got %v", order)
+	}
+
+	users := tables[0]
+	ids := make(map[any]bool)
+	emails := make(map[any]bool)
+	for _, row := range users.rows {
+		id, email, code, age, bio := row[0], row[1].(string), row[2], row[3], row[4]
+		if ids[id] || emails[email] {
+			t.Errorf("duplicate key in %v", row)
+		}
+		ids[id], emails[email] = true, true
+		if len(email) > 20 {
+			t.Errorf("email %q is longer than 20", email)
+		}
+		if code != nil && len(code.(string)) != 2 {
+			t.Errorf("code %q doesn't have length 2", code)
+		}
+		if age != nil && (age.(int64) < 18 || age.(int64) > 99) {
+			t.Errorf("age %d out of range", age)
+		}
+		if bio != nil && len(bio.(string)) > 10 {
+			t.Errorf("bio %q is longer than 10", bio)
+		}
+	}
+	for _, row := range users.rows {
+		if row[5] != nil && !ids[row[5]] {
+			t.Errorf("manager %v is not a user", row[5])
+		}
+	}
+
+	keys := make(map[string]bool)
+	for _, row := range tables[2].rows {
+		key := uniqueKey(row, []int{0, 1})
+		if !ids[row[0]] || keys[key] {
+			t.Errorf("unexpected order %v", row)
+		}
+		keys[key] = true
+	}
+	profiles := make(map[any]bool)
+	for _, row := range tables[1].rows {
+		if !ids[row[0]] || profiles[row[0]] {
+			t.Errorf("unexpected profile %v", row)
+		}
+		profiles[row[0]] = true
+	}
+
+	// the same seed gives the same rows
+	sql, _ := renderSeed("shop", tables, "sql", "", opts)
+	again, _ := generateSeed(res.Schema, opts)
+	if sql2, _ := renderSeed("shop", again, "sql", "", opts); sql2 != sql {
+		t.Error("expected the same output for the same seed")
+	}
+	if !strings.HasPrefix(sql, "-- Seed data for the shop database") || !strings.Contains(sql, "\nINSERT INTO orders (user_id, num, price, tags) VALUES\n") {
+		t.Errorf("unexpected SQL\n%s", sql)
+	}
+	if _, err := renderSeed("shop", tables, "json", "", opts); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_SeedImpossible(t *testing.T) {
+	schema := strings.Replace(seedTestSchema, "code text unique minlen(2) maxlen(2)", "code text unique minlen(1) maxlen(1)", 1)
+	res, _ := parse.ParseAndValidate([]byte(schema))
+	if _, err := generateSeed(res.Schema, seedOptions{rows: 100, seed: 1}); err == nil || !strings.Contains(err.Error(), "unique keys") {
+		t.Errorf("expected an error for too few unique codes, got %v", err)
+	}
+}
+
+func Test_SeedLiterals(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(seedTestSchema))
+	orders, _ := res.Schema.FindTable("orders")
+	tests := []struct {
+		value any
+		col   int
+		want  string
+	}{
+		{nil, 1, "NULL"},
+		{int64(3), 1, "3"},
+		{"12.50", 2, "12.50"},
+		{[]any{"it's"}, 3, "ARRAY['it''s']"},
+		{[]any{}, 3, "'{}'"},
+		{[]byte{0xde, 0xad}, 3, `'\xdead'`},
+	}
+	for _, tt := range tests {
+		if got := sqlLiteral(tt.value, orders.Columns[tt.col].Type); got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
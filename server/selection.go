@@ -0,0 +1,335 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Selection ranges grow from the token under the cursor through the AST
+// nodes containing it (expressions, SQL clauses, statements) to the body and
+// the declaration of the action or procedure, and finally the whole
+// document. Columns of a table grow to their definition, then the table
+// body.
+
+func getSelectionRanges(text string, positions []lsp.Position) []selectionRange {
+	toks := lexKf(text)
+	res, _ := parse.ParseAndValidate([]byte(text))
+	lines := lineOffsets(text)
+
+	ranges := make([]selectionRange, 0, len(positions))
+	for _, pos := range positions {
+		chain := selectionChain(text, toks, res, lines, pos)
+
+		var sel *selectionRange
+		for _, rng := range chain {
+			sel = &selectionRange{Range: rng, Parent: sel}
+		}
+		if sel == nil {
+			sel = &selectionRange{Range: lsp.Range{Start: pos, End: pos}}
+		}
+		ranges = append(ranges, *sel)
+	}
+	return ranges
+}
+
+// selectionChain returns the ranges containing pos, outermost first, each
+// strictly inside the one before.
+func selectionChain(text string, toks []token, r *parse.SchemaParseResult, lines []int, pos lsp.Position) []lsp.Range {
+	offset := positionOffset(lines, pos)
+	candidates := []lsp.Range{{End: endPosition(text)}}
+
+	if r != nil && r.SchemaInfo != nil {
+		for name, block := range r.SchemaInfo.Blocks {
+			if offset < block.AbsStart || offset > block.AbsEnd+1 {
+				continue
+			}
+			candidates = append(candidates, blockRange(block))
+
+			open, body, ok := blockBody(toks, block)
+			if !ok {
+				continue
+			}
+			candidates = append(candidates, body)
+
+			var stmts []parse.Node
+			for _, stmt := range r.ParsedActions[name] {
+				stmts = append(stmts, stmt)
+			}
+			for _, stmt := range r.ParsedProcedures[name] {
+				stmts = append(stmts, stmt)
+			}
+			for _, stmt := range stmts {
+				walkNode(stmt, func(n parse.Node) bool {
+					p := n.GetPosition()
+					if !hasPosition(p) {
+						return true
+					}
+					rng := nodeRange(toks, p)
+					if !rangeContains(lines, rng, offset) {
+						return false
+					}
+					candidates = append(candidates, rng)
+					if clause, ok := clauseRange(toks, lines, rng, offset); ok {
+						candidates = append(candidates, clause)
+					}
+					return true
+				})
+			}
+
+			if isTableBlock(toks, block) {
+				if rng, ok := listItemRange(toks, open, offset); ok {
+					candidates = append(candidates, rng)
+				}
+			}
+		}
+	}
+
+	if tok, ok := tokenAtOffset(toks, offset); ok {
+		candidates = append(candidates, tokenRange(tok))
+	}
+
+	// sort outermost first; ranges containing the same offset are nested or
+	// equal, so a larger size means further out
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return rangeSize(lines, candidates[i]) > rangeSize(lines, candidates[j])
+	})
+
+	var chain []lsp.Range
+	for _, rng := range candidates {
+		if !rangeContains(lines, rng, offset) {
+			continue
+		}
+		if len(chain) > 0 && rangeSize(lines, rng) >= rangeSize(lines, chain[len(chain)-1]) {
+			continue
+		}
+		chain = append(chain, rng)
+	}
+	return chain
+}
+
+// sqlClauses are the keywords starting a clause of a SQL statement. A join
+// starts at its first keyword, e.g. LEFT in LEFT OUTER JOIN.
+var sqlClauses = []string{
+	"select", "from", "where", "set", "values", "group", "order", "having", "limit", "offset",
+	"returning", "union", "intersect", "except",
+}
+
+var sqlJoinKeywords = []string{"join", "inner", "left", "right", "full", "cross", "outer", "natural"}
+
+// clauseRange returns the range of the clause containing offset in a SQL
+// statement spanning rng, e.g. its WHERE or SET clause. Clauses of
+// subqueries are those of the subquery's own node.
+func clauseRange(toks []token, lines []int, rng lsp.Range, offset int) (lsp.Range, bool) {
+	start, end := positionOffset(lines, rng.Start), positionOffset(lines, rng.End)
+	first, last := -1, -1
+	for i, tok := range toks {
+		if tok.offset < start || tok.offset >= end || tok.kind == tokComment {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 || !isSQLStatementStart(toks[first]) {
+		return lsp.Range{}, false
+	}
+
+	depth, clause := 0, first
+	for i := first; i <= last+1; i++ {
+		boundary := i > last
+		if !boundary {
+			tok := toks[i]
+			switch {
+			case tok.kind == tokPunct && tok.text == "(":
+				depth++
+			case tok.kind == tokPunct && tok.text == ")":
+				depth--
+			case tok.kind == tokPunct && tok.text == ";":
+				boundary = depth == 0
+			case tok.kind == tokIdent && depth == 0 && i > first:
+				boundary = startsClause(toks, i)
+			}
+		}
+		if !boundary {
+			continue
+		}
+
+		// the clause runs from clause to the token before i
+		stop := i - 1
+		for stop > clause && toks[stop].kind == tokComment {
+			stop--
+		}
+		if stop >= clause && offset >= toks[clause].offset && offset <= toks[stop].end() {
+			return lsp.Range{Start: tokenRange(toks[clause]).Start, End: tokenEnd(toks[stop])}, true
+		}
+		clause = i
+	}
+	return lsp.Range{}, false
+}
+
+func isSQLStatementStart(tok token) bool {
+	return tok.kind == tokIdent && tokenIsOneOf(tok, []string{"select", "insert", "update", "delete", "with"})
+}
+
+// startsClause reports whether the identifier at i starts a clause.
+func startsClause(toks []token, i int) bool {
+	if tokenIsOneOf(toks[i], sqlJoinKeywords) {
+		return !tokenIsOneOf(toks[i-1], sqlJoinKeywords)
+	}
+	return tokenIsOneOf(toks[i], sqlClauses)
+}
+
+func tokenIsOneOf(tok token, keywords []string) bool {
+	for _, kw := range keywords {
+		if tok.is(kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockBody returns the index of the opening brace of a block and the range
+// of the text between its braces, without surrounding whitespace.
+func blockBody(toks []token, block *parse.Block) (int, lsp.Range, bool) {
+	open := -1
+	for i, tok := range toks {
+		if tok.offset < block.AbsStart {
+			continue
+		}
+		if tok.offset > block.AbsEnd {
+			break
+		}
+		if tok.kind == tokPunct && tok.text == "{" {
+			open = i
+			break
+		}
+	}
+	if open < 0 || open+1 >= len(toks) {
+		return 0, lsp.Range{}, false
+	}
+
+	last := open
+	for i := open + 1; i < len(toks) && toks[i].offset < block.AbsEnd; i++ {
+		last = i
+	}
+	if last == open {
+		return 0, lsp.Range{}, false
+	}
+
+	return open, lsp.Range{
+		Start: tokenRange(toks[open+1]).Start,
+		End:   tokenEnd(toks[last]),
+	}, true
+}
+
+func isTableBlock(toks []token, block *parse.Block) bool {
+	tok, ok := tokenAtOffset(toks, block.AbsStart)
+	return ok && tok.is("table")
+}
+
+// listItemRange returns the range of the comma separated item containing
+// offset, in the list opened by the brace at index open.
+func listItemRange(toks []token, open int, offset int) (lsp.Range, bool) {
+	start, depth := open+1, 0
+	for i := open + 1; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.kind != tokPunct {
+			continue
+		}
+		switch tok.text {
+		case "(", "{":
+			depth++
+			continue
+		case ")":
+			depth--
+			continue
+		case "}":
+			if depth > 0 {
+				depth--
+				continue
+			}
+		case ",":
+			if depth > 0 {
+				continue
+			}
+		default:
+			continue
+		}
+
+		// tok ends the item from start to i-1
+		if i > start && offset >= toks[start].offset && offset <= toks[i-1].end() {
+			return lsp.Range{Start: tokenRange(toks[start]).Start, End: tokenEnd(toks[i-1])}, true
+		}
+		if tok.text == "}" {
+			break
+		}
+		start = i + 1
+	}
+	return lsp.Range{}, false
+}
+
+// tokenAtOffset returns the token containing the offset, preferring names
+// over punctuation when the offset is between two tokens.
+func tokenAtOffset(toks []token, offset int) (token, bool) {
+	i := tokenIndexAt(toks, offset)
+	if i < 0 {
+		return token{}, false
+	}
+	return toks[i], true
+}
+
+// tokenIndexAt is tokenAtOffset returning the index of the token, or -1.
+func tokenIndexAt(toks []token, offset int) int {
+	found := -1
+	for i, tok := range toks {
+		if tok.offset > offset {
+			break
+		}
+		if offset <= tok.end() && (found < 0 || tok.kind != tokPunct) {
+			found = i
+		}
+	}
+	return found
+}
+
+// tokenEnd returns the position after the last character of a token, which
+// may be on a later line for multi-line strings and comments.
+func tokenEnd(tok token) lsp.Position {
+	if i := strings.LastIndexByte(tok.text, '\n'); i >= 0 {
+		return lsp.Position{Line: tokenEndLine(tok), Character: len(tok.text) - i - 1}
+	}
+	return tokenRange(tok).End
+}
+
+// lineOffsets returns the offset of the start of every line.
+func lineOffsets(text string) []int {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func positionOffset(lines []int, pos lsp.Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(lines) {
+		return lines[len(lines)-1]
+	}
+	return lines[pos.Line] + pos.Character
+}
+
+func rangeContains(lines []int, rng lsp.Range, offset int) bool {
+	return positionOffset(lines, rng.Start) <= offset && offset <= positionOffset(lines, rng.End)
+}
+
+func rangeSize(lines []int, rng lsp.Range) int {
+	return positionOffset(lines, rng.End) - positionOffset(lines, rng.Start)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+func Test_SelectionRanges(t *testing.T) {
+	src := `database glow;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+action rename($id, $name) public {
+    UPDATE users SET name = $name WHERE id = $id;
+}
+`
+	lines := []string{
+		"database glow;", "", "table users {", "    id uuid primary key,", "    name text notnull", "}", "",
+		"action rename($id, $name) public {", "    UPDATE users SET name = $name WHERE id = $id;", "}", "",
+	}
+	text := func(rng lsp.Range) string {
+		if rng.Start.Line == rng.End.Line {
+			return lines[rng.Start.Line][rng.Start.Character:rng.End.Character]
+		}
+		return "..."
+	}
+
+	tests := []struct {
+		pos  lsp.Position
+		want []string
+	}{
+		{
+			// $id in the WHERE clause
+			pos:  lsp.Position{Line: 8, Character: 47},
+			want: []string{"$id", "id = $id", "WHERE id = $id", "UPDATE users SET name = $name WHERE id = $id"},
+		},
+		{
+			// $name in the SET clause
+			pos:  lsp.Position{Line: 8, Character: 31},
+			want: []string{"$name", "name = $name", "SET name = $name", "UPDATE users SET name = $name WHERE id = $id"},
+		},
+		{
+			// the type of the name column
+			pos:  lsp.Position{Line: 4, Character: 10},
+			want: []string{"text", "name text notnull"},
+		},
+	}
+
+	for _, tt := range tests {
+		sel := getSelectionRanges(src, []lsp.Position{tt.pos})[0]
+
+		var got []string
+		var outer []lsp.Range
+		for s := &sel; s != nil; s = s.Parent {
+			got = append(got, text(s.Range))
+			outer = append(outer, s.Range)
+		}
+
+		for i, want := range tt.want {
+			if i >= len(got) || got[i] != want {
+				t.Errorf("at %v: expected %q as range %d, got %q", tt.pos, want, i, got)
+				break
+			}
+		}
+
+		// the chain ends with the body, the declaration and the document
+		if n := len(outer); n < 3 || outer[n-1].Start != (lsp.Position{}) || outer[n-2].Start.Character != 0 {
+			t.Errorf("at %v: unexpected outer ranges %v", tt.pos, outer)
+		}
+	}
+}
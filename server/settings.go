@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Settings are resolved from layers of JSON, each overriding the one before:
+// the defaults, the editor's "kuneiform" settings for the workspace folder of
+// the document and the project file .kwil-ls/config in the document's
+// directory or the nearest parent that has one. The project file has the
+// same shape as the editor settings, so a team can check in what the
+// formatter and linter should do.
+
+const (
+	settingsSection   = "kuneiform"
+	projectConfigFile = "config"
+)
+
+// bundledParserVersion is the kwil-db release whose parser is built in.
+const bundledParserVersion = "v0.8"
+
+type serverSettings struct {
+	Lint lintSettings `json:"lint"`
+	// KeywordCase is lower, upper or preserve, used by the formatter and for
+	// keywords offered by completion.
+	KeywordCase string             `json:"keywordCase"`
+	Format      formatSettings     `json:"format"`
+	Completion  completionSettings `json:"completion"`
+	Parser      parserSettings     `json:"parser"`
+	// Extensions describe the methods of extensions used by schemas.
+	Extensions []extensionCatalog `json:"extensions"`
+	// Logging is process wide and only read from the editor.
+	Logging       logSettings           `json:"logging"`
+	Compatibility compatibilitySettings `json:"compatibility"`
+
+	// baseDir is the directory relative paths in the settings are resolved
+	// against: the directory containing the project's .kwil-ls directory,
+	// or else the document's directory.
+	baseDir string
+	// snippets are the user's and the project's completion snippets.
+	snippets []userSnippet
+}
+
+type lintSettings struct {
+	// Rules maps lint rule names to error, warning, info, hint or off.
+	Rules map[string]string `json:"rules"`
+}
+
+type compatibilitySettings struct {
+	// Baselines are the deployed versions of schemas, as .kf files or
+	// schemas compiled to JSON. A document is compared with the baseline of
+	// the same database.
+	Baselines []string `json:"baselines"`
+	// Severity of breaking changes: error, warning, info, hint or off.
+	Severity string `json:"severity"`
+}
+
+type formatSettings struct {
+	// IndentSize is the number of columns per level, 0 to follow the editor.
+	IndentSize int `json:"indentSize"`
+	// Indent is spaces or tabs, empty to follow the editor.
+	Indent        string `json:"indent"`
+	MaxBlankLines int    `json:"maxBlankLines"`
+}
+
+type completionSettings struct {
+	// Snippets inserts placeholders for names and arguments.
+	Snippets bool `json:"snippets"`
+	// SQL offers SQL keywords and functions in action and procedure bodies.
+	SQL bool `json:"sql"`
+}
+
+type parserSettings struct {
+	// Version is the kwil-db release the schemas are written for.
+	Version string `json:"version"`
+}
+
+// extensionCatalog lists the methods of an extension, by the name it is
+// loaded with, e.g. math in "use math as m;".
+type extensionCatalog struct {
+	Name    string            `json:"name"`
+	Methods []extensionMethod `json:"methods"`
+}
+
+type extensionMethod struct {
+	Name        string   `json:"name"`
+	Parameters  []string `json:"parameters"`
+	Returns     []string `json:"returns"`
+	Description string   `json:"description"`
+}
+
+func defaultSettings() serverSettings {
+	return serverSettings{
+		Lint:          lintSettings{Rules: make(map[string]string)},
+		KeywordCase:   "preserve",
+		Format:        formatSettings{MaxBlankLines: defaultFormatOptions.maxBlankLines},
+		Completion:    completionSettings{Snippets: true, SQL: true},
+		Parser:        parserSettings{Version: bundledParserVersion},
+		Logging:       serverLogSettings,
+		Compatibility: compatibilitySettings{Severity: "error"},
+	}
+}
+
+// resolveSettings applies layers of JSON settings over the defaults. Empty
+// layers are skipped.
+func resolveSettings(layers ...json.RawMessage) (serverSettings, error) {
+	s := defaultSettings()
+	for _, layer := range layers {
+		if len(bytes.TrimSpace(layer)) == 0 || bytes.Equal(bytes.TrimSpace(layer), []byte("null")) {
+			continue
+		}
+		if err := json.Unmarshal(layer, &s); err != nil {
+			return defaultSettings(), err
+		}
+	}
+	return s, nil
+}
+
+// problems returns the settings that are not understood, so they can be
+// reported instead of silently ignored.
+func (s *serverSettings) problems() []string {
+	var problems []string
+	for name, severity := range s.Lint.Rules {
+		if findLintRule(name) == nil {
+			problems = append(problems, fmt.Sprintf("unknown lint rule %q", name))
+		}
+		if _, _, err := parseLintSeverity(severity); err != nil {
+			problems = append(problems, fmt.Sprintf("lint rule %s: %v", name, err))
+		}
+	}
+	switch s.KeywordCase {
+	case "lower", "upper", "preserve", "":
+	default:
+		problems = append(problems, fmt.Sprintf("invalid keyword case %q, expected lower, upper or preserve", s.KeywordCase))
+	}
+	switch s.Format.Indent {
+	case "spaces", "tabs", "":
+	default:
+		problems = append(problems, fmt.Sprintf("invalid indent %q, expected spaces or tabs", s.Format.Indent))
+	}
+	if _, _, err := parseLintSeverity(s.Compatibility.Severity); err != nil {
+		problems = append(problems, fmt.Sprintf("compatibility: %v", err))
+	}
+	if s.Parser.Version != "" && s.Parser.Version != bundledParserVersion {
+		problems = append(problems, fmt.Sprintf("parser version %s is not available, using %s", s.Parser.Version, bundledParserVersion))
+	}
+	return problems
+}
+
+// formatOptions returns the formatter options, falling back to the editor's
+// tab size and indentation for what the settings leave open.
+func (s *serverSettings) formatOptions(tabSize int, insertSpaces bool) formatOptions {
+	opts := defaultFormatOptions
+	if tabSize > 0 {
+		opts.indentSize = tabSize
+	}
+	opts.useTabs = !insertSpaces
+
+	if s.Format.IndentSize > 0 {
+		opts.indentSize = s.Format.IndentSize
+	}
+	switch s.Format.Indent {
+	case "spaces":
+		opts.useTabs = false
+	case "tabs":
+		opts.useTabs = true
+	}
+	if s.Format.MaxBlankLines >= 0 {
+		opts.maxBlankLines = s.Format.MaxBlankLines
+	}
+	opts.keywordCase = s.KeywordCase
+	return opts
+}
+
+// parseLintSeverity parses a lint rule severity. off is true if the rule is
+// turned off.
+func parseLintSeverity(s string) (severity lsp.DiagnosticSeverity, off bool, err error) {
+	switch strings.ToLower(s) {
+	case "error":
+		return lsp.Error, false, nil
+	case "warning", "warn":
+		return lsp.Warning, false, nil
+	case "info", "information":
+		return lsp.Information, false, nil
+	case "hint":
+		return lsp.Hint, false, nil
+	case "off":
+		return 0, true, nil
+	default:
+		return 0, false, fmt.Errorf("invalid severity %q, expected error, warning, info, hint or off", s)
+	}
+}
+
+var projectFiles = newFileCache(readProjectConfig)
+
+// lookupProjectConfig returns the nearest project file for a directory, if
+// any.
+func lookupProjectConfig(dir string) (string, json.RawMessage, error) {
+	path, info, err := findProjectFile(dir, projectConfigFile)
+	if path == "" || err != nil {
+		return path, nil, err
+	}
+	raw, err := projectFiles.loadAt(path, info.ModTime())
+	return path, raw, err
+}
+
+// findProjectFile returns the file name in the .kwil-ls directory of dir or
+// its nearest parent that has one. The path is empty if there is none.
+func findProjectFile(dir, name string) (string, fs.FileInfo, error) {
+	for {
+		path := filepath.Join(dir, lsDir, name)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, info, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return path, nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, nil
+		}
+		dir = parent
+	}
+}
+
+func readProjectConfig(path string) (json.RawMessage, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("%s is not valid JSON", path)
+	}
+	return raw, nil
+}
+
+// loadDirSettings resolves the settings for files in a directory outside
+// the editor, from the defaults and the project file.
+func loadDirSettings(dir string) (serverSettings, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return defaultSettings(), err
+	}
+
+	configPath, raw, err := lookupProjectConfig(abs)
+	if err != nil {
+		return defaultSettings(), err
+	}
+	s, err := resolveSettings(raw)
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", configPath, err)
+	}
+	s.baseDir = projectDir(configPath, abs)
+	return s, nil
+}
+
+// loadFileSettings resolves the settings for a file outside the editor,
+// with those of its database in the manifest.
+func loadFileSettings(file string) (serverSettings, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return defaultSettings(), err
+	}
+	s, err := loadDirSettings(filepath.Dir(abs))
+	if err != nil {
+		return s, err
+	}
+	_, _, db, err := lookupDatabase(abs)
+	if err != nil {
+		return s, err
+	}
+	if db != nil {
+		db.apply(&s)
+	}
+	return s, nil
+}
+
+// projectDir returns the directory containing the .kwil-ls directory of a
+// project file, or dir if there is no project file.
+func projectDir(configPath, dir string) string {
+	if configPath == "" {
+		return dir
+	}
+	return filepath.Dir(filepath.Dir(configPath))
+}
+
+// uriPath returns the file system path of a file:// URI.
+func uriPath(uri lsp.DocumentURI) (string, bool) {
+	u, err := url.Parse(string(uri))
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+
+	path := u.Path
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // windows drive letters
+	}
+	return filepath.FromSlash(path), true
+}
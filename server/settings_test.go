@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func Test_SettingsLayers(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "schemas", "app")
+	if err := os.MkdirAll(filepath.Join(root, lsDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	project := `{"keywordCase": "upper", "lint": {"rules": {"unused-parameter": "off"}}}`
+	if err := os.WriteFile(filepath.Join(root, lsDir, projectConfigFile), []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, raw, err := lookupProjectConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	editor := json.RawMessage(`{"keywordCase": "lower", "format": {"indent": "tabs"}, "lint": {"rules": {"update-without-where": "error"}}}`)
+	settings, err := resolveSettings(editor, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the project file wins over the editor, which wins over the defaults
+	if settings.KeywordCase != "upper" || settings.Format.Indent != "tabs" || !settings.Completion.Snippets {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if len(settings.problems()) != 0 {
+		t.Errorf("unexpected problems %v", settings.problems())
+	}
+
+	_, diagnostics := analyzeKfDocument(checkTestSchema, settings)
+	if len(diagnostics) != 1 || diagnostics[0].Code != "update-without-where" || diagnostics[0].Severity != lsp.Error {
+		t.Errorf("expected only update-without-where as an error, got %v", diagnostics)
+	}
+
+	formatted, err := formatKf("action a() public {\nselect * from users where id = 1;\n}\n", settings.formatOptions(4, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ACTION a() PUBLIC {\n\tSELECT * FROM users WHERE id = 1;\n}\n"; formatted != want {
+		t.Errorf("got %q, want %q", formatted, want)
+	}
+
+	bad, _ := resolveSettings(json.RawMessage(`{"keywordCase": "title", "parser": {"version": "v0.1"}, "lint": {"rules": {"nope": "loud"}}}`))
+	if problems := bad.problems(); len(problems) != 4 {
+		t.Errorf("expected 4 problems, got %v", problems)
+	}
+}
+
+func Test_SnippetPlainText(t *testing.T) {
+	tests := map[string]string{
+		"action ${1:}(${2:}) ${3:} {\n\t${4:}\n}":     "action ()  {\n\t\n}",
+		"abs(${1:value})":                             "abs(value)",
+		"do ${2|update,nothing|};":                    "do update;",
+		"on conflict (${1:}) do ${2|update|nothing};": "on conflict () do update;",
+		"select $1 from $2":                           "select  from ",
+	}
+	for snippet, want := range tests {
+		if got := snippetPlainText(snippet); got != want {
+			t.Errorf("snippetPlainText(%q) = %q, want %q", snippet, got, want)
+		}
+	}
+}
+
+func Test_SettingsPulledFromClient(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go acceptTCP(ctx, lis, newOutputLogger(logs))
+
+	client, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folder := lsp.DocumentURI("file:///work/strict")
+	diagnostics := make(chan lsp.PublishDiagnosticsParams, 10)
+	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(client, jsonrpc2.VSCodeObjectCodec{}),
+		jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			switch req.Method {
+			case "workspace/configuration":
+				var params lsp.ConfigurationParams
+				json.Unmarshal(*req.Params, &params)
+				res := make([]any, len(params.Items))
+				for i, item := range params.Items {
+					if item.ScopeURI == string(folder) {
+						res[i] = map[string]any{"lint": map[string]any{"rules": map[string]string{"unused-parameter": "error"}}}
+					}
+				}
+				return res, nil
+			case "textDocument/publishDiagnostics":
+				var params lsp.PublishDiagnosticsParams
+				json.Unmarshal(*req.Params, &params)
+				diagnostics <- params
+			}
+			return nil, nil
+		}))
+	defer conn.Close()
+
+	var init initializeParams
+	init.Capabilities.Workspace.Configuration = true
+	init.WorkspaceFolders = append(init.WorkspaceFolders, struct {
+		URI  lsp.DocumentURI `json:"uri"`
+		Name string          `json:"name"`
+	}{URI: folder, Name: "strict"})
+
+	var res initializeResult
+	if err := conn.Call(ctx, "initialize", init, &res); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Notify(ctx, "initialized", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uri := range []lsp.DocumentURI{folder + "/a.kf", "file:///elsewhere/a.kf"} {
+		conn.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+			TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "kuneiform", Text: checkTestSchema},
+		})
+	}
+
+	// wait until the settings are applied to both documents
+	severities := make(map[lsp.DocumentURI]lsp.DiagnosticSeverity)
+	timeout := time.After(5 * time.Second)
+	for severities[folder+"/a.kf"] != lsp.Error || severities["file:///elsewhere/a.kf"] != lsp.Warning {
+		select {
+		case params := <-diagnostics:
+			for _, d := range params.Diagnostics {
+				if d.Code == "unused-parameter" {
+					severities[params.URI] = d.Severity
+				}
+			}
+		case <-timeout:
+			t.Fatalf("settings were not applied: %v", severities)
+		}
+	}
+}
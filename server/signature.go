@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Signature help for calls of actions, procedures and foreign procedures,
+// with the doc comments of the callee and its parameters.
+
+var signatureHelpTriggers = []string{"(", ","}
+
+// getSignatureHelp finds the call around pos in text. The declarations come
+// from r, which was parsed from parsedText and may be older than text.
+func getSignatureHelp(text string, r *parse.SchemaParseResult, parsedText string, pos lsp.Position) *lsp.SignatureHelp {
+	if r == nil || r.Schema == nil {
+		return nil
+	}
+	toks := lexKf(text)
+	offset := positionOffset(lineOffsets(text), pos)
+
+	// find the unclosed parenthesis of the call around the cursor, counting
+	// the arguments before it
+	depth, active, open := 0, 0, -1
+	for i := len(toks) - 1; i >= 0 && open < 0; i-- {
+		if toks[i].end() > offset || toks[i].kind != tokPunct {
+			continue
+		}
+		switch toks[i].text {
+		case ")", "]":
+			depth++
+		case "(", "[":
+			if depth == 0 {
+				open = i
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				active++
+			}
+		case ";", "{", "}":
+			return nil
+		}
+	}
+	if open < 1 || toks[open].text != "(" {
+		return nil
+	}
+
+	// foreign procedures are called as name[dbid, procedure](...)
+	callee := open - 1
+	if toks[callee].text == "]" {
+		for depth := 0; callee >= 0; callee-- {
+			if toks[callee].text == "]" {
+				depth++
+			} else if toks[callee].text == "[" {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		callee--
+	}
+	if callee < 0 || toks[callee].kind != tokIdent {
+		return nil
+	}
+	if prev, ok := prevToken(toks, callee); ok && prev.text == "." {
+		return nil // extension method
+	}
+
+	name := normalizeIdent(toks[callee].text)
+	signature, params, labels, ok := methodSignature(r, name)
+	if !ok {
+		return nil
+	}
+	doc := collectDocComments(parsedText, r).of(name)
+	info := lsp.SignatureInformation{
+		Label:         signature,
+		Documentation: doc.description,
+		Parameters:    make([]lsp.ParameterInformation, len(labels)),
+	}
+	for i, label := range labels {
+		info.Parameters[i].Label = label
+		if i < len(params) {
+			info.Parameters[i].Documentation = doc.param(params[i])
+		}
+	}
+	return &lsp.SignatureHelp{Signatures: []lsp.SignatureInformation{info}, ActiveParameter: active}
+}
+
+// methodSignature returns the signature of an action, procedure or foreign
+// procedure, the names of its parameters, and their labels within the
+// signature. Foreign procedure parameters have types but no names.
+func methodSignature(r *parse.SchemaParseResult, name string) (signature string, params, labels []string, ok bool) {
+	if action, ok := r.Schema.FindAction(name); ok {
+		return actionSignature(action), action.Parameters, action.Parameters, true
+	}
+	if proc, ok := r.Schema.FindProcedure(name); ok {
+		for _, p := range proc.Parameters {
+			params = append(params, p.Name)
+			labels = append(labels, p.Name+" "+p.Type.String())
+		}
+		return procedureSignature(proc), params, labels, true
+	}
+	if proc, ok := r.Schema.FindForeignProcedure(name); ok {
+		for _, p := range proc.Parameters {
+			labels = append(labels, p.String())
+		}
+		return foreignProcedureSignature(proc), nil, labels, true
+	}
+	return "", nil, nil, false
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Snippets of the user and the project are offered by completion next to
+// the built in ones. They are read from ~/.kwil-ls/snippets.json and from
+// .kwil-ls/snippets.json in the document's directory or the nearest parent
+// that has one, in the format of VS Code snippets:
+//
+//	{
+//	  "owner check": {
+//	    "prefix": "owner",
+//	    "scope": "action",
+//	    "body": ["if @caller != $owner {", "\terror('not the owner');", "}"],
+//	    "description": "Only the owner may call the action"
+//	  }
+//	}
+//
+// Project snippets replace user snippets of the same name. Files are read
+// again when they change.
+
+const snippetsFile = "snippets.json"
+
+// snippetScopes are where snippets can be offered. A snippet without a
+// scope is offered everywhere.
+var snippetScopes = []string{"top-level", "table", "action", "procedure"}
+
+type userSnippet struct {
+	name        string
+	prefix      string
+	body        string
+	description string
+	scopes      []string
+}
+
+// snippetDefinition is a snippet as written in a snippets file. The body is
+// a string or a list of lines, the scope a comma separated string or a
+// list.
+type snippetDefinition struct {
+	Prefix      string     `json:"prefix"`
+	Body        stringList `json:"body"`
+	Description string     `json:"description"`
+	Scope       stringList `json:"scope"`
+}
+
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("expected a string or a list of strings")
+	}
+	*l = list
+	return nil
+}
+
+var snippetFiles = newFileCache(readSnippets)
+
+// readSnippets reads a snippets file. Invalid snippets are reported and
+// left out, the others are returned sorted by name.
+func readSnippets(path string) ([]userSnippet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var defs map[string]snippetDefinition
+	if err := json.Unmarshal(raw, &defs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var snippets []userSnippet
+	var errs []error
+	for name, def := range defs {
+		snippet, err := newUserSnippet(name, def)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: snippet %q: %w", path, name, err))
+			continue
+		}
+		snippets = append(snippets, snippet)
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].name < snippets[j].name })
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return snippets, errors.Join(errs...)
+}
+
+func newUserSnippet(name string, def snippetDefinition) (userSnippet, error) {
+	if def.Prefix == "" {
+		return userSnippet{}, errors.New("missing prefix")
+	}
+	if len(def.Body) == 0 {
+		return userSnippet{}, errors.New("missing body")
+	}
+
+	var scopes []string
+	for _, scope := range def.Scope {
+		for _, s := range strings.Split(scope, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if !slices.Contains(snippetScopes, s) {
+				return userSnippet{}, fmt.Errorf("unknown scope %q, expected %s", s, strings.Join(snippetScopes, ", "))
+			}
+			scopes = append(scopes, s)
+		}
+	}
+
+	return userSnippet{
+		name:        name,
+		prefix:      def.Prefix,
+		body:        strings.Join(def.Body, "\n"),
+		description: def.Description,
+		scopes:      scopes,
+	}, nil
+}
+
+// loadSnippets returns the snippets of the user and of the nearest project
+// for documents in dir, and the problems reading them.
+func loadSnippets(dir string) ([]userSnippet, []string) {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, lsDir, snippetsFile))
+	}
+
+	var problems []string
+	project, _, err := findProjectFile(dir, snippetsFile)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("error reading %s: %v", project, err))
+	}
+	if project != "" && !slices.Contains(paths, project) {
+		paths = append(paths, project)
+	}
+
+	var names []string
+	byName := make(map[string]userSnippet)
+	for _, path := range paths {
+		snippets, err := snippetFiles.load(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid snippets: %v", err))
+		}
+		for _, snippet := range snippets {
+			if _, ok := byName[snippet.name]; !ok {
+				names = append(names, snippet.name)
+			}
+			byName[snippet.name] = snippet
+		}
+	}
+
+	snippets := make([]userSnippet, len(names))
+	for i, name := range names {
+		snippets[i] = byName[name]
+	}
+	return snippets, problems
+}
+
+// completionScope returns the snippet scope at pos: table, action or
+// procedure inside of their blocks, top-level outside of any block, and
+// empty elsewhere, e.g. in foreign procedures.
+func completionScope(r *parse.SchemaParseResult, pos int) string {
+	switch {
+	case isWithinTableBlock(r, pos):
+		return "table"
+	case isWithinActionBlock(r, pos):
+		return "action"
+	case isWithinProcedureBlock(r, pos):
+		return "procedure"
+	case isWithinForeignProcedureBlock(r, pos):
+		return ""
+	default:
+		return "top-level"
+	}
+}
+
+// snippetCompletionItems returns the snippets offered in a scope.
+func snippetCompletionItems(snippets []userSnippet, scope string) []lsp.CompletionItem {
+	var items []lsp.CompletionItem
+	for _, snippet := range snippets {
+		if len(snippet.scopes) > 0 && !slices.Contains(snippet.scopes, scope) {
+			continue
+		}
+		items = append(items, lsp.CompletionItem{
+			Label:            snippet.prefix,
+			Kind:             lsp.CIKSnippet,
+			Detail:           snippet.name,
+			Documentation:    snippet.description,
+			InsertText:       snippet.body,
+			InsertTextFormat: lsp.ITFSnippet,
+		})
+	}
+	return items
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+const snippetTestSchema = `database app;
+
+table users {
+    id int primary key,
+
+}
+
+action get_user($id) public view {
+
+}
+
+procedure count_users() public view returns (n int) {
+
+}
+`
+
+func Test_Snippets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	root := t.TempDir()
+	dir := filepath.Join(root, "schemas")
+	for _, d := range []string{filepath.Join(home, lsDir), filepath.Join(root, lsDir), dir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(home, lsDir, snippetsFile), `{
+		"header": {"prefix": "hdr", "body": "// user header"},
+		"audit columns": {"prefix": "audit", "scope": "table", "body": ["created_at int notnull,", "created_by text notnull"]}
+	}`)
+	project := filepath.Join(root, lsDir, snippetsFile)
+	write(project, `{
+		"header": {"prefix": "hdr", "body": "// project header", "description": "License header"},
+		"owner check": {"prefix": "owner", "scope": "action, procedure", "body": ["if @caller != \\$${1:owner} {", "\terror('not the owner');", "}"]},
+		"broken": {"prefix": "x", "scope": "view", "body": "x"}
+	}`)
+
+	snippets, problems := loadSnippets(dir)
+	if len(problems) != 1 || !strings.Contains(problems[0], `unknown scope "view"`) {
+		t.Errorf("expected the unknown scope to be reported, got %v", problems)
+	}
+
+	res, _ := parse.ParseAndValidate([]byte(snippetTestSchema))
+	labels := func(scope string) map[string]lsp.CompletionItem {
+		items := make(map[string]lsp.CompletionItem)
+		for _, item := range snippetCompletionItems(snippets, scope) {
+			items[item.Label] = item
+		}
+		return items
+	}
+
+	tests := []struct {
+		marker string
+		scope  string
+		want   []string
+	}{
+		{"database app;", "top-level", []string{"hdr"}},
+		{"primary key,\n", "table", []string{"hdr", "audit"}},
+		{"public view {\n", "action", []string{"hdr", "owner"}},
+		{"returns (n int) {\n", "procedure", []string{"hdr", "owner"}},
+	}
+	for _, tt := range tests {
+		pos := strings.Index(snippetTestSchema, tt.marker) + len(tt.marker)
+		if scope := completionScope(res, pos); scope != tt.scope {
+			t.Errorf("after %q: got scope %q, want %q", tt.marker, scope, tt.scope)
+		}
+		items := labels(tt.scope)
+		if len(items) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.scope, items, tt.want)
+		}
+		for _, label := range tt.want {
+			if item, ok := items[label]; !ok || item.Kind != lsp.CIKSnippet || item.InsertTextFormat != lsp.ITFSnippet {
+				t.Errorf("%s: missing snippet %s in %v", tt.scope, label, items)
+			}
+		}
+	}
+
+	// the project snippet replaces the user's
+	if header := labels("top-level")["hdr"]; header.InsertText != "// project header" || header.Documentation != "License header" {
+		t.Errorf("unexpected header snippet %+v", header)
+	}
+	if owner := labels("action")["owner"]; owner.InsertText != "if @caller != \\$${1:owner} {\n\terror('not the owner');\n}" {
+		t.Errorf("unexpected owner snippet %q", owner.InsertText)
+	}
+
+	// changes are picked up without restarting
+	write(project, `{"header": {"prefix": "hdr", "body": "// changed"}}`)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(project, later, later); err != nil {
+		t.Fatal(err)
+	}
+	snippets, problems = loadSnippets(dir)
+	if len(problems) != 0 || len(snippets) != 2 || labels("top-level")["hdr"].InsertText != "// changed" {
+		t.Errorf("project snippets were not reloaded: %+v, %v", snippets, problems)
+	}
+}
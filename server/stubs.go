@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+// Client stubs: typed Go and TypeScript functions for the public actions and
+// procedures of a schema. Views are called, everything else is executed in
+// a transaction. Procedure parameters and results are typed; actions have
+// untyped parameters and return their rows as maps.
+
+var stubLanguages = []string{"go", "typescript"}
+
+// stubMethod is an action or procedure as the stubs see it.
+type stubMethod struct {
+	name   string
+	doc    string
+	view   bool
+	params []stubField
+	// typed is false for actions, whose parameters have no types.
+	typed bool
+	// returns are the result columns of procedures, and table is set for
+	// procedures returning a table.
+	returns []stubField
+	table   bool
+}
+
+type stubField struct {
+	name string // as declared, with the $ for parameters
+	typ  *types.DataType
+}
+
+func stubMethods(text string, r *parse.SchemaParseResult) []stubMethod {
+	docs := collectDocComments(text, r)
+	var methods []stubMethod
+	for _, a := range r.Schema.Actions {
+		if !a.Public {
+			continue
+		}
+		m := stubMethod{name: a.Name, doc: docs.of(a.Name).description, view: slices.Contains(a.Modifiers, types.ModifierView)}
+		for _, p := range a.Parameters {
+			m.params = append(m.params, stubField{name: p})
+		}
+		methods = append(methods, m)
+	}
+	for _, p := range r.Schema.Procedures {
+		if !p.Public {
+			continue
+		}
+		m := stubMethod{name: p.Name, doc: docs.of(p.Name).description, view: slices.Contains(p.Modifiers, types.ModifierView), typed: true}
+		for _, param := range p.Parameters {
+			m.params = append(m.params, stubField{name: param.Name, typ: param.Type})
+		}
+		if p.Returns != nil {
+			m.table = p.Returns.IsTable
+			for i, f := range p.Returns.Fields {
+				name := f.Name
+				if name == "" {
+					name = fmt.Sprintf("column%d", i+1)
+				}
+				m.returns = append(m.returns, stubField{name: name, typ: f.Type})
+			}
+		}
+		methods = append(methods, m)
+	}
+	return methods
+}
+
+// generateStubs generates the client for a valid schema. pkg is the Go
+// package name, by default the database name.
+func generateStubs(source, text string, r *parse.SchemaParseResult, lang, pkg string) (string, error) {
+	methods := stubMethods(text, r)
+	switch strings.ToLower(lang) {
+	case "go", "":
+		if pkg == "" {
+			pkg = strings.ToLower(identWords(r.Schema.Name, false))
+		}
+		code := goStubs(source, r.Schema.Name, pkg, methods)
+		formatted, err := format.Source([]byte(code))
+		if err != nil {
+			return code, fmt.Errorf("formatting generated code: %w", err)
+		}
+		return string(formatted), nil
+	case "typescript", "ts":
+		return tsStubs(source, r.Schema.Name, methods), nil
+	default:
+		return "", fmt.Errorf("unknown language %q, expected %s", lang, strings.Join(stubLanguages, ", "))
+	}
+}
+
+// stubFileName is the file a client for the schema is written to.
+func stubFileName(schema, lang string) string {
+	if strings.EqualFold(lang, "go") {
+		return schema + "_client.go"
+	}
+	return schema + "_client.ts"
+}
+
+// goInitialisms are written in upper case in Go names.
+var goInitialisms = map[string]bool{"id": true, "uuid": true, "url": true, "api": true, "json": true, "http": true, "ip": true, "sql": true}
+
+// identWords converts a Kuneiform name like $user_id to UserID, or userId
+// for TypeScript.
+func identWords(name string, initialisms bool) string {
+	var b strings.Builder
+	for i, word := range strings.FieldsFunc(strings.TrimLeft(name, "$@"), func(r rune) bool { return r == '_' }) {
+		switch {
+		case initialisms && goInitialisms[strings.ToLower(word)]:
+			b.WriteString(strings.ToUpper(word))
+		case i == 0 && !initialisms:
+			b.WriteString(strings.ToLower(word))
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + strings.ToLower(word[1:]))
+		}
+	}
+	return b.String()
+}
+
+func goName(name string) string {
+	return identWords(name, true)
+}
+
+func tsName(name string) string {
+	return identWords(name, false)
+}
+
+// goType maps a Kuneiform type, nil for untyped action parameters.
+func goType(t *types.DataType) (string, []string) {
+	if t == nil {
+		return "any", nil
+	}
+	var typ string
+	var imports []string
+	switch t.Name {
+	case "text":
+		typ = "string"
+	case "int":
+		typ = "int64"
+	case "bool":
+		typ = "bool"
+	case "blob":
+		typ = "[]byte"
+	case "uuid":
+		typ, imports = "*types.UUID", []string{"github.com/kwilteam/kwil-db/core/types"}
+	case "uint256":
+		typ, imports = "*types.Uint256", []string{"github.com/kwilteam/kwil-db/core/types"}
+	case "decimal":
+		typ, imports = "*decimal.Decimal", []string{"github.com/kwilteam/kwil-db/core/types/decimal"}
+	default:
+		typ = "any"
+	}
+	if t.IsArray {
+		typ = "[]" + typ
+	}
+	return typ, imports
+}
+
+func tsType(t *types.DataType) string {
+	if t == nil {
+		return "Value"
+	}
+	var typ string
+	switch t.Name {
+	case "text", "uuid", "uint256", "decimal":
+		typ = "string"
+	case "int":
+		typ = "number"
+	case "bool":
+		typ = "boolean"
+	case "blob":
+		typ = "Uint8Array"
+	default:
+		typ = "Value"
+	}
+	if t.IsArray {
+		typ += "[]"
+	}
+	return typ
+}
+
+// writeGoDoc writes the doc comment of a method: a summary line in the
+// style of Go, followed by the doc comment of the schema.
+func writeGoDoc(b *strings.Builder, summary, doc string) {
+	fmt.Fprintf(b, "// %s\n", summary)
+	if doc == "" {
+		return
+	}
+	b.WriteString("//\n")
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintf(b, "// %s\n", line)
+	}
+}
+
+func goStubs(source, database, pkg string, methods []stubMethod) string {
+	imports := map[string]bool{
+		"context":          true,
+		clientTypesImport:  true,
+		transactionsImport: true,
+	}
+	var body strings.Builder
+	decodes := false
+	for _, m := range methods {
+		name := goName(m.name)
+		// parameters
+		args := "ctx context.Context"
+		inputs := "nil"
+		var values []string
+		if len(m.params) > 0 {
+			fmt.Fprintf(&body, "// %sParams are the parameters of %s.\ntype %sParams struct {\n", name, m.name, name)
+			for _, p := range m.params {
+				typ, imps := goType(p.typ)
+				for _, imp := range imps {
+					imports[imp] = true
+				}
+				fmt.Fprintf(&body, "\t%s %s\n", goName(p.name), typ)
+				values = append(values, "params."+goName(p.name))
+			}
+			body.WriteString("}\n\n")
+			args += ", params " + name + "Params"
+			inputs = "[]any{" + strings.Join(values, ", ") + "}"
+		}
+
+		// results
+		var result, ret string
+		switch {
+		case !m.view:
+			result = "transactions.TxHash"
+		case len(m.returns) > 0:
+			row := name + "Result"
+			if m.table {
+				row = name + "Row"
+			}
+			fmt.Fprintf(&body, "// %s is a row returned by %s.\ntype %s struct {\n", row, m.name, row)
+			for _, f := range m.returns {
+				typ, imps := goType(f.typ)
+				for _, imp := range imps {
+					imports[imp] = true
+				}
+				fmt.Fprintf(&body, "\t%s %s `json:%q`\n", goName(f.name), typ, f.name)
+			}
+			body.WriteString("}\n\n")
+			decodes = true
+			result = "[]" + row
+			ret = "decodeRows[" + row + "](res)"
+			if !m.table {
+				result = "*" + row
+				ret = "decodeRow[" + row + "](res)"
+			}
+		case m.typed:
+			result = ""
+		default:
+			decodes = true
+			result = "[]map[string]any"
+			ret = "decodeRows[map[string]any](res)"
+		}
+
+		writeGoDoc(&body, fmt.Sprintf("%s calls %s.", name, m.name), m.doc)
+		switch {
+		case !m.view:
+			fmt.Fprintf(&body, "func (c *Client) %s(%s, opts ...clientType.TxOpt) (%s, error) {\n", name, args, result)
+			fmt.Fprintf(&body, "\treturn c.Kwil.Execute(ctx, c.DBID, %q, [][]any{{%s}}, opts...)\n}\n\n", m.name, strings.Join(values, ", "))
+		case result == "":
+			fmt.Fprintf(&body, "func (c *Client) %s(%s) error {\n", name, args)
+			fmt.Fprintf(&body, "\t_, err := c.Kwil.Call(ctx, c.DBID, %q, %s)\n\treturn err\n}\n\n", m.name, inputs)
+		default:
+			fmt.Fprintf(&body, "func (c *Client) %s(%s) (%s, error) {\n", name, args, result)
+			fmt.Fprintf(&body, "\tres, err := c.Kwil.Call(ctx, c.DBID, %q, %s)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n", m.name, inputs)
+			fmt.Fprintf(&body, "\treturn %s\n}\n\n", ret)
+		}
+	}
+	if decodes {
+		imports["encoding/json"] = true
+		body.WriteString(goDecodeHelpers)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by %s stubs from %s. DO NOT EDIT.\n\n", binaryName, source)
+	fmt.Fprintf(&b, "// Package %s is a client for the actions and procedures of the %s database.\n", pkg, database)
+	fmt.Fprintf(&b, "package %s\n\nimport (\n", pkg)
+	var paths []string
+	for imp := range imports {
+		paths = append(paths, imp)
+	}
+	slices.Sort(paths)
+	for i, imp := range paths {
+		// standard library imports first, then kwil-db
+		if i > 0 && !strings.Contains(paths[i-1], ".") && strings.Contains(imp, ".") {
+			b.WriteString("\n")
+		}
+		if imp == clientTypesImport {
+			fmt.Fprintf(&b, "\tclientType %q\n", imp)
+			continue
+		}
+		fmt.Fprintf(&b, "\t%q\n", imp)
+	}
+	b.WriteString(")\n\n")
+	b.WriteString(`// Kwil is the part of the kwil-db client the stubs use. *client.Client
+// from github.com/kwilteam/kwil-db/core/client implements it.
+type Kwil interface {
+	Call(ctx context.Context, dbid string, procedure string, inputs []any) (*clientType.CallResult, error)
+	Execute(ctx context.Context, dbid string, procedure string, tuples [][]any, opts ...clientType.TxOpt) (transactions.TxHash, error)
+}
+
+`)
+	fmt.Fprintf(&b, "// Client calls the actions and procedures of the %s database.\ntype Client struct {\n\tKwil Kwil\n\tDBID string\n}\n\n", database)
+	b.WriteString(body.String())
+	return b.String()
+}
+
+const (
+	clientTypesImport  = "github.com/kwilteam/kwil-db/core/types/client"
+	transactionsImport = "github.com/kwilteam/kwil-db/core/types/transactions"
+)
+
+const goDecodeHelpers = `// decodeRows converts the records of a call to rows.
+func decodeRows[T any](res *clientType.CallResult) ([]T, error) {
+	rows := make([]T, 0)
+	if res.Records == nil {
+		return rows, nil
+	}
+	b, err := json.Marshal(res.Records.Export())
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &rows)
+	return rows, err
+}
+
+// decodeRow returns the first row of a call, or nil if there is none.
+func decodeRow[T any](res *clientType.CallResult) (*T, error) {
+	rows, err := decodeRows[T](res)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+`
+
+func tsStubs(source, database string, methods []stubMethod) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by %s stubs from %s. DO NOT EDIT.\n\n", binaryName, source)
+	b.WriteString("import type { KwilSigner, NodeKwil, WebKwil } from '@kwilteam/kwil-js';\n\n")
+	b.WriteString("type Kwil = NodeKwil | WebKwil;\n\n")
+	b.WriteString("/** Value is an argument of an untyped action parameter. */\nexport type Value = string | number | boolean | null | Uint8Array;\n\n")
+
+	var class strings.Builder
+	className := goName(database) + "Client"
+	fmt.Fprintf(&class, "/** %s calls the actions and procedures of the %s database. */\n", className, database)
+	fmt.Fprintf(&class, "export class %s {\n", className)
+	class.WriteString("    constructor(private kwil: Kwil, private dbid: string, private signer?: KwilSigner) {}\n")
+
+	for _, m := range methods {
+		name := goName(m.name)
+		args, inputs := "", "[]"
+		if len(m.params) > 0 {
+			fmt.Fprintf(&b, "/** %sParams are the parameters of %s. */\nexport interface %sParams {\n", name, m.name, name)
+			var entries []string
+			for _, p := range m.params {
+				fmt.Fprintf(&b, "    %s: %s;\n", tsName(p.name), tsType(p.typ))
+				entries = append(entries, fmt.Sprintf("%s: params.%s", p.name, tsName(p.name)))
+			}
+			b.WriteString("}\n\n")
+			args = "params: " + name + "Params"
+			// kwil-js takes the arguments keyed by parameter name
+			inputs = "[{ " + strings.Join(entries, ", ") + " }]"
+		}
+
+		result := "Record<string, unknown>[]"
+		if len(m.returns) > 0 {
+			row := name + "Row"
+			if !m.table {
+				row = name + "Result"
+			}
+			fmt.Fprintf(&b, "/** %s is a row returned by %s. */\nexport interface %s {\n", row, m.name, row)
+			for _, f := range m.returns {
+				fmt.Fprintf(&b, "    %s: %s;\n", f.name, tsType(f.typ))
+			}
+			b.WriteString("}\n\n")
+			result = row + "[]"
+			if !m.table {
+				result = row + " | undefined"
+			}
+		} else if m.typed {
+			result = "void"
+		}
+
+		class.WriteString("\n")
+		doc := m.doc
+		if doc == "" {
+			doc = fmt.Sprintf("Calls %s.", m.name)
+		}
+		fmt.Fprintf(&class, "    /** %s */\n", strings.ReplaceAll(doc, "\n", "\n     * "))
+		body := fmt.Sprintf("{ dbid: this.dbid, name: '%s', inputs: %s }", m.name, inputs)
+		if !m.view {
+			fmt.Fprintf(&class, "    async %s(%s): Promise<string> {\n", tsName(m.name), args)
+			class.WriteString("        if (!this.signer) {\n")
+			fmt.Fprintf(&class, "            throw new Error('%s needs a signer');\n", m.name)
+			class.WriteString("        }\n")
+			fmt.Fprintf(&class, "        const res = await this.kwil.execute(%s, this.signer, true);\n", body)
+			class.WriteString("        return res.data?.tx_hash ?? '';\n    }\n")
+			continue
+		}
+		fmt.Fprintf(&class, "    async %s(%s): Promise<%s> {\n", tsName(m.name), args, result)
+		if result == "void" {
+			fmt.Fprintf(&class, "        await this.kwil.call(%s, this.signer);\n    }\n", body)
+			continue
+		}
+		fmt.Fprintf(&class, "        const res = await this.kwil.call(%s, this.signer);\n", body)
+		switch {
+		case len(m.returns) > 0 && !m.table:
+			fmt.Fprintf(&class, "        return res.data?.result?.[0] as %s;\n", strings.TrimSuffix(result, " | undefined"))
+		default:
+			fmt.Fprintf(&class, "        return (res.data?.result ?? []) as %s;\n", result)
+		}
+		class.WriteString("    }\n")
+	}
+	class.WriteString("}\n")
+	b.WriteString(class.String())
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"go/parser"
+	gotoken "go/token"
+	"strings"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/parse"
+)
+
+const stubsSchema = `database shop;
+
+table users {
+    id uuid primary key,
+    name text notnull
+}
+
+// Creates a user.
+action create_user($id, $name) public {
+    INSERT INTO users (id, name) VALUES ($id, $name);
+}
+
+action delete_all() private {
+    DELETE FROM users;
+}
+
+procedure find_users($name text) public view returns table(id uuid, name text) {
+    return SELECT id, name FROM users WHERE name = $name;
+}
+
+procedure user_count() public view returns (total int) {
+    for $row in SELECT count(*) as c FROM users {
+        return $row.c;
+    }
+}
+`
+
+func Test_GenerateStubs(t *testing.T) {
+	res, _ := parse.ParseAndValidate([]byte(stubsSchema))
+	if err := res.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := generateStubs("shop.kf", stubsSchema, res, "go", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(gotoken.NewFileSet(), "shop_client.go", code, 0); err != nil {
+		t.Fatalf("generated Go doesn't parse: %v\n%s", err, code)
+	}
+	for _, want := range []string{
+		"package shop\n",
+		"func (c *Client) CreateUser(ctx context.Context, params CreateUserParams, opts ...clientType.TxOpt) (transactions.TxHash, error) {",
+		"// CreateUser calls create_user.\n//\n// Creates a user.\n",
+		"\tName string\n",
+		"\tID   *types.UUID `json:\"id\"`\n",
+		"func (c *Client) FindUsers(ctx context.Context, params FindUsersParams) ([]FindUsersRow, error) {",
+		"func (c *Client) UserCount(ctx context.Context) (*UserCountResult, error) {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected the Go client to contain %q, got\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "DeleteAll") {
+		t.Error("expected no stub for a private action")
+	}
+
+	code, err = generateStubs("shop.kf", stubsSchema, res, "ts", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"export class ShopClient {",
+		"async findUsers(params: FindUsersParams): Promise<FindUsersRow[]> {",
+		"inputs: [{ $name: params.name }]",
+		"async userCount(): Promise<UserCountResult | undefined> {",
+		"    total: number;\n",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("expected the TypeScript client to contain %q, got\n%s", want, code)
+		}
+	}
+
+	if _, err := generateStubs("shop.kf", stubsSchema, res, "rust", ""); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+}
+
+func Test_StubCodeActions(t *testing.T) {
+	actions := getCodeActions(fileURI("/work/shop.kf"), "shop")
+	if len(actions) != 2 || actions[0].Title != "Generate Go client (shop_client.go)" || actions[1].Title != "Generate TypeScript client (shop_client.ts)" {
+		t.Fatalf("unexpected code actions %+v", actions)
+	}
+	if actions[0].Edit != nil {
+		t.Errorf("expected the edit to be left to resolve, got %+v", actions[0].Edit)
+	}
+	if actions := getCodeActions(fileURI("/work/shop.kf"), ""); len(actions) != 0 {
+		t.Errorf("expected no code actions without a database name, got %+v", actions)
+	}
+
+	res, _ := parse.ParseAndValidate([]byte(stubsSchema))
+	if err := resolveCodeAction(&actions[0], stubsSchema, res); err != nil {
+		t.Fatal(err)
+	}
+	create, ok := actions[0].Edit.DocumentChanges[0].(createFile)
+	if !ok || create.URI != fileURI("/work/shop_client.go") || !create.Options.Overwrite {
+		t.Errorf("unexpected file creation %+v", actions[0].Edit.DocumentChanges[0])
+	}
+
+	broken, _ := parse.ParseAndValidate([]byte("database shop; action a() public { SELECT * FROM nope; }"))
+	if err := resolveCodeAction(&actions[1], "", broken); err == nil {
+		t.Error("expected an error for a schema with errors")
+	}
+}
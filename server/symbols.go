@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/kwilteam/kwil-db/parse"
+	"github.com/sourcegraph/go-lsp"
+)
+
+// Document symbols: the database, its tables (with columns), extensions,
+// actions, procedures and foreign procedures.
+
+var symbolKindNames = map[lsp.SymbolKind]string{
+	lsp.SKNamespace: "database",
+	lsp.SKStruct:    "table",
+	lsp.SKField:     "column",
+	lsp.SKModule:    "extension",
+	lsp.SKMethod:    "action",
+	lsp.SKFunction:  "procedure",
+	lsp.SKInterface: "foreign procedure",
+}
+
+func getDocumentSymbols(uri lsp.DocumentURI, text string, r *parse.SchemaParseResult) []lsp.SymbolInformation {
+	symbols := make([]lsp.SymbolInformation, 0)
+	if r == nil || r.Schema == nil || r.SchemaInfo == nil {
+		return symbols
+	}
+
+	toks := lexKf(text)
+	add := func(name string, kind lsp.SymbolKind, rng lsp.Range, container string) {
+		symbols = append(symbols, lsp.SymbolInformation{
+			Name:          name,
+			Kind:          kind,
+			Location:      lsp.Location{URI: uri, Range: rng},
+			ContainerName: container,
+		})
+	}
+
+	if tok, ok := findDatabaseToken(toks); ok {
+		add(r.Schema.Name, lsp.SKNamespace, tokenRange(tok), "")
+	}
+
+	for _, table := range r.Schema.Tables {
+		block, ok := r.SchemaInfo.Blocks[table.Name]
+		if !ok {
+			continue
+		}
+		add(table.Name, lsp.SKStruct, blockRange(block), r.Schema.Name)
+
+		for _, column := range table.Columns {
+			if tok, ok := findColumnToken(toks, block, column.Name); ok {
+				add(column.Name, lsp.SKField, tokenRange(tok), table.Name)
+			}
+		}
+	}
+
+	for _, extension := range r.Schema.Extensions {
+		if block, ok := r.SchemaInfo.Blocks[extension.Alias]; ok {
+			add(extension.Alias, lsp.SKModule, blockRange(block), r.Schema.Name)
+		}
+	}
+
+	for _, loc := range getActionLocations(r) {
+		add(loc.name, lsp.SKMethod, blockRange(r.SchemaInfo.Blocks[loc.name]), r.Schema.Name)
+	}
+
+	for _, loc := range getProcedureLocations(r) {
+		add(loc.name, lsp.SKFunction, blockRange(r.SchemaInfo.Blocks[loc.name]), r.Schema.Name)
+	}
+
+	for _, loc := range getForeignProcedureLocations(r) {
+		add(loc.name, lsp.SKInterface, blockRange(r.SchemaInfo.Blocks[loc.name]), r.Schema.Name)
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].Location.Range.Start, symbols[j].Location.Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+	return symbols
+}
+
+// findDatabaseToken returns the name token of the database declaration.
+func findDatabaseToken(toks []token) (token, bool) {
+	for i, tok := range toks {
+		if tok.kind == tokIdent && tok.is("database") && i+1 < len(toks) && toks[i+1].kind == tokIdent {
+			return toks[i+1], true
+		}
+	}
+	return token{}, false
+}
+
+// findColumnToken returns the token declaring a column inside a table block.
+// Column declarations are the first identifier after the opening brace or
+// after a comma outside of parentheses.
+func findColumnToken(toks []token, block *parse.Block, column string) (token, bool) {
+	parens := 0
+	expectName := false
+	for _, tok := range toks {
+		if tok.offset < block.AbsStart || tok.offset > block.AbsEnd || tok.kind == tokComment {
+			continue
+		}
+
+		switch {
+		case tok.text == "(":
+			parens++
+		case tok.text == ")":
+			parens--
+		case parens == 0 && (tok.text == "{" || tok.text == ","):
+			expectName = true
+			continue
+		case expectName && tok.kind == tokIdent && tok.is(column):
+			return tok, true
+		}
+		expectName = false
+	}
+	return token{}, false
+}
+
+// blockRange converts the position of a top-level block to an LSP range.
+func blockRange(block *parse.Block) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{
+			Line:      block.StartLine - 1,
+			Character: block.StartCol,
+		},
+		End: lsp.Position{
+			Line:      block.EndLine - 1,
+			Character: block.EndCol + 1, // EndCol is the start of the closing brace
+		},
+	}
+}
+
+func tokenRange(tok token) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: tok.line, Character: tok.col},
+		End:   lsp.Position{Line: tok.line, Character: tok.col + len(tok.text)},
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/kwilteam/kwil-db/core/types"
+)
+
+// tableOrder sorts the tables so that parents come before the tables
+// referencing them, for creating tables or inserting rows. Cycles are
+// broken at the first of their foreign keys breakable accepts, which is
+// returned for the caller to handle after the tables, e.g. by leaving it
+// null.
+func tableOrder(schema *types.Schema, breakable func(*types.Table, *types.ForeignKey) bool) ([]*types.Table, map[*types.ForeignKey]bool, error) {
+	broken := make(map[*types.ForeignKey]bool)
+	done := make(map[string]bool)
+	var order []*types.Table
+	for len(order) < len(schema.Tables) {
+		progress := false
+		for _, table := range schema.Tables {
+			if done[strings.ToLower(table.Name)] || !parentsDone(table, done, broken) {
+				continue
+			}
+			done[strings.ToLower(table.Name)] = true
+			order = append(order, table)
+			progress = true
+		}
+		if progress {
+			continue
+		}
+
+		// a cycle: break it at a foreign key the caller can handle
+		found := false
+		for _, table := range schema.Tables {
+			if done[strings.ToLower(table.Name)] {
+				continue
+			}
+			for _, fk := range table.ForeignKeys {
+				if broken[fk] || done[strings.ToLower(fk.ParentTable)] || strings.EqualFold(fk.ParentTable, table.Name) {
+					continue
+				}
+				if references(schema, fk.ParentTable, table.Name, done, broken) && breakable(table, fk) {
+					broken[fk] = true
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return nil, nil, errors.New("the foreign keys form a cycle of not null columns")
+		}
+	}
+	return order, broken, nil
+}
+
+func parentsDone(table *types.Table, done map[string]bool, broken map[*types.ForeignKey]bool) bool {
+	for _, fk := range table.ForeignKeys {
+		if !broken[fk] && !strings.EqualFold(fk.ParentTable, table.Name) && !done[strings.ToLower(fk.ParentTable)] {
+			return false
+		}
+	}
+	return true
+}
+
+// references reports whether table from references table to through the
+// foreign keys of tables not done yet.
+func references(schema *types.Schema, from, to string, done map[string]bool, broken map[*types.ForeignKey]bool) bool {
+	seen := make(map[string]bool)
+	queue := []string{strings.ToLower(from)}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name == strings.ToLower(to) {
+			return true
+		}
+		table, ok := schema.FindTable(name)
+		if !ok || seen[name] || done[name] {
+			continue
+		}
+		seen[name] = true
+		for _, fk := range table.ForeignKeys {
+			if !broken[fk] {
+				queue = append(queue, strings.ToLower(fk.ParentTable))
+			}
+		}
+	}
+	return false
+}
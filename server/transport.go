@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/sourcegraph/jsonrpc2"
+	jsonrpc2ws "github.com/sourcegraph/jsonrpc2/websocket"
+)
+
+// Transports for the language server. Every connection gets its own session
+// with its own lspHandler, so clients sharing a TCP or WebSocket server never
+// see each other's documents.
+
+var sessionCount atomic.Int64
+
+// serve runs a language server session on the stream until the client
+// disconnects. Clients of a shared server can't change the process wide
+// logging settings.
+func serve(ctx context.Context, stream jsonrpc2.ObjectStream, logger *slog.Logger, shared bool) {
+	session := sessionCount.Add(1)
+	logger = logger.With(slog.Int64("session", session))
+
+	// Initialize the language server and register the handlers
+	handler := newLspHandler(logger)
+	handler.shared = shared
+	conn := jsonrpc2.NewConn(ctx, stream, handler)
+	handler.clientLog.setConn(conn)
+
+	logger.Info("Connected to the client...")
+	defer conn.Close()
+
+	<-conn.DisconnectNotify()
+	logger.Info("Client disconnected")
+}
+
+// serveTCP accepts clients on addr, serving each in its own session.
+func serveTCP(ctx context.Context, addr string, logger *slog.Logger) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+
+	logger.Info("Listening for TCP clients", slog.String("addr", lis.Addr().String()))
+	return acceptTCP(ctx, lis, logger)
+}
+
+func acceptTCP(ctx context.Context, lis net.Listener, logger *slog.Logger) error {
+	for {
+		nc, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go serve(ctx, jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}), logger, true)
+	}
+}
+
+// serveWebSocket accepts WebSocket clients on addr, serving each in its own
+// session. Every message is a single JSON-RPC object, without the
+// Content-Length headers used on stdio and TCP. Browsers are only allowed to
+// connect from the listed origins; "*" allows any origin, and no origins
+// allows only pages served from the same host.
+func serveWebSocket(ctx context.Context, addr string, origins []string, logger *slog.Logger) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Listening for WebSocket clients", slog.String("addr", lis.Addr().String()))
+	err = http.Serve(lis, webSocketHandler(ctx, origins, logger))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func webSocketHandler(ctx context.Context, origins []string, logger *slog.Logger) http.Handler {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return checkOrigin(r, origins)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wc, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Error("websocket upgrade failed", slog.String("remote", r.RemoteAddr), slog.String("err", err.Error()))
+			return
+		}
+		serve(ctx, jsonrpc2ws.NewObjectStream(wc), logger, true)
+	})
+}
+
+func checkOrigin(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // not a browser
+	}
+
+	for _, allowed := range origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
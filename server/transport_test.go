@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sourcegraph/go-lsp"
+	"github.com/sourcegraph/jsonrpc2"
+	jsonrpc2ws "github.com/sourcegraph/jsonrpc2/websocket"
+)
+
+// testClient is a minimal LSP client that records published diagnostics.
+type testClient struct {
+	conn        *jsonrpc2.Conn
+	diagnostics chan lsp.PublishDiagnosticsParams
+}
+
+func newTestClient(ctx context.Context, stream jsonrpc2.ObjectStream) *testClient {
+	c := &testClient{diagnostics: make(chan lsp.PublishDiagnosticsParams, 10)}
+	c.conn = jsonrpc2.NewConn(ctx, stream, jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+		if req.Method == "textDocument/publishDiagnostics" {
+			var params lsp.PublishDiagnosticsParams
+			json.Unmarshal(*req.Params, &params)
+			c.diagnostics <- params
+		}
+		return nil, nil
+	}))
+	return c
+}
+
+// open opens a document and waits for its diagnostics.
+func (c *testClient) open(t *testing.T, uri, text string) []lsp.Diagnostic {
+	ctx := context.Background()
+	var res initializeResult
+	if err := c.conn.Call(ctx, "initialize", lsp.InitializeParams{}, &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Capabilities.FoldingRangeProvider || !res.Capabilities.DocumentFormattingProvider {
+		t.Errorf("unexpected capabilities %+v", res.Capabilities)
+	}
+
+	err := c.conn.Notify(ctx, "textDocument/didOpen", lsp.DidOpenTextDocumentParams{
+		TextDocument: lsp.TextDocumentItem{URI: lsp.DocumentURI(uri), LanguageID: "kuneiform", Text: text},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case params := <-c.diagnostics:
+		return params.Diagnostics
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for diagnostics")
+		return nil
+	}
+}
+
+func Test_TransportSessionsAreIsolated(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go acceptTCP(ctx, lis, logger)
+
+	srv := httptest.NewServer(webSocketHandler(ctx, nil, logger))
+	defer srv.Close()
+
+	dial := func() *testClient {
+		nc, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newTestClient(ctx, jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}))
+	}
+
+	wc, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := "database glow;\n\ntable users {\n    id uuid primary key\n}\n"
+	invalid := "database glow;\n\ntable users {\n}\n"
+	accounts := "database glow;\n\ntable accounts {\n    id uuid primary key\n}\n"
+
+	// the same URI is opened with different contents by each client
+	clients := []*testClient{dial(), dial(), newTestClient(ctx, jsonrpc2ws.NewObjectStream(wc))}
+	texts := []string{users, invalid, accounts}
+	for i, c := range clients {
+		defer c.conn.Close()
+
+		diagnostics := c.open(t, "file:///shared.kf", texts[i])
+		if hasErrors := len(diagnostics) > 0; hasErrors != (texts[i] == invalid) {
+			t.Errorf("client %d: unexpected diagnostics %v", i, diagnostics)
+		}
+	}
+
+	for i, table := range map[int]string{0: "users", 2: "accounts"} {
+		var symbols []lsp.SymbolInformation
+		err := clients[i].conn.Call(ctx, "textDocument/documentSymbol", lsp.DocumentSymbolParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: "file:///shared.kf"},
+		}, &symbols)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, s := range symbols {
+			found = found || (s.Kind == lsp.SKStruct && s.Name == table)
+		}
+		if !found {
+			t.Errorf("client %d: expected table %s in %v", i, table, symbols)
+		}
+	}
+}
+
+func Test_CheckTransports(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, true},
+		{[]string{"--stdio"}, true},
+		{[]string{"--tcp", ":7000"}, true},
+		{[]string{"--tcp", ":7000", "--ws", ":7001"}, true},
+		{[]string{"--stdio", "--tcp", ":7000"}, false},
+		{[]string{"--stdio", "--ws", ":7001"}, false},
+		{[]string{"--stdio=false"}, false},
+		{[]string{"--stdio=false", "--ws", ":7001"}, true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		stdio := fs.Bool("stdio", true, "")
+		tcp := fs.String("tcp", "", "")
+		ws := fs.String("ws", "", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkTransports(fs, *stdio, *tcp, *ws); (err == nil) != tt.ok {
+			t.Errorf("%v: got %v", tt.args, err)
+		}
+	}
+}
+
+func Test_CompletionBeforeFirstParse(t *testing.T) {
+	ctx := context.Background()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go acceptTCP(ctx, lis, newOutputLogger(logs))
+
+	nc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(ctx, jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}))
+	defer c.conn.Close()
+
+	// the document never parsed, so the cursor is only in the current text
+	c.open(t, "file:///broken.kf", "database glow;\n\ntable users {\n    id uuid primary key,\n    \n")
+
+	callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var items []lsp.CompletionItem
+	err = c.conn.Call(callCtx, "textDocument/completion", lsp.CompletionParams{
+		TextDocumentPositionParams: lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: "file:///broken.kf"},
+			Position:     lsp.Position{Line: 4, Character: 4},
+		},
+	}, &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) == 0 {
+		t.Error("expected completion items")
+	}
+}